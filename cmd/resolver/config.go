@@ -1,11 +1,22 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"github.com/hawell/z42/internal/admin"
+	"github.com/hawell/z42/internal/cookie"
+	"github.com/hawell/z42/internal/dnssec"
+	"github.com/hawell/z42/internal/dnstap"
 	"github.com/hawell/z42/internal/handler"
+	"github.com/hawell/z42/internal/metrics"
+	"github.com/hawell/z42/internal/notify"
+	"github.com/hawell/z42/internal/rollover"
+	"github.com/hawell/z42/internal/rrl"
+	"github.com/hawell/z42/internal/secondary"
 	"github.com/hawell/z42/internal/server"
 	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/internal/tsig"
 	"github.com/hawell/z42/internal/upstream"
 	"github.com/hawell/z42/pkg/geoip"
 	"github.com/hawell/z42/pkg/hiredis"
@@ -17,6 +28,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -28,6 +40,12 @@ type Config struct {
 	RedisStat storage.StatHandlerConfig       `json:"redis_stat"`
 	Handler   handler.DnsRequestHandlerConfig `json:"handler"`
 	RateLimit ratelimit.Config                `json:"ratelimit"`
+	Notify    notify.Config                   `json:"notify"`
+	Secondary secondary.Config                `json:"secondary"`
+	Rollover  rollover.Config                 `json:"rollover"`
+	Metrics   metrics.Config                  `json:"metrics"`
+	Dnstap    dnstap.Config                   `json:"dnstap"`
+	Admin     admin.Config                    `json:"admin"`
 }
 
 var resolverDefaultConfig = &Config{
@@ -51,6 +69,7 @@ var resolverDefaultConfig = &Config{
 		ZoneReload:         60,
 		RecordCacheSize:    1000000,
 		RecordCacheTimeout: 60,
+		JournalSize:        1000,
 		MinTTL:             5,
 		MaxTTL:             300,
 		Redis: hiredis.Config{
@@ -105,6 +124,31 @@ var resolverDefaultConfig = &Config{
 			ASNDB:     "geoIsp.mmdb",
 		},
 		LogSourceLocation: false,
+		SignatureCache: dnssec.SignatureCacheConfig{
+			Size:    100000,
+			Refresh: 86400,
+		},
+		Ecs: handler.EcsConfig{
+			MaxSourcePrefixV4: 24,
+			MaxSourcePrefixV6: 56,
+		},
+		Cookie: cookie.Config{
+			Enable:         false,
+			Secret:         "",
+			SecretLifetime: 86400,
+			BadCookie:      false,
+		},
+		Rrl: rrl.Config{
+			Enable:             false,
+			ResponsesPerSecond: 10,
+			NxdomainsPerSecond: 10,
+			ErrorsPerSecond:    10,
+			Window:             15,
+			Slip:               2,
+			IPv4PrefixLength:   24,
+			IPv6PrefixLength:   56,
+			LogOnly:            false,
+		},
 	},
 	RateLimit: ratelimit.Config{
 		Enable:    false,
@@ -112,11 +156,62 @@ var resolverDefaultConfig = &Config{
 		Burst:     10,
 		BlackList: []string{},
 		WhiteList: []string{},
+		Prefixes:  []ratelimit.PrefixConfig{},
+		Reload:    60,
+	},
+	Notify: notify.Config{
+		Enable:        false,
+		Delay:         1000,
+		Timeout:       1000,
+		Retries:       3,
+		RetryInterval: 5000,
+	},
+	Secondary: secondary.Config{
+		Enable:  false,
+		Timeout: 5000,
+		Zones:   []secondary.ZoneConfig{},
+	},
+	Rollover: rollover.Config{
+		Enable:           false,
+		CheckInterval:    3600,
+		Algorithm:        "ECDSAP256SHA256",
+		DnsKeyTTL:        3600,
+		ZSKLifetime:      30 * 24 * 3600,
+		KSKLifetime:      365 * 24 * 3600,
+		PropagationDelay: 3600,
+		MaxZoneTTL:       86400,
+		ParentDSTTL:      86400,
+	},
+	Metrics: metrics.Config{
+		Enable:   false,
+		Ip:       "127.0.0.1",
+		Port:     9153,
+		Path:     "/metrics",
+		MaxZones: 100,
+	},
+	Dnstap: dnstap.Config{
+		Enable:     false,
+		Target:     "unix",
+		Address:    "/var/run/z42/dnstap.sock",
+		Identity:   "",
+		Version:    "z42",
+		BufferSize: 10000,
+		Queries:    true,
+		Responses:  true,
+	},
+	Admin: admin.Config{
+		Enable: false,
+		Ip:     "127.0.0.1",
+		Port:   6060,
+		Token:  "",
 	},
 }
 
 func LoadConfig(path string) (*Config, error) {
-	config := resolverDefaultConfig
+	// defaults are copied so running config is not modified when config is reloaded
+	config := new(Config)
+	defaults, _ := jsoniter.Marshal(resolverDefaultConfig)
+	_ = jsoniter.Unmarshal(defaults, config)
 	configFile, err := os.Open(path)
 	if err != nil {
 		log.Printf("[ERROR] cannot load file %s : %s", path, err)
@@ -134,6 +229,46 @@ func LoadConfig(path string) (*Config, error) {
 	return config, nil
 }
 
+// listening reports whether a listener of config is bound to same address and transport as serverConfig
+func (config *Config) listening(serverConfig server.ServerConfig) bool {
+	if config == nil {
+		return false
+	}
+	transport := func(protocol string) string {
+		switch protocol {
+		case "https":
+			return "tcp"
+		case "quic":
+			return "udp"
+		}
+		return protocol
+	}
+	for _, s := range config.Server {
+		if s.Ip == serverConfig.Ip && s.Port == serverConfig.Port && transport(s.Protocol) == transport(serverConfig.Protocol) {
+			return true
+		}
+	}
+	return false
+}
+
+const redacted = "<redacted>"
+
+// Redacted returns a copy of config with passwords and secrets removed
+func (config *Config) Redacted() *Config {
+	c := *config
+	c.RedisData.Redis.Password = redacted
+	c.RedisStat.Redis.Password = redacted
+	c.Handler.Tsig.Keys = append([]tsig.KeyConfig(nil), config.Handler.Tsig.Keys...)
+	for i := range c.Handler.Tsig.Keys {
+		c.Handler.Tsig.Keys[i].Secret = redacted
+	}
+	if c.Handler.Cookie.Secret != "" {
+		c.Handler.Cookie.Secret = redacted
+	}
+	c.Admin.Token = redacted
+	return &c
+}
+
 func Verify(configFile string) {
 	ok := aurora.Bold(aurora.Green("[ OK ]"))
 	fail := aurora.Bold(aurora.Red("[FAIL]"))
@@ -150,6 +285,27 @@ func Verify(configFile string) {
 		fmt.Printf("%-60s%s : %s\n", msg, warn, warning)
 	}
 
+	fmt.Println("Starting Config Verification")
+
+	msg := fmt.Sprintf("loading config file : %s", configFile)
+	config, err := LoadConfig(configFile)
+	printResult(msg, err)
+
+	verifyConfig(config, nil, func(section string) { fmt.Println(section) }, printResult, printWarning)
+}
+
+// verifyConfig reports results of config checks and returns false if any check failed, listeners of running config are not checked for availability
+// running is set on reload, upstreams are not queried and redis is checked only if its config has changed since checks run on signal handling goroutine
+func verifyConfig(config *Config, running *Config, printSection func(section string), printResult func(msg string, err error), printWarning func(msg string, warning string)) bool {
+	ok := true
+	report := printResult
+	printResult = func(msg string, err error) {
+		if err != nil {
+			ok = false
+		}
+		report(msg, err)
+	}
+
 	checkAddress := func(protocol string, ip string, port int) {
 		msg := fmt.Sprintf("checking protocol : %s", protocol)
 		var err error = nil
@@ -174,7 +330,7 @@ func Verify(configFile string) {
 	}
 
 	checkRedis := func(config *hiredis.Config) {
-		fmt.Println("checking redis...")
+		printSection("checking redis...")
 		rd := hiredis.NewRedis(config)
 		msg := fmt.Sprintf("checking whether %s://%s is available", config.Net, config.Address)
 		err := rd.Ping()
@@ -192,15 +348,49 @@ func Verify(configFile string) {
 		printResult(msg, err)
 	}
 
-	fmt.Println("Starting Config Verification")
-
-	msg := fmt.Sprintf("loading config file : %s", configFile)
-	config, err := LoadConfig(configFile)
-	printResult(msg, err)
-
-	fmt.Println("checking listeners...")
+	var (
+		msg string
+		err error
+	)
+	printSection("checking listeners...")
 	for _, serverConfig := range config.Server {
-		checkAddress(serverConfig.Protocol, serverConfig.Ip, serverConfig.Port)
+		protocol := serverConfig.Protocol
+		msg = fmt.Sprintf("checking tls config for %s:%d", serverConfig.Ip, serverConfig.Port)
+		switch protocol {
+		case "https":
+			// doh listens on tcp
+			protocol = "tcp"
+			if !serverConfig.Tls.Enable {
+				printWarning(msg, "tls is disabled, serving plain http")
+			} else {
+				_, err = tls.LoadX509KeyPair(serverConfig.Tls.CertPath, serverConfig.Tls.KeyPath)
+				printResult(msg, err)
+			}
+		case "quic":
+			// doq listens on udp
+			protocol = "udp"
+			if !serverConfig.Tls.Enable {
+				printResult(msg, errors.New("tls is required for quic"))
+			} else {
+				_, err = tls.LoadX509KeyPair(serverConfig.Tls.CertPath, serverConfig.Tls.KeyPath)
+				printResult(msg, err)
+			}
+		}
+		if serverConfig.ProxyProtocol.Enable {
+			msg = fmt.Sprintf("checking proxy protocol for %s:%d", serverConfig.Ip, serverConfig.Port)
+			if protocol == "udp" {
+				printWarning(msg, "proxy protocol is not supported on udp")
+			} else {
+				err = nil
+				for _, proxy := range serverConfig.ProxyProtocol.TrustedProxies {
+					if _, _, e := net.ParseCIDR(proxy); e != nil && net.ParseIP(proxy) == nil {
+						err = fmt.Errorf("invalid trusted proxy : %s", proxy)
+					}
+				}
+				printResult(msg, err)
+			}
+		}
+		checkAddress(protocol, serverConfig.Ip, serverConfig.Port)
 		msg = fmt.Sprintf("checking port number : %d", serverConfig.Port)
 		if serverConfig.Port != 53 {
 			printWarning(msg, "using non-standard port")
@@ -210,24 +400,30 @@ func Verify(configFile string) {
 
 		address := serverConfig.Ip + ":" + strconv.Itoa(serverConfig.Port)
 		msg = fmt.Sprintf("checking whether %s://%s is available", serverConfig.Protocol, address)
-		if serverConfig.Protocol == "udp" {
+		if running.listening(serverConfig) {
+			// address is bound by running listener
+			err = nil
+		} else if protocol == "udp" {
 			var ln net.PacketConn
-			ln, err = net.ListenPacket(serverConfig.Protocol, address)
+			ln, err = net.ListenPacket(protocol, address)
 			if err == nil {
 				_ = ln.Close()
 			}
 		} else {
 			var ln net.Listener
-			ln, err = net.Listen(serverConfig.Protocol, address)
+			ln, err = net.Listen(protocol, address)
 			if err == nil {
 				_ = ln.Close()
 			}
 		}
 		printResult(msg, err)
 	}
-	fmt.Println("checking upstreams...")
+	printSection("checking upstreams...")
 	for _, upstreamConfig := range config.Handler.Upstream {
 		checkAddress(upstreamConfig.Protocol, upstreamConfig.Ip, upstreamConfig.Port)
+		if running != nil {
+			continue
+		}
 		address := upstreamConfig.Ip + ":" + strconv.Itoa(upstreamConfig.Port)
 		msg = fmt.Sprintf("checking whether %s://%s is available", upstreamConfig.Protocol, address)
 		client := &dns.Client{
@@ -252,10 +448,40 @@ func Verify(configFile string) {
 		}
 		printResult(msg, err)
 	}
-	checkRedis(&config.RedisData.Redis)
-	checkRedis(&config.RedisStat.Redis)
+	if running == nil || !reflect.DeepEqual(config.RedisData.Redis, running.RedisData.Redis) {
+		checkRedis(&config.RedisData.Redis)
+	}
+	if running == nil || !reflect.DeepEqual(config.RedisStat.Redis, running.RedisStat.Redis) {
+		checkRedis(&config.RedisStat.Redis)
+	}
+	if len(config.Handler.Tsig.Keys) > 0 {
+		printSection("checking tsig keys...")
+		for _, key := range config.Handler.Tsig.Keys {
+			msg = fmt.Sprintf("checking tsig key : %s", key.Name)
+			printResult(msg, key.Verify())
+		}
+	}
+	if config.Handler.Cookie.Enable {
+		printSection("checking cookies...")
+		printResult("checking cookie secret", config.Handler.Cookie.Verify())
+	}
+
+	if config.Admin.Enable {
+		printSection("checking admin api...")
+		printResult("checking admin api token", config.Admin.Verify())
+	}
+
+	if config.Rollover.Enable {
+		printSection("checking rollover...")
+		printResult("checking rollover config", config.Rollover.Verify())
+	}
+
+	if config.Dnstap.Enable {
+		printSection("checking dnstap...")
+		printResult(fmt.Sprintf("checking dnstap output : %s %s", config.Dnstap.Target, config.Dnstap.Address), config.Dnstap.Verify())
+	}
 	if config.Handler.GeoIp.Enable {
-		fmt.Println("checking geoip...")
+		printSection("checking geoip...")
 		var countryRecord struct {
 			Location struct {
 				Latitude        float64 `maxminddb:"latitude"`
@@ -286,4 +512,6 @@ func Verify(configFile string) {
 			}
 		}
 	}
+
+	return ok
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hawell/z42/internal/dnssec"
+	"github.com/hawell/z42/internal/storage"
+	"github.com/miekg/dns"
+)
+
+// Keygen generates a zsk/ksk pair for a zone, stores them in redis and prints DS records of ksk for parent zone
+func Keygen(args []string) {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	configPtr := flags.String("c", "config.json", "path to config file")
+	zonePtr := flags.String("zone", "", "zone name")
+	algorithmPtr := flags.String("algorithm", "ED25519", "key algorithm")
+	ttlPtr := flags.Uint("ttl", 3600, "dnskey ttl")
+	forcePtr := flags.Bool("f", false, "overwrite existing keys")
+	_ = flags.Parse(args)
+
+	if *zonePtr == "" {
+		log.Println("[ERROR] zone name is required")
+		flags.Usage()
+		return
+	}
+	zone := dns.Fqdn(strings.ToLower(*zonePtr))
+	algorithm, ok := dns.StringToAlgorithm[strings.ToUpper(*algorithmPtr)]
+	if !ok {
+		log.Printf("[ERROR] invalid algorithm : %s", *algorithmPtr)
+		return
+	}
+	if !dnssec.SupportedAlgorithm(algorithm) {
+		log.Printf("[ERROR] %s : %s", *algorithmPtr, dnssec.ErrUnsupportedAlgorithm)
+		return
+	}
+
+	cfg, err := LoadConfig(*configPtr)
+	if err != nil {
+		return
+	}
+	dh := storage.NewDataHandler(&cfg.RedisData)
+	defer dh.ShutDown()
+
+	if managed, err := dh.GetZoneKeys(zone); err == nil && len(managed) > 0 {
+		log.Printf("[ERROR] keys of %s are managed by rollover", zone)
+		return
+	}
+	if !*forcePtr {
+		if pub, _, err := dh.GetZoneKey(zone, "ksk"); err == nil && pub != "" {
+			log.Printf("[ERROR] %s already has keys, use -f to overwrite", zone)
+			return
+		}
+	}
+
+	var ksk string
+	for _, keyType := range []string{"zsk", "ksk"} {
+		pub, priv, err := dnssec.GenerateKey(zone, keyType, algorithm, uint32(*ttlPtr))
+		if err != nil {
+			log.Printf("[ERROR] cannot generate %s : %s", keyType, err)
+			return
+		}
+		if err := dh.SetZoneKey(zone, keyType, pub, priv); err != nil {
+			log.Printf("[ERROR] cannot store %s : %s", keyType, err)
+			return
+		}
+		fmt.Println(pub)
+		ksk = pub
+	}
+
+	rr, err := dns.NewRR(ksk)
+	if err != nil {
+		log.Printf("[ERROR] invalid ksk : %s", err)
+		return
+	}
+	fmt.Println("DS records for parent zone:")
+	for _, digest := range []uint8{dns.SHA256, dns.SHA384} {
+		if ds := rr.(*dns.DNSKEY).ToDS(digest); ds != nil {
+			fmt.Println(ds.String())
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"reflect"
+
+	"github.com/hawell/z42/internal/dnstap"
+	"github.com/hawell/z42/internal/handler"
+	"github.com/hawell/z42/internal/notify"
+	"github.com/hawell/z42/internal/rollover"
+	"github.com/hawell/z42/internal/secondary"
+	"github.com/hawell/z42/internal/server"
+	"github.com/hawell/z42/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Reload applies changes of config file to running resolver without interrupting unchanged listeners, running config is kept if new config is not valid
+func Reload() {
+	eventLogger.Info("reloading config", zap.String("config", configFile))
+	cfg, err := LoadConfig(configFile)
+	if err != nil {
+		eventLogger.Error("cannot load config, keeping running config", zap.Error(err))
+		return
+	}
+
+	// runningConfig is only replaced by Reload, which runs on signal handling goroutine
+	old := runningConfig
+	valid := verifyConfig(cfg, old, func(string) {}, func(msg string, err error) {
+		if err != nil {
+			eventLogger.Error("config verification failed", zap.String("check", msg), zap.Error(err))
+		}
+	}, func(msg string, warning string) {
+		eventLogger.Warn("config verification warning", zap.String("check", msg), zap.String("warning", warning))
+	})
+	if !valid {
+		eventLogger.Error("invalid config, keeping running config")
+		return
+	}
+
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	// replaced components are shut down after new ones are in place
+	var stale []func()
+
+	dataHandler := redisDataHandler
+	redisChanged := !reflect.DeepEqual(cfg.RedisData, old.RedisData)
+	if redisChanged {
+		eventLogger.Info("redis data config changed, caches are dropped")
+		dataHandler = storage.NewDataHandler(&cfg.RedisData)
+		dataHandler.OnTsigUpdate(reloadTsig)
+	}
+	if !reflect.DeepEqual(cfg.RedisStat, old.RedisStat) {
+		stat := redisStatHandler
+		redisStatHandler = storage.NewStatHandler(&cfg.RedisStat)
+		stale = append(stale, stat.ShutDown)
+	}
+
+	// handler keeps rrl, cookie and signature cache state, it is replaced only if its config or data source has changed
+	h := dnsRequestHandler.Load()
+	if redisChanged || !reflect.DeepEqual(cfg.Handler, old.Handler) {
+		h = handler.NewHandler(&cfg.Handler, dataHandler, requestLogger)
+		stale = append(stale, dnsRequestHandler.Swap(h).ShutDown)
+	} else {
+		// redis keys may have changed without a keyspace notification
+		h.Keyring.Reload()
+	}
+	// tsig keys are replaced in running listeners
+	tsigSecrets.Set(h.Keyring.Secrets())
+
+	if redisChanged || !reflect.DeepEqual(cfg.RateLimit, old.RateLimit) {
+		stale = append(stale, rateLimiter.Swap(newRateLimiter(&cfg.RateLimit, dataHandler)).ShutDown)
+	}
+	if redisChanged || !reflect.DeepEqual(cfg.Notify, old.Notify) {
+		stale = append(stale, notifier.ShutDown)
+		notifier = notify.NewNotifier(&cfg.Notify, dataHandler)
+	}
+	if redisChanged || !reflect.DeepEqual(cfg.Rollover, old.Rollover) {
+		stale = append(stale, keyRollover.ShutDown)
+		keyRollover = rollover.NewRollover(&cfg.Rollover, dataHandler)
+	}
+	if redisChanged || !reflect.DeepEqual(cfg.Secondary, old.Secondary) {
+		stale = append(stale, secondaryZones.Swap(secondary.NewSecondary(&cfg.Secondary, dataHandler, currentKeyring)).ShutDown)
+	}
+	if !reflect.DeepEqual(cfg.Dnstap, old.Dnstap) {
+		stale = append(stale, dnsTap.Swap(dnstap.NewTap(&cfg.Dnstap)).ShutDown)
+	}
+
+	// http servers are restarted synchronously so new ones can bind to the same address
+	if !reflect.DeepEqual(cfg.Metrics, old.Metrics) {
+		_ = metricsServer.Shutdown()
+		metricsServer = startMetrics(&cfg.Metrics)
+	}
+	if !reflect.DeepEqual(cfg.Admin, old.Admin) {
+		_ = adminServer.Shutdown()
+		adminServer = startAdmin(&cfg.Admin)
+	}
+
+	reloadListeners(cfg.Server)
+
+	if redisChanged {
+		stale = append(stale, redisDataHandler.ShutDown)
+		redisDataHandler = dataHandler
+	}
+	runningConfig = cfg
+
+	for _, shutDown := range stale {
+		shutDown()
+	}
+	eventLogger.Info("config reloaded")
+}
+
+// reloadTsig reloads tsig keys of running handler after keys stored in redis are modified, revoked keys are rejected by running listeners.
+// a handler replaced meanwhile has loaded its own keys and is retried so listeners don't end up with keys of a stale handler
+func reloadTsig() {
+	for {
+		keyring := currentKeyring()
+		keyring.Reload()
+		tsigSecrets.Set(keyring.Secrets())
+		if currentKeyring() == keyring {
+			return
+		}
+	}
+}
+
+// reloadListeners keeps listeners whose config has not changed
+func reloadListeners(config []server.ServerConfig) {
+	matched := make([]bool, len(config))
+	var running []*server.Listener
+	for _, l := range listeners {
+		kept := false
+		for i := range config {
+			if !matched[i] && reflect.DeepEqual(config[i], l.Config) {
+				matched[i], kept = true, true
+				break
+			}
+		}
+		if kept {
+			running = append(running, l)
+		} else {
+			eventLogger.Info("removing listener", zap.String("ip", l.Config.Ip), zap.Int("port", l.Config.Port), zap.String("protocol", l.Config.Protocol))
+			l.Shutdown()
+		}
+	}
+	for i := range config {
+		if matched[i] {
+			continue
+		}
+		eventLogger.Info("adding listener", zap.String("ip", config[i].Ip), zap.Int("port", config[i].Port), zap.String("protocol", config[i].Protocol))
+		l := server.NewListener(config[i], tsigSecrets)
+		l.Start()
+		running = append(running, l)
+	}
+	listeners = running
+}
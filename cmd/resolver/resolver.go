@@ -2,36 +2,60 @@ package main
 
 import (
 	"flag"
+	"github.com/hawell/z42/internal/admin"
+	"github.com/hawell/z42/internal/dnssec"
+	"github.com/hawell/z42/internal/dnstap"
 	"github.com/hawell/z42/internal/handler"
+	"github.com/hawell/z42/internal/metrics"
+	"github.com/hawell/z42/internal/notify"
+	"github.com/hawell/z42/internal/rollover"
+	"github.com/hawell/z42/internal/secondary"
 	"github.com/hawell/z42/internal/server"
 	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/internal/tsig"
 	"github.com/hawell/z42/pkg/ratelimit"
 	"github.com/json-iterator/go"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/miekg/dns"
-	_ "net/http/pprof"
 )
 
 var (
-	servers           []*dns.Server
+	// components used by request handlers are swapped atomically on reload, others are protected by reloadLock
+	dnsRequestHandler atomic.Pointer[handler.DnsRequestHandler]
+	rateLimiter       atomic.Pointer[ratelimit.RateLimiter]
+	dnsTap            atomic.Pointer[dnstap.Tap]
+	secondaryZones    atomic.Pointer[secondary.Secondary]
+	reloadLock        sync.RWMutex
+	listeners         []*server.Listener
+	tsigSecrets       *server.Secrets
 	redisDataHandler  *storage.DataHandler
 	redisStatHandler  *storage.StatHandler
-	dnsRequestHandler *handler.DnsRequestHandler
-	rateLimiter       *ratelimit.RateLimiter
+	notifier          *notify.Notifier
+	keyRollover       *rollover.Rollover
+	metricsServer     *metrics.Server
+	adminServer       *admin.Server
+	runningConfig     *Config
+	logLevel          zap.AtomicLevel
 	configFile        string
 	requestLogger     *zap.Logger
 	eventLogger       *zap.Logger
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		Keygen(os.Args[2:])
+		return
+	}
+
 	configPtr := flag.String("c", "config.json", "path to config file")
 	verifyPtr := flag.Bool("t", false, "verify configuration")
 	generateConfigPtr := flag.String("g", "template-config.json", "generate template config file")
@@ -60,11 +84,6 @@ func main() {
 
 	Start()
 
-	// TODO: this should be part of a general api
-	go func() {
-		log.Println(http.ListenAndServe("localhost:6060", nil))
-	}()
-
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGHUP)
 
@@ -74,13 +93,13 @@ func main() {
 			Stop()
 			return
 		case syscall.SIGHUP:
-			Stop()
-			Start()
+			Reload()
 		}
 	}
 }
 
 func handleRequest(w dns.ResponseWriter, r *dns.Msg) {
+	w = dnsTap.Load().Wrap(w, r)
 	context := handler.NewRequestContext(w, r)
 	zap.L().Debug(
 		"handle request",
@@ -89,14 +108,49 @@ func handleRequest(w dns.ResponseWriter, r *dns.Msg) {
 		zap.String("type", context.Type()),
 	)
 
-	if rateLimiter.CanHandle(context.IP()) {
-		dnsRequestHandler.HandleRequest(context)
+	if r.Opcode == dns.OpcodeNotify {
+		handleNotify(context)
+		return
+	}
+
+	h := dnsRequestHandler.Load()
+	validCookie := h.CheckCookie(context)
+	if context.Res != dns.RcodeSuccess {
+		context.Response()
+		return
+	}
+
+	// clients with a valid server cookie cannot be spoofed
+	if validCookie || rateLimiter.Load().CanHandle(context.IP()) {
+		h.HandleRequest(context)
 	} else {
+		metrics.RateLimited.WithLabelValues("ratelimit", "refused").Inc()
 		context.Res = dns.RcodeRefused
 		context.Response()
 	}
 }
 
+// currentKeyring returns keyring of the running handler, it changes when handler is replaced on reload
+func currentKeyring() *tsig.Keyring {
+	return dnsRequestHandler.Load().Keyring
+}
+
+func handleNotify(context *handler.RequestContext) {
+	zone := dns.Fqdn(context.RawName())
+	if context.Req.IsTsig() != nil {
+		if err := currentKeyring().Authorize(context.Req, context.W.TsigStatus(), zone, tsig.OperationNotify); err != nil {
+			zap.L().Error("notify not authorized", zap.String("zone", zone), zap.String("source", context.IP()), zap.Error(err))
+			context.Res = tsig.Rcode(err)
+		} else if !secondaryZones.Load().Refresh(zone) {
+			context.Res = dns.RcodeRefused
+		}
+	} else if !secondaryZones.Load().Notify(zone, context.IP()) {
+		zap.L().Error("notify refused", zap.String("zone", zone), zap.String("source", context.IP()))
+		context.Res = dns.RcodeRefused
+	}
+	context.Response()
+}
+
 func Start() {
 	log.Printf("[INFO] loading config : %s", configFile)
 	cfg, err := LoadConfig(configFile)
@@ -104,7 +158,10 @@ func Start() {
 		panic(err)
 	}
 
+	runningConfig = cfg
+
 	log.Printf("[INFO] loading logger...")
+	logLevel = zap.NewAtomicLevelAt(zap.ErrorLevel)
 	requestLoggerConfig := zap.Config{
 		Level:       zap.NewAtomicLevelAt(zap.InfoLevel),
 		Development: false,
@@ -127,7 +184,7 @@ func Start() {
 		panic(err)
 	}
 	eventLoggerConfig := zap.Config{
-		Level:       zap.NewAtomicLevelAt(zap.ErrorLevel),
+		Level:       logLevel,
 		Development: false,
 		Encoding:    "json",
 		EncoderConfig: zapcore.EncoderConfig{
@@ -153,38 +210,107 @@ func Start() {
 	zap.ReplaceGlobals(eventLogger)
 	log.Printf("[INFO] logger loaded")
 
-	servers = server.NewServer(cfg.Server)
-
 	redisDataHandler = storage.NewDataHandler(&cfg.RedisData)
 	redisStatHandler = storage.NewStatHandler(&cfg.RedisStat)
 
 	eventLogger.Info("starting handler...")
-	dnsRequestHandler = handler.NewHandler(&cfg.Handler, redisDataHandler, requestLogger)
+	h := handler.NewHandler(&cfg.Handler, redisDataHandler, requestLogger)
+	dnsRequestHandler.Store(h)
 	eventLogger.Info("handler started")
 
-	rateLimiter = ratelimit.NewRateLimiter(&cfg.RateLimit)
+	tsigSecrets = server.NewSecrets(h.Keyring.Secrets())
+	redisDataHandler.OnTsigUpdate(reloadTsig)
+	listeners = server.NewListeners(cfg.Server, tsigSecrets)
+
+	rateLimiter.Store(newRateLimiter(&cfg.RateLimit, redisDataHandler))
+
+	notifier = notify.NewNotifier(&cfg.Notify, redisDataHandler)
+	keyRollover = rollover.NewRollover(&cfg.Rollover, redisDataHandler)
+	secondaryZones.Store(secondary.NewSecondary(&cfg.Secondary, redisDataHandler, currentKeyring))
+
+	dnsTap.Store(dnstap.NewTap(&cfg.Dnstap))
 
 	dns.HandleFunc(".", handleRequest)
 
+	metricsServer = startMetrics(&cfg.Metrics)
+	adminServer = startAdmin(&cfg.Admin)
+
 	eventLogger.Info("binding listeners...")
-	for i := range servers {
-		go func(i int) {
-			err := servers[i].ListenAndServe()
-			if err != nil {
-				eventLogger.Error("listener error : %s", zap.Error(err))
-			}
-		}(i)
+	for _, l := range listeners {
+		l.Start()
 	}
 	eventLogger.Info("binding completed")
 }
 
 func Stop() {
-	for i := range servers {
-		_ = servers[i].Shutdown()
+	for _, l := range listeners {
+		l.Shutdown()
 	}
-	dnsRequestHandler.ShutDown()
+	_ = adminServer.Shutdown()
+	_ = metricsServer.Shutdown()
+	dnsTap.Load().ShutDown()
+	dnsRequestHandler.Load().ShutDown()
+	rateLimiter.Load().ShutDown()
+	notifier.ShutDown()
+	keyRollover.ShutDown()
+	secondaryZones.Load().ShutDown()
 	redisDataHandler.ShutDown()
 	redisStatHandler.ShutDown()
 	requestLogger.Sync()
 	eventLogger.Sync()
 }
+
+func newRateLimiter(config *ratelimit.Config, redisData *storage.DataHandler) *ratelimit.RateLimiter {
+	rl := ratelimit.NewRateLimiter(config)
+	rl.StartReload(redisData.GetRateLimitLists)
+	return rl
+}
+
+func startMetrics(config *metrics.Config) *metrics.Server {
+	s := metrics.NewServer(config)
+	go func() {
+		if err := s.ListenAndServe(); err != nil {
+			eventLogger.Error("metrics server error", zap.Error(err))
+		}
+	}()
+	return s
+}
+
+func startAdmin(config *admin.Config) *admin.Server {
+	s := admin.NewServer(config, adminResolver{}, logLevel)
+	go func() {
+		if err := s.ListenAndServe(); err != nil {
+			eventLogger.Error("admin api error", zap.Error(err))
+		}
+	}()
+	return s
+}
+
+// adminResolver gives admin api access to running components
+type adminResolver struct{}
+
+func (adminResolver) DataHandler() *storage.DataHandler {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return redisDataHandler
+}
+
+func (adminResolver) Signatures() *dnssec.SignatureCache {
+	return dnsRequestHandler.Load().Signatures
+}
+
+func (adminResolver) Listeners() []server.ListenerStatus {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	status := make([]server.ListenerStatus, 0, len(listeners))
+	for _, l := range listeners {
+		status = append(status, l.Status())
+	}
+	return status
+}
+
+func (adminResolver) EffectiveConfig() interface{} {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return runningConfig.Redacted()
+}
@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+
+	"github.com/hawell/z42/internal/dnssec"
+	"github.com/hawell/z42/internal/server"
+	"github.com/hawell/z42/internal/storage"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	Enable bool   `json:"enable"`
+	Ip     string `json:"ip"`
+	Port   int    `json:"port"`
+	Token  string `json:"token"`
+}
+
+var ErrNoToken = errors.New("admin api token is empty")
+
+// Verify checks api is not exposed without authentication
+func (config *Config) Verify() error {
+	if config.Token == "" {
+		return ErrNoToken
+	}
+	return nil
+}
+
+// Resolver gives access to running components, they may be replaced while api is running
+type Resolver interface {
+	DataHandler() *storage.DataHandler
+	Signatures() *dnssec.SignatureCache
+	Listeners() []server.ListenerStatus
+	EffectiveConfig() interface{}
+}
+
+// Server serves admin api over http, all requests must have an "Authorization: Bearer <token>" header
+type Server struct {
+	config   *Config
+	resolver Resolver
+	level    zap.AtomicLevel
+	server   *http.Server
+}
+
+// NewServer returns nil if admin api is disabled or has no token
+func NewServer(config *Config, resolver Resolver, level zap.AtomicLevel) *Server {
+	if !config.Enable {
+		return nil
+	}
+	if err := config.Verify(); err != nil {
+		zap.L().Error("admin api disabled", zap.Error(err))
+		return nil
+	}
+	s := &Server{
+		config:   config,
+		resolver: resolver,
+		level:    level,
+	}
+	s.server = &http.Server{
+		Addr:    net.JoinHostPort(config.Ip, strconv.Itoa(config.Port)),
+		Handler: s.Handler(),
+	}
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /zones", s.zones)
+	mux.HandleFunc("POST /zones/reload", s.reloadZones)
+	mux.HandleFunc("POST /zones/{zone}/ds/confirm", s.confirmDS)
+	mux.HandleFunc("GET /cache", s.cacheStats)
+	mux.HandleFunc("POST /cache/flush", s.flush)
+	mux.HandleFunc("POST /cache/flush/{zone}", s.flush)
+	mux.HandleFunc("GET /listeners", s.listeners)
+	mux.HandleFunc("GET /config", s.effectiveConfig)
+	mux.Handle("/log/level", s.level)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return s.authenticate(mux)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) != 1 {
+			zap.L().Error("admin api unauthorized request", zap.String("source", r.RemoteAddr), zap.String("path", r.URL.Path))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := jsoniter.NewEncoder(w).Encode(v); err != nil {
+		zap.L().Error("cannot write admin api response", zap.Error(err))
+	}
+}
+
+func (s *Server) zones(w http.ResponseWriter, _ *http.Request) {
+	zones := s.resolver.DataHandler().LoadedZones()
+	if zones == nil {
+		zones = []string{}
+	}
+	writeJson(w, map[string][]string{"zones": zones})
+}
+
+func (s *Server) reloadZones(w http.ResponseWriter, _ *http.Request) {
+	dh := s.resolver.DataHandler()
+	dh.LoadZones()
+	zap.L().Info("zones reloaded by admin api")
+	writeJson(w, map[string]int{"zones": len(dh.LoadedZones())})
+}
+
+// confirmDS lets rollover retire old ksk of zone after DS records of its successor are added to parent
+func (s *Server) confirmDS(w http.ResponseWriter, r *http.Request) {
+	zone := dns.Fqdn(strings.ToLower(r.PathValue("zone")))
+	if _, ok := dns.IsDomainName(zone); !ok {
+		http.Error(w, "invalid zone", http.StatusBadRequest)
+		return
+	}
+	confirmed, err := s.resolver.DataHandler().ConfirmDS(zone)
+	if err != nil {
+		zap.L().Error("cannot confirm ds", zap.String("zone", zone), zap.Error(err))
+		http.Error(w, "cannot confirm ds", http.StatusInternalServerError)
+		return
+	}
+	zap.L().Info("ds confirmed by admin api", zap.String("zone", zone), zap.Strings("keys", confirmed))
+	writeJson(w, map[string][]string{"confirmed": confirmed})
+}
+
+func (s *Server) cacheStats(w http.ResponseWriter, _ *http.Request) {
+	stats := s.resolver.DataHandler().CacheStats()
+	if signatures := s.resolver.Signatures(); signatures != nil {
+		hits, misses := signatures.Hits(), signatures.Misses()
+		signatureStats := storage.CacheStats{Hits: hits, Misses: misses}
+		if hits+misses > 0 {
+			signatureStats.Ratio = float64(hits) / float64(hits+misses)
+		}
+		stats["signature"] = signatureStats
+	}
+	writeJson(w, stats)
+}
+
+// flush removes a single zone from caches if zone is set in path, otherwise all zones
+func (s *Server) flush(w http.ResponseWriter, r *http.Request) {
+	zone := r.PathValue("zone")
+	if zone == "" {
+		s.resolver.DataHandler().FlushAll()
+		zap.L().Info("caches flushed by admin api")
+		writeJson(w, map[string]string{"flushed": "*"})
+		return
+	}
+	zone = dns.Fqdn(strings.ToLower(zone))
+	if _, ok := dns.IsDomainName(zone); !ok {
+		http.Error(w, "invalid zone", http.StatusBadRequest)
+		return
+	}
+	s.resolver.DataHandler().FlushZone(zone)
+	zap.L().Info("zone flushed by admin api", zap.String("zone", zone))
+	writeJson(w, map[string]string{"flushed": zone})
+}
+
+func (s *Server) listeners(w http.ResponseWriter, _ *http.Request) {
+	writeJson(w, map[string][]server.ListenerStatus{"listeners": s.resolver.Listeners()})
+}
+
+func (s *Server) effectiveConfig(w http.ResponseWriter, _ *http.Request) {
+	writeJson(w, s.resolver.EffectiveConfig())
+}
+
+func (s *Server) ListenAndServe() error {
+	if s == nil {
+		return nil
+	}
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Shutdown() error {
+	if s == nil {
+		return nil
+	}
+	return s.server.Shutdown(context.Background())
+}
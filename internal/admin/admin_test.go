@@ -0,0 +1,136 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hawell/z42/internal/dnssec"
+	"github.com/hawell/z42/internal/server"
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/pkg/hiredis"
+	jsoniter "github.com/json-iterator/go"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var dataHandlerConfig = storage.DataHandlerConfig{
+	ZoneCacheSize:      10000,
+	ZoneCacheTimeout:   60,
+	ZoneReload:         1,
+	RecordCacheSize:    1000000,
+	RecordCacheTimeout: 60,
+	MinTTL:             5,
+	MaxTTL:             300,
+	Redis: hiredis.Config{
+		Suffix:  "_admintest",
+		Prefix:  "admintest_",
+		Address: "redis:6379",
+		Net:     "tcp",
+		DB:      0,
+		Connection: hiredis.ConnectionConfig{
+			MaxIdleConnections:   10,
+			MaxActiveConnections: 10,
+			ConnectTimeout:       600,
+			ReadTimeout:          600,
+			IdleKeepAlive:        6000,
+			MaxKeepAlive:         6000,
+			WaitForConnection:    true,
+		},
+	},
+}
+
+type testResolver struct {
+	dh         *storage.DataHandler
+	signatures *dnssec.SignatureCache
+}
+
+func (r *testResolver) DataHandler() *storage.DataHandler {
+	return r.dh
+}
+
+func (r *testResolver) Signatures() *dnssec.SignatureCache {
+	return r.signatures
+}
+
+func (r *testResolver) Listeners() []server.ListenerStatus {
+	return []server.ListenerStatus{{Address: "127.0.0.1:1053", Protocol: "udp", Servers: 1, Running: 1}}
+}
+
+func (r *testResolver) EffectiveConfig() interface{} {
+	return map[string]string{"token": "<redacted>"}
+}
+
+func TestAdmin(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(NewServer(&Config{Enable: false}, nil, zap.NewAtomicLevel())).To(BeNil())
+	g.Expect(NewServer(&Config{Enable: true}, nil, zap.NewAtomicLevel())).To(BeNil())
+
+	dh := storage.NewDataHandler(&dataHandlerConfig)
+	defer dh.ShutDown()
+	g.Expect(dh.Clear()).To(BeNil())
+	dh.LoadZones()
+	level := zap.NewAtomicLevelAt(zap.ErrorLevel)
+	s := NewServer(&Config{Enable: true, Ip: "127.0.0.1", Port: 6060, Token: "secret"}, &testResolver{dh: dh, signatures: dnssec.NewSignatureCache(&dnssec.SignatureCacheConfig{Size: 100, Refresh: 60})}, level)
+	g.Expect(s).NotTo(BeNil())
+	handler := s.Handler()
+
+	do := func(method string, path string, token string, body string) (int, map[string]interface{}) {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		var res map[string]interface{}
+		_ = jsoniter.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+
+	code, _ := do("GET", "/zones", "", "")
+	g.Expect(code).To(Equal(http.StatusUnauthorized))
+	code, _ = do("GET", "/debug/pprof/", "wrong", "")
+	g.Expect(code).To(Equal(http.StatusUnauthorized))
+	code, _ = do("GET", "/debug/pprof/", "secret", "")
+	g.Expect(code).To(Equal(http.StatusOK))
+
+	code, res := do("GET", "/zones", "secret", "")
+	g.Expect(code).To(Equal(http.StatusOK))
+	g.Expect(res["zones"]).To(BeEmpty())
+	g.Expect(dh.EnableZone("example.com.")).To(BeNil())
+	code, res = do("POST", "/zones/reload", "secret", "")
+	g.Expect(code).To(Equal(http.StatusOK))
+	g.Expect(res["zones"]).To(BeNumerically("==", 1))
+	_, res = do("GET", "/zones", "secret", "")
+	g.Expect(res["zones"]).To(Equal([]interface{}{"example.com."}))
+
+	code, res = do("POST", "/zones/example.com./ds/confirm", "secret", "")
+	g.Expect(code).To(Equal(http.StatusOK))
+	g.Expect(res["confirmed"]).To(BeEmpty())
+
+	code, res = do("POST", "/cache/flush/Example.com", "secret", "")
+	g.Expect(code).To(Equal(http.StatusOK))
+	g.Expect(res["flushed"]).To(Equal("example.com."))
+	code, res = do("POST", "/cache/flush", "secret", "")
+	g.Expect(code).To(Equal(http.StatusOK))
+	g.Expect(res["flushed"]).To(Equal("*"))
+	code, _ = do("GET", "/cache/flush", "secret", "")
+	g.Expect(code).To(Equal(http.StatusMethodNotAllowed))
+	code, res = do("GET", "/cache", "secret", "")
+	g.Expect(code).To(Equal(http.StatusOK))
+	g.Expect(res).To(HaveKey("zone"))
+	g.Expect(res).To(HaveKey("record"))
+	g.Expect(res).To(HaveKey("signature"))
+
+	_, res = do("GET", "/listeners", "secret", "")
+	g.Expect(res["listeners"]).To(HaveLen(1))
+	_, res = do("GET", "/config", "secret", "")
+	g.Expect(res["token"]).To(Equal("<redacted>"))
+
+	code, _ = do("PUT", "/log/level", "secret", `{"level":"debug"}`)
+	g.Expect(code).To(Equal(http.StatusOK))
+	g.Expect(level.Level()).To(Equal(zap.DebugLevel))
+	_, res = do("GET", "/log/level", "secret", "")
+	g.Expect(res["level"]).To(Equal("debug"))
+}
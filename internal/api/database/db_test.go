@@ -438,13 +438,22 @@ func TestAddRecordSet(t *testing.T) {
 		"aname",
 		"caa",
 		"cname",
+		"dname",
 		"ds",
+		"hinfo",
+		"https",
 		"mx",
+		"naptr",
 		"ns",
+		"openpgpkey",
 		"ptr",
+		"smimea",
 		"srv",
+		"sshfp",
+		"svcb",
 		"tlsa",
 		"txt",
+		"uri",
 	}
 	rrValues := []string{
 		`{"ttl": 300, "records": [{"ip": "1.2.3.4"}]}`,
@@ -452,13 +461,22 @@ func TestAddRecordSet(t *testing.T) {
 		`{"location": "aname.example.com."}`,
 		`{"ttl": 300, "records": [{"tag": "issue", "flag": 0, "value": "godaddy.com;"}]}`,
 		`{"ttl": 300, "host": "x.example.com."}`,
+		`{"ttl": 300, "target": "example.net."}`,
 		`{"ttl": 300, "records": [{"digest": "B6DCD485719ADCA18E5F3D48A2331627FDD3636B", "key_tag": 57855, "algorithm": 5, "digest_type": 1}]}`,
+		`{"ttl": 300, "records": [{"cpu": "x86", "os": "linux"}]}`,
+		`{"ttl": 300, "records": [{"priority": 1, "target": ".", "alpn": ["h2", "h3"]}]}`,
 		`{"ttl": 300, "records": [{"host": "mx1.example.com.", "preference": 10}, {"host": "mx2.example.com.", "preference": 10}]}`,
+		`{"ttl": 300, "records": [{"order": 100, "preference": 10, "flags": "S", "service": "SIP+D2U", "regexp": "", "replacement": "_sip._udp.example.com."}]}`,
 		`{"ttl": 300, "records": [{"host": "ns1.example.com."}, {"host": "ns2.example.com."}]}`,
+		`{"ttl": 300, "records": [{"public_key": "mQINBFit2jsBEADrbl5vjVxYeAE0g0IDYCBpHirv1Sjlqxx5gjtPhb2YhvyDMXjq"}]}`,
 		`{"ttl": 300, "domain": "localhost"}`,
+		`{"ttl": 300, "records": [{"usage": 3, "selector": 1, "certificate": "d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971", "matching_type": 1}]}`,
 		`{"ttl": 300, "records": [{"port": 555, "target": "sip.example.com.", "weight": 100, "priority": 10}]}`,
+		`{"ttl": 300, "records": [{"algorithm": 4, "type": 2, "fingerprint": "123456789abcdef67890123456789abcdef67890123456789abcdef123456789"}]}`,
+		`{"ttl": 300, "records": [{"priority": 1, "target": "svc.example.com.", "port": 8443}]}`,
 		`{"ttl": 300, "records": [{"usage": 0, "selector": 0, "certificate": "d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971", "matching_type": 1}]}`,
 		`{"ttl": 300, "records": [{"text": "foo"}, {"text": "bar"}]}`,
+		`{"ttl": 300, "records": [{"priority": 10, "weight": 1, "target": "ftp://ftp1.example.com/public"}]}`,
 	}
 	_, err = db.AddLocation("user1", "example.com.", Location{Name: "a", Enabled: true})
 	Expect(err).To(BeNil())
@@ -468,7 +486,7 @@ func TestAddRecordSet(t *testing.T) {
 	}
 	sets, err := db.GetRecordSets("user1", "example.com.", "a")
 	Expect(err).To(BeNil())
-	Expect(len(sets)).To(Equal(12))
+	Expect(len(sets)).To(Equal(21))
 	Expect(sets).To(ConsistOf(rrKeys))
 }
 
@@ -48,4 +48,4 @@ type RecordSet struct {
 	Enabled bool
 }
 
-var SupportedTypes = []string{"a", "aaaa", "cname", "txt", "ns", "mx", "srv", "caa", "ptr", "tlsa", "ds", "aname"}
+var SupportedTypes = []string{"a", "aaaa", "cname", "txt", "ns", "mx", "srv", "caa", "ptr", "tlsa", "ds", "sshfp", "naptr", "uri", "hinfo", "smimea", "openpgpkey", "svcb", "https", "dname", "aname"}
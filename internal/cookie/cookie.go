@@ -0,0 +1,244 @@
+package cookie
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dchest/siphash"
+	"github.com/hawell/z42/internal/storage"
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	Enable         bool   `json:"enable"`
+	Secret         string `json:"secret"`
+	SecretLifetime int    `json:"secret_lifetime"`
+	BadCookie      bool   `json:"bad_cookie"`
+}
+
+// Verify checks static secret
+func (config *Config) Verify() error {
+	if config.Secret == "" {
+		return nil
+	}
+	if secret, err := hex.DecodeString(config.Secret); err != nil || len(secret) != secretLength {
+		return ErrInvalidSecret
+	}
+	return nil
+}
+
+type Status int
+
+const (
+	// StatusNone means request has no cookie
+	StatusNone Status = iota
+	// StatusMalformed means cookie option has invalid length
+	StatusMalformed
+	// StatusClientOnly means request has a client cookie without a server cookie
+	StatusClientOnly
+	// StatusInvalid means server cookie is not valid for client cookie and address, or has expired
+	StatusInvalid
+	// StatusValid means server cookie was generated by this or another instance sharing secrets
+	StatusValid
+)
+
+// cookie lengths and timings from RFC 7873 and RFC 9018
+const (
+	clientCookieLength    = 8
+	serverCookieLength    = 16
+	minServerCookieLength = 8
+	maxServerCookieLength = 32
+	secretLength          = 16
+	cookieVersion         = 1
+	cookieLifetime        = time.Hour
+	cookieRefresh         = 30 * time.Minute
+	cookieClockSkew       = 5 * time.Minute
+
+	defaultSecretLifetime = 86400
+	secretCheckInterval   = time.Minute
+)
+
+var ErrInvalidSecret = errors.New("cookie secret must be 16 bytes hex encoded")
+
+// Cookies generates and validates server cookies (RFC 9018), secrets are rotated every period and shared between instances through redis
+type Cookies struct {
+	config    *Config
+	redisData *storage.DataHandler
+	lifetime  time.Duration
+	lock      sync.RWMutex
+	period    int64
+	secrets   [3][]byte // previous, current, next
+	quit      chan struct{}
+	quitWG    sync.WaitGroup
+}
+
+// NewCookies returns nil if cookies are disabled, a static secret from config disables rotation
+func NewCookies(config *Config, redisData *storage.DataHandler) *Cookies {
+	if !config.Enable {
+		return nil
+	}
+	c := &Cookies{
+		config:    config,
+		redisData: redisData,
+		lifetime:  time.Duration(config.SecretLifetime) * time.Second,
+		quit:      make(chan struct{}),
+	}
+	if c.lifetime <= 0 {
+		c.lifetime = defaultSecretLifetime * time.Second
+	}
+	if config.Secret != "" {
+		secret, _ := hex.DecodeString(config.Secret)
+		if err := config.Verify(); err != nil {
+			zap.L().Error("invalid cookie secret, using a random secret", zap.Error(err))
+			secret = randomSecret()
+		}
+		c.secrets = [3][]byte{secret, secret, secret}
+		return c
+	}
+	c.rotate(time.Now())
+	c.quitWG.Add(1)
+	go func() {
+		defer c.quitWG.Done()
+		ticker := time.NewTicker(secretCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.quit:
+				return
+			case now := <-ticker.C:
+				c.rotate(now)
+			}
+		}
+	}()
+	return c
+}
+
+func (c *Cookies) ShutDown() {
+	if c == nil {
+		return
+	}
+	close(c.quit)
+	c.quitWG.Wait()
+}
+
+// rotate loads secrets of previous, current and next periods so instances with slightly different clocks accept each other's cookies
+func (c *Cookies) rotate(now time.Time) {
+	period := now.UnixNano() / int64(c.lifetime)
+	c.lock.RLock()
+	current := c.period
+	c.lock.RUnlock()
+	if period == current {
+		return
+	}
+	var secrets [3][]byte
+	for i := range secrets {
+		secrets[i] = c.secret(period + int64(i) - 1)
+	}
+	c.lock.Lock()
+	c.period = period
+	c.secrets = secrets
+	c.lock.Unlock()
+}
+
+func (c *Cookies) secret(period int64) []byte {
+	secret := randomSecret()
+	if c.redisData == nil {
+		return secret
+	}
+	shared, err := c.redisData.CookieSecret(period, hex.EncodeToString(secret), 3*c.lifetime)
+	if err != nil {
+		zap.L().Error("cannot load cookie secret, using a local secret", zap.Int64("period", period), zap.Error(err))
+		return secret
+	}
+	if secret, err = hex.DecodeString(shared); err != nil || len(secret) != secretLength {
+		zap.L().Error("invalid shared cookie secret, using a local secret", zap.Int64("period", period))
+		return randomSecret()
+	}
+	return secret
+}
+
+func randomSecret() []byte {
+	secret := make([]byte, secretLength)
+	_, _ = rand.Read(secret)
+	return secret
+}
+
+// BadCookie reports whether requests without a valid server cookie are answered with BADCOOKIE
+func (c *Cookies) BadCookie() bool {
+	return c != nil && c.config.BadCookie
+}
+
+// Check validates cookie (client cookie followed by optional server cookie) of a request from clientIp, response is the cookie to send back
+func (c *Cookies) Check(cookie []byte, clientIp net.IP, now time.Time) (status Status, response []byte) {
+	if c == nil || cookie == nil {
+		return StatusNone, nil
+	}
+	if len(cookie) != clientCookieLength &&
+		(len(cookie) < clientCookieLength+minServerCookieLength || len(cookie) > clientCookieLength+maxServerCookieLength) {
+		return StatusMalformed, nil
+	}
+	clientCookie := cookie[:clientCookieLength]
+	if len(cookie) == clientCookieLength {
+		return StatusClientOnly, c.generate(clientCookie, clientIp, now)
+	}
+	serverCookie := cookie[clientCookieLength:]
+	if len(serverCookie) != serverCookieLength || serverCookie[0] != cookieVersion {
+		return StatusInvalid, c.generate(clientCookie, clientIp, now)
+	}
+
+	// timestamp is a serial number (RFC 1982), cookies from a few minutes in the future are accepted
+	issued := int32(binary.BigEndian.Uint32(serverCookie[4:8]))
+	age := time.Duration(int32(uint32(now.Unix())-uint32(issued))) * time.Second
+	if age > cookieLifetime || age < -cookieClockSkew {
+		return StatusInvalid, c.generate(clientCookie, clientIp, now)
+	}
+	c.lock.RLock()
+	secrets := c.secrets
+	c.lock.RUnlock()
+	valid := false
+	for _, secret := range secrets {
+		if subtle.ConstantTimeCompare(hash(secret, clientCookie, serverCookie[:8], clientIp), serverCookie[8:]) == 1 {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return StatusInvalid, c.generate(clientCookie, clientIp, now)
+	}
+	if age > cookieRefresh {
+		return StatusValid, c.generate(clientCookie, clientIp, now)
+	}
+	return StatusValid, cookie
+}
+
+// generate returns client cookie followed by a new server cookie: version, reserved, timestamp and hash
+func (c *Cookies) generate(clientCookie []byte, clientIp net.IP, now time.Time) []byte {
+	c.lock.RLock()
+	secret := c.secrets[1]
+	c.lock.RUnlock()
+	cookie := make([]byte, clientCookieLength+serverCookieLength)
+	copy(cookie, clientCookie)
+	serverCookie := cookie[clientCookieLength:]
+	serverCookie[0] = cookieVersion
+	binary.BigEndian.PutUint32(serverCookie[4:8], uint32(now.Unix()))
+	copy(serverCookie[8:], hash(secret, clientCookie, serverCookie[:8], clientIp))
+	return cookie
+}
+
+func hash(secret []byte, clientCookie []byte, header []byte, clientIp net.IP) []byte {
+	h := siphash.New(secret)
+	_, _ = h.Write(clientCookie)
+	_, _ = h.Write(header)
+	if ip := clientIp.To4(); ip != nil {
+		_, _ = h.Write(ip)
+	} else {
+		_, _ = h.Write(clientIp.To16())
+	}
+	return h.Sum(nil)
+}
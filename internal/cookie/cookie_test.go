@@ -0,0 +1,121 @@
+package cookie
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/pkg/hiredis"
+	. "github.com/onsi/gomega"
+)
+
+var cookieRedisDataConfig = storage.DataHandlerConfig{
+	ZoneCacheSize:      10000,
+	ZoneCacheTimeout:   60,
+	ZoneReload:         60,
+	RecordCacheSize:    10000,
+	RecordCacheTimeout: 60,
+	MinTTL:             5,
+	MaxTTL:             300,
+	Redis: hiredis.Config{
+		Address:  "redis:6379",
+		Net:      "tcp",
+		DB:       0,
+		Password: "",
+		Prefix:   "cookie_",
+		Suffix:   "_cookie",
+		Connection: hiredis.ConnectionConfig{
+			MaxIdleConnections:   10,
+			MaxActiveConnections: 10,
+			ConnectTimeout:       500,
+			ReadTimeout:          500,
+			IdleKeepAlive:        30,
+			MaxKeepAlive:         0,
+			WaitForConnection:    true,
+		},
+	},
+}
+
+func decode(g *WithT, s string) []byte {
+	b, err := hex.DecodeString(s)
+	g.Expect(err).To(BeNil())
+	return b
+}
+
+func TestCheck(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(NewCookies(&Config{Enable: false}, nil)).To(BeNil())
+	g.Expect((&Config{Secret: "e5e973"}).Verify()).To(Equal(ErrInvalidSecret))
+
+	// RFC 9018 appendix A.1
+	c := NewCookies(&Config{Enable: true, Secret: "e5e973e5a6b2a43f48e7dc849e37bfcf"}, nil)
+	defer c.ShutDown()
+	clientIp := net.ParseIP("198.51.100.100")
+	issued := time.Unix(1559731985, 0)
+	status, response := c.Check(decode(g, "2464c4abcf10c957"), clientIp, issued)
+	g.Expect(status).To(Equal(StatusClientOnly))
+	g.Expect(hex.EncodeToString(response)).To(Equal("2464c4abcf10c957010000005cf79f111f8130c3eee29480"))
+
+	// valid cookies are reused until refresh time
+	status, same := c.Check(response, clientIp, issued.Add(10*time.Minute))
+	g.Expect(status).To(Equal(StatusValid))
+	g.Expect(same).To(Equal(response))
+	status, refreshed := c.Check(response, clientIp, issued.Add(40*time.Minute))
+	g.Expect(status).To(Equal(StatusValid))
+	g.Expect(refreshed).NotTo(Equal(response))
+	g.Expect(refreshed[:8]).To(Equal(response[:8]))
+
+	// expired, from future, other address, tampered
+	status, _ = c.Check(response, clientIp, issued.Add(2*time.Hour))
+	g.Expect(status).To(Equal(StatusInvalid))
+	status, _ = c.Check(response, clientIp, issued.Add(-10*time.Minute))
+	g.Expect(status).To(Equal(StatusInvalid))
+	status, _ = c.Check(response, net.ParseIP("198.51.100.101"), issued)
+	g.Expect(status).To(Equal(StatusInvalid))
+	tampered := append([]byte{}, response...)
+	tampered[23] ^= 1
+	status, _ = c.Check(tampered, clientIp, issued)
+	g.Expect(status).To(Equal(StatusInvalid))
+
+	// length checks
+	status, _ = c.Check(nil, clientIp, issued)
+	g.Expect(status).To(Equal(StatusNone))
+	for _, length := range []int{0, 7, 9, 15, 41} {
+		status, _ = c.Check(make([]byte, length), clientIp, issued)
+		g.Expect(status).To(Equal(StatusMalformed))
+	}
+	status, _ = c.Check(make([]byte, 24), clientIp, issued)
+	g.Expect(status).To(Equal(StatusInvalid))
+}
+
+func TestSharedSecret(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dh := storage.NewDataHandler(&cookieRedisDataConfig)
+	defer dh.ShutDown()
+	g.Expect(dh.Clear()).To(BeNil())
+
+	first := NewCookies(&Config{Enable: true, SecretLifetime: 3600}, dh)
+	defer first.ShutDown()
+	second := NewCookies(&Config{Enable: true, SecretLifetime: 3600}, dh)
+	defer second.ShutDown()
+	local := NewCookies(&Config{Enable: true, SecretLifetime: 3600}, nil)
+	defer local.ShutDown()
+
+	clientIp := net.ParseIP("2001:db8::1")
+	now := time.Now()
+	_, response := first.Check(decode(g, "0102030405060708"), clientIp, now)
+	status, _ := second.Check(response, clientIp, now)
+	g.Expect(status).To(Equal(StatusValid))
+	status, _ = local.Check(response, clientIp, now)
+	g.Expect(status).To(Equal(StatusInvalid))
+
+	// cookies issued before rotation are accepted by the next period
+	second.rotate(now.Add(time.Hour))
+	status, _ = second.Check(response, clientIp, now)
+	g.Expect(status).To(Equal(StatusValid))
+	second.rotate(now.Add(2 * time.Hour))
+	status, _ = second.Check(response, clientIp, now)
+	g.Expect(status).To(Equal(StatusInvalid))
+}
@@ -0,0 +1,124 @@
+package dnssec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/ristretto"
+	"github.com/hawell/z42/internal/metrics"
+	"github.com/hawell/z42/internal/types"
+	"github.com/miekg/dns"
+)
+
+type SignatureCacheConfig struct {
+	Size    int `json:"size"`
+	Refresh int `json:"refresh"`
+}
+
+// SignatureCache keeps generated signatures keyed by owner name, type, rrset content and key tag
+// signatures are refreshed Refresh seconds before their expiration, a nil cache signs every request
+type SignatureCache struct {
+	config      *SignatureCacheConfig
+	cache       *ristretto.Cache
+	generations map[string]uint64
+	lock        sync.RWMutex
+	hits        uint64
+	misses      uint64
+}
+
+func NewSignatureCache(config *SignatureCacheConfig) *SignatureCache {
+	if config.Size <= 0 {
+		return nil
+	}
+	c := &SignatureCache{
+		config:      config,
+		generations: make(map[string]uint64),
+	}
+	c.cache, _ = ristretto.NewCache(&ristretto.Config{
+		NumCounters: int64(config.Size) * 10,
+		MaxCost:     int64(config.Size),
+		BufferItems: 64,
+		Metrics:     false,
+	})
+	return c
+}
+
+// Invalidate drops all cached signatures of zone
+func (c *SignatureCache) Invalidate(zone string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	c.generations[zone]++
+	c.lock.Unlock()
+}
+
+func (c *SignatureCache) Hits() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.hits)
+}
+
+func (c *SignatureCache) Misses() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.misses)
+}
+
+func (c *SignatureCache) generation(zone string) uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.generations[zone]
+}
+
+func (c *SignatureCache) key(zone string, rrs []dns.RR, signer string, key *types.ZoneKey, ttl uint32) string {
+	records := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		records = append(records, rr.String())
+	}
+	sort.Strings(records)
+	hash := sha256.Sum256([]byte(strings.Join(records, "\n")))
+	return strings.Join([]string{
+		zone,
+		strconv.FormatUint(c.generation(zone), 10),
+		rrs[0].Header().Name,
+		signer,
+		strconv.Itoa(int(rrs[0].Header().Rrtype)),
+		strconv.Itoa(int(key.DnsKey.KeyTag())),
+		strconv.FormatUint(uint64(ttl), 10),
+		hex.EncodeToString(hash[:]),
+	}, "|")
+}
+
+// sign returns a cached signature of rrs if it is not about to expire, otherwise signs rrs using signFunc
+func (c *SignatureCache) sign(zone string, rrs []dns.RR, signer string, key *types.ZoneKey, ttl uint32, signFunc func() *dns.RRSIG) *dns.RRSIG {
+	if c == nil {
+		return signFunc()
+	}
+	cacheKey := c.key(zone, rrs, signer, key, ttl)
+	now := uint32(time.Now().Unix())
+	refresh := uint32(c.config.Refresh)
+	if cached, found := c.cache.Get(cacheKey); found {
+		rrsig := cached.(*dns.RRSIG)
+		if rrsig.Expiration > now+refresh {
+			atomic.AddUint64(&c.hits, 1)
+			metrics.CacheRequests.WithLabelValues("signature", "hit").Inc()
+			return dns.Copy(rrsig).(*dns.RRSIG)
+		}
+	}
+	atomic.AddUint64(&c.misses, 1)
+	metrics.CacheRequests.WithLabelValues("signature", "miss").Inc()
+	rrsig := signFunc()
+	if rrsig != nil && rrsig.Expiration > now+refresh {
+		c.cache.SetWithTTL(cacheKey, dns.Copy(rrsig), 1, time.Duration(rrsig.Expiration-now-refresh)*time.Second)
+	}
+	return rrsig
+}
@@ -0,0 +1,49 @@
+package dnssec
+
+import (
+	"github.com/hawell/z42/internal/types"
+
+	"github.com/miekg/dns"
+)
+
+// CDS returns CDS records for zone ksk keys, or a delete CDS (RFC 8078) if cds_delete is set for zone.
+// nothing is returned for unsigned zones, including zones whose keys failed to load
+func CDS(z *types.Zone) []dns.RR {
+	if !z.Config.DnsSec {
+		return nil
+	}
+	hdr := dns.RR_Header{Name: z.Name, Rrtype: dns.TypeCDS, Class: dns.ClassINET, Ttl: z.KSK.DnsKey.Hdr.Ttl}
+	if z.Config.CdsDelete {
+		return []dns.RR{&dns.CDS{DS: dns.DS{Hdr: hdr, KeyTag: 0, Algorithm: 0, DigestType: 0, Digest: "00"}}}
+	}
+	var res []dns.RR
+	for _, key := range z.KSKs {
+		ds := key.DnsKey.ToDS(dns.SHA256)
+		if ds == nil {
+			continue
+		}
+		cds := ds.ToCDS()
+		cds.Hdr = hdr
+		res = append(res, cds)
+	}
+	return res
+}
+
+// CDNSKEY returns CDNSKEY records for zone ksk keys, or a delete CDNSKEY (RFC 8078) if cds_delete is set for zone.
+// nothing is returned for unsigned zones, including zones whose keys failed to load
+func CDNSKEY(z *types.Zone) []dns.RR {
+	if !z.Config.DnsSec {
+		return nil
+	}
+	hdr := dns.RR_Header{Name: z.Name, Rrtype: dns.TypeCDNSKEY, Class: dns.ClassINET, Ttl: z.KSK.DnsKey.Hdr.Ttl}
+	if z.Config.CdsDelete {
+		return []dns.RR{&dns.CDNSKEY{DNSKEY: dns.DNSKEY{Hdr: hdr, Flags: 0, Protocol: 3, Algorithm: 0, PublicKey: "AA=="}}}
+	}
+	var res []dns.RR
+	for _, key := range z.KSKs {
+		cdnskey := key.DnsKey.ToCDNSKEY()
+		cdnskey.Hdr = hdr
+		res = append(res, cdnskey)
+	}
+	return res
+}
@@ -2,16 +2,20 @@ package dnssec
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
+	"github.com/cloudflare/circl/sign/ed448"
+	"github.com/hawell/z42/internal/metrics"
 	"github.com/hawell/z42/internal/types"
 	"go.uber.org/zap"
+	"time"
 
 	"github.com/miekg/dns"
 )
 
 var (
-	NsecBitmapZone          = []uint16{dns.TypeA, dns.TypeCNAME, dns.TypePTR, dns.TypeMX, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeTLSA, dns.TypeCAA}
-	NsecBitmapAppex         = []uint16{dns.TypeA, dns.TypeNS, dns.TypeSOA, dns.TypePTR, dns.TypeMX, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeTLSA, dns.TypeCAA}
+	NsecBitmapZone          = []uint16{dns.TypeA, dns.TypeCNAME, dns.TypePTR, dns.TypeHINFO, dns.TypeMX, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeNAPTR, dns.TypeSSHFP, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeTLSA, dns.TypeSMIMEA, dns.TypeOPENPGPKEY, dns.TypeSVCB, dns.TypeHTTPS, dns.TypeURI, dns.TypeCAA}
+	NsecBitmapAppex         = []uint16{dns.TypeA, dns.TypeNS, dns.TypeSOA, dns.TypePTR, dns.TypeHINFO, dns.TypeMX, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeNAPTR, dns.TypeSSHFP, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeTLSA, dns.TypeSMIMEA, dns.TypeCDS, dns.TypeCDNSKEY, dns.TypeOPENPGPKEY, dns.TypeSVCB, dns.TypeHTTPS, dns.TypeURI, dns.TypeCAA}
 	NsecBitmapSubDelegation = []uint16{dns.TypeNS, dns.TypeDS, dns.TypeRRSIG, dns.TypeNSEC}
 	NsecBitmapNameError     = []uint16{dns.TypeRRSIG, dns.TypeNSEC}
 )
@@ -26,27 +30,63 @@ func FilterNsecBitmap(qtype uint16, bitmap []uint16) []uint16 {
 	return res
 }
 
-func SignResponse(rrs []dns.RR, qname string, z *types.Zone) []dns.RR {
+func SignResponse(rrs []dns.RR, qname string, z *types.Zone, cache *SignatureCache) []dns.RR {
+	return SignWildcardResponse(rrs, qname, "", "", z, cache)
+}
+
+// SignWildcardResponse signs rrs like SignResponse except rrsets owned by expanded which are signed as synthesized from wildcard
+func SignWildcardResponse(rrs []dns.RR, qname string, expanded string, wildcard string, z *types.Zone, cache *SignatureCache) []dns.RR {
 	var res []dns.RR
+	var dnames []string
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeDNAME {
+			dnames = append(dnames, rr.Header().Name)
+		}
+	}
 	sets := types.SplitSets(rrs)
 	for _, set := range sets {
 		res = append(res, set...)
+		name := set[0].Header().Name
+		ttl := set[0].Header().Ttl
+		// cname synthesized from dname is not signed, validators verify it using signed dname (rfc6672 section 5.3.1)
+		if set[0].Header().Rrtype == dns.TypeCNAME && synthesized(name, dnames) {
+			continue
+		}
 		switch set[0].Header().Rrtype {
 		case dns.TypeRRSIG, dns.TypeOPT:
 			continue
 		case dns.TypeDNSKEY:
-			res = append(res, z.DnsKeySig)
+			res = append(res, z.DnsKeySigs...)
 		case dns.TypeNS:
 			if qname == z.Name {
-				res = append(res, SignRRSet(set, set[0].Header().Name, z.ZSK, set[0].Header().Ttl))
+				res = append(res, cache.sign(z.Name, set, name, z.ZSK, ttl, func() *dns.RRSIG {
+					return SignRRSet(set, name, z.ZSK, ttl)
+				}))
 			}
 		default:
-			res = append(res, SignRRSet(set, set[0].Header().Name, z.ZSK, set[0].Header().Ttl))
+			if wildcard != "" && name == expanded {
+				res = append(res, cache.sign(z.Name, set, wildcard, z.ZSK, ttl, func() *dns.RRSIG {
+					return SignWildcardRRSet(set, wildcard, z.ZSK, ttl)
+				}))
+			} else {
+				res = append(res, cache.sign(z.Name, set, name, z.ZSK, ttl, func() *dns.RRSIG {
+					return SignRRSet(set, name, z.ZSK, ttl)
+				}))
+			}
 		}
 	}
 	return res
 }
 
+func synthesized(name string, dnames []string) bool {
+	for _, owner := range dnames {
+		if name != owner && dns.IsSubDomain(owner, name) {
+			return true
+		}
+	}
+	return false
+}
+
 func SignRRSet(rrs []dns.RR, name string, key *types.ZoneKey, ttl uint32) *dns.RRSIG {
 	rrsig := &dns.RRSIG{
 		Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: ttl},
@@ -56,6 +96,10 @@ func SignRRSet(rrs []dns.RR, name string, key *types.ZoneKey, ttl uint32) *dns.R
 		SignerName: key.DnsKey.Hdr.Name,
 		Algorithm:  key.DnsKey.Algorithm,
 	}
+	start := time.Now()
+	defer func() {
+		metrics.SigningDuration.WithLabelValues(dns.AlgorithmToString[rrsig.Algorithm]).Observe(time.Since(start).Seconds())
+	}()
 	switch rrsig.Algorithm {
 	case dns.RSAMD5, dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
 		if err := rrsig.Sign(key.PrivateKey.(*rsa.PrivateKey), rrs); err != nil {
@@ -67,10 +111,21 @@ func SignRRSet(rrs []dns.RR, name string, key *types.ZoneKey, ttl uint32) *dns.R
 			zap.L().Error("sign failed", zap.Error(err))
 			return nil
 		}
+	case dns.ED25519:
+		if err := rrsig.Sign(key.PrivateKey.(ed25519.PrivateKey), rrs); err != nil {
+			zap.L().Error("sign failed", zap.Error(err))
+			return nil
+		}
+	case dns.ED448:
+		if err := signED448(rrsig, key.PrivateKey.(ed448.PrivateKey), rrs); err != nil {
+			zap.L().Error("sign failed", zap.Error(err))
+			return nil
+		}
 	case dns.DSA, dns.DSANSEC3SHA1:
 		//rrsig.Sign(zone.PrivateKey.(*dsa.PrivateKey), rrs)
 		fallthrough
 	default:
+		zap.L().Error("unsupported algorithm", zap.String("algorithm", dns.AlgorithmToString[rrsig.Algorithm]))
 		return nil
 	}
 	return rrsig
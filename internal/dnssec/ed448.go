@@ -0,0 +1,190 @@
+package dnssec
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/circl/sign/ed448"
+	"github.com/miekg/dns"
+)
+
+// ED448 (rfc8080) is not implemented by the dns library, keys are handled with circl and rrsets are signed
+// over their canonical form (rfc4034 section 3.1.8.1) built here
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+func generateED448(key *dns.DNSKEY) (string, string, error) {
+	pub, priv, err := ed448.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	key.PublicKey = base64.StdEncoding.EncodeToString(pub)
+	return key.String(), "Private-key-format: v1.3\n" +
+		"Algorithm: 16 (ED448)\n" +
+		"PrivateKey: " + base64.StdEncoding.EncodeToString(priv.Seed()) + "\n", nil
+}
+
+// NewPrivateKey parses private key of key in bind private key format, including ED448 keys
+func NewPrivateKey(key *dns.DNSKEY, s string) (crypto.PrivateKey, error) {
+	if key.Algorithm != dns.ED448 {
+		return key.NewPrivateKey(s)
+	}
+	for _, line := range strings.Split(s, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 || strings.ToLower(strings.TrimSpace(kv[0])) != "privatekey" {
+			continue
+		}
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(kv[1]))
+		if err != nil || len(seed) != ed448.SeedSize {
+			return nil, dns.ErrPrivKey
+		}
+		priv := ed448.NewKeyFromSeed(seed)
+		if base64.StdEncoding.EncodeToString(priv.Public().(ed448.PublicKey)) != key.PublicKey {
+			return nil, dns.ErrKey
+		}
+		return priv, nil
+	}
+	return nil, dns.ErrPrivKey
+}
+
+func signED448(rrsig *dns.RRSIG, priv ed448.PrivateKey, rrs []dns.RR) error {
+	h0 := rrs[0].Header()
+	rrsig.Hdr.Rrtype = dns.TypeRRSIG
+	rrsig.Hdr.Name = h0.Name
+	rrsig.Hdr.Class = h0.Class
+	if rrsig.OrigTtl == 0 {
+		rrsig.OrigTtl = h0.Ttl
+	}
+	rrsig.TypeCovered = h0.Rrtype
+	rrsig.Labels = uint8(dns.CountLabel(h0.Name))
+	if strings.HasPrefix(h0.Name, "*") {
+		rrsig.Labels--
+	}
+	data, err := signedData(rrsig, rrs)
+	if err != nil {
+		return err
+	}
+	rrsig.Signature = base64.StdEncoding.EncodeToString(ed448.Sign(priv, data, ""))
+	return nil
+}
+
+// Verify checks rrsig of rrs using key, unlike dns.RRSIG.Verify ED448 signatures are supported
+func Verify(rrsig *dns.RRSIG, key *dns.DNSKEY, rrs []dns.RR) error {
+	if rrsig.Algorithm != dns.ED448 {
+		return rrsig.Verify(key, rrs)
+	}
+	if key.Algorithm != dns.ED448 || key.KeyTag() != rrsig.KeyTag || !strings.EqualFold(key.Hdr.Name, rrsig.SignerName) {
+		return dns.ErrKey
+	}
+	pub, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil || len(pub) != ed448.PublicKeySize {
+		return dns.ErrKey
+	}
+	signature, err := base64.StdEncoding.DecodeString(rrsig.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	data, err := signedData(rrsig, rrs)
+	if err != nil {
+		return err
+	}
+	if !ed448.Verify(pub, data, signature, "") {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// signedData returns rrsig rdata without signature followed by rrs in canonical form and order
+func signedData(rrsig *dns.RRSIG, rrs []dns.RR) ([]byte, error) {
+	sig := *rrsig
+	sig.SignerName = dns.CanonicalName(sig.SignerName)
+	sig.Signature = ""
+	data, err := rdata(&sig)
+	if err != nil {
+		return nil, err
+	}
+	wires := make([][]byte, 0, len(rrs))
+	for _, rr := range rrs {
+		rr = dns.Copy(rr)
+		h := rr.Header()
+		h.Ttl = rrsig.OrigTtl
+		if labels := dns.SplitDomainName(h.Name); len(labels) > int(rrsig.Labels) {
+			h.Name = "*." + strings.Join(labels[len(labels)-int(rrsig.Labels):], ".") + "."
+		}
+		h.Name = dns.CanonicalName(h.Name)
+		canonicalRdata(rr)
+		wire := make([]byte, dns.Len(rr)+1)
+		n, err := dns.PackRR(rr, wire, 0, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		wires = append(wires, wire[:n])
+	}
+	sort.Slice(wires, func(i, j int) bool {
+		return bytes.Compare(rdataOf(wires[i]), rdataOf(wires[j])) < 0
+	})
+	for i, wire := range wires {
+		if i > 0 && bytes.Equal(wire, wires[i-1]) {
+			continue
+		}
+		data = append(data, wire...)
+	}
+	return data, nil
+}
+
+func rdata(rr dns.RR) ([]byte, error) {
+	wire := make([]byte, dns.Len(rr)+1)
+	n, err := dns.PackRR(rr, wire, 0, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return rdataOf(wire[:n]), nil
+}
+
+func rdataOf(wire []byte) []byte {
+	_, off, _ := dns.UnpackDomainName(wire, 0)
+	return wire[off+10:]
+}
+
+// canonicalRdata lowercases domain names in rdata of types listed in rfc4034 section 6.2 (rfc6840 section 5.1)
+func canonicalRdata(rr dns.RR) {
+	switch x := rr.(type) {
+	case *dns.NS:
+		x.Ns = dns.CanonicalName(x.Ns)
+	case *dns.CNAME:
+		x.Target = dns.CanonicalName(x.Target)
+	case *dns.SOA:
+		x.Ns = dns.CanonicalName(x.Ns)
+		x.Mbox = dns.CanonicalName(x.Mbox)
+	case *dns.PTR:
+		x.Ptr = dns.CanonicalName(x.Ptr)
+	case *dns.MX:
+		x.Mx = dns.CanonicalName(x.Mx)
+	case *dns.NAPTR:
+		x.Replacement = dns.CanonicalName(x.Replacement)
+	case *dns.SRV:
+		x.Target = dns.CanonicalName(x.Target)
+	case *dns.DNAME:
+		x.Target = dns.CanonicalName(x.Target)
+	case *dns.MINFO:
+		x.Rmail = dns.CanonicalName(x.Rmail)
+		x.Email = dns.CanonicalName(x.Email)
+	case *dns.RP:
+		x.Mbox = dns.CanonicalName(x.Mbox)
+		x.Txt = dns.CanonicalName(x.Txt)
+	case *dns.AFSDB:
+		x.Hostname = dns.CanonicalName(x.Hostname)
+	case *dns.RT:
+		x.Host = dns.CanonicalName(x.Host)
+	case *dns.PX:
+		x.Map822 = dns.CanonicalName(x.Map822)
+		x.Mapx400 = dns.CanonicalName(x.Mapx400)
+	case *dns.KX:
+		x.Exchanger = dns.CanonicalName(x.Exchanger)
+	}
+}
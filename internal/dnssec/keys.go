@@ -0,0 +1,51 @@
+package dnssec
+
+import (
+	"errors"
+
+	"github.com/miekg/dns"
+)
+
+var ErrUnsupportedAlgorithm = errors.New("unsupported algorithm, supported algorithms are RSASHA1, RSASHA1NSEC3SHA1, RSASHA256, RSASHA512, ECDSAP256SHA256, ECDSAP384SHA384, ED25519 and ED448")
+
+// SupportedAlgorithm checks whether keys of algorithm can be generated and used for signing
+func SupportedAlgorithm(algorithm uint8) bool {
+	switch algorithm {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512, dns.ECDSAP256SHA256, dns.ECDSAP384SHA384, dns.ED25519, dns.ED448:
+		return true
+	}
+	return false
+}
+
+// GenerateKey creates a new zsk or ksk for zone, returns public key in presentation format and private key in bind private key format
+func GenerateKey(zone string, keyType string, algorithm uint8, ttl uint32) (string, string, error) {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: ttl},
+		Flags:     256,
+		Protocol:  3,
+		Algorithm: algorithm,
+	}
+	if keyType == "ksk" {
+		key.Flags = 257
+	}
+	var bits int
+	switch algorithm {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		bits = 2048
+	case dns.ECDSAP256SHA256:
+		bits = 256
+	case dns.ECDSAP384SHA384:
+		bits = 384
+	case dns.ED25519:
+		bits = 256
+	case dns.ED448:
+		return generateED448(key)
+	default:
+		return "", "", ErrUnsupportedAlgorithm
+	}
+	priv, err := key.Generate(bits)
+	if err != nil {
+		return "", "", err
+	}
+	return key.String(), key.PrivateKeyString(priv), nil
+}
@@ -0,0 +1,105 @@
+package dnssec
+
+import (
+	"encoding/base32"
+	"github.com/hawell/z42/internal/types"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	Nsec3BitmapZone          = []uint16{dns.TypeA, dns.TypePTR, dns.TypeHINFO, dns.TypeMX, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeNAPTR, dns.TypeSSHFP, dns.TypeRRSIG, dns.TypeTLSA, dns.TypeSMIMEA, dns.TypeOPENPGPKEY, dns.TypeSVCB, dns.TypeHTTPS, dns.TypeURI, dns.TypeCAA}
+	Nsec3BitmapAppex         = []uint16{dns.TypeA, dns.TypeNS, dns.TypeSOA, dns.TypePTR, dns.TypeHINFO, dns.TypeMX, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeNAPTR, dns.TypeSSHFP, dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC3PARAM, dns.TypeTLSA, dns.TypeSMIMEA, dns.TypeCDS, dns.TypeCDNSKEY, dns.TypeOPENPGPKEY, dns.TypeSVCB, dns.TypeHTTPS, dns.TypeURI, dns.TypeCAA}
+	Nsec3BitmapSubDelegation = []uint16{dns.TypeNS, dns.TypeDS, dns.TypeRRSIG}
+)
+
+// Nsec3Param returns the NSEC3PARAM record of zone
+func Nsec3Param(z *types.Zone) *dns.NSEC3PARAM {
+	return &dns.NSEC3PARAM{
+		Hdr:        dns.RR_Header{Name: z.Name, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET, Ttl: z.Config.SOA.Ttl},
+		Hash:       dns.SHA1,
+		Flags:      0,
+		Iterations: z.Config.Nsec3.Iterations,
+		SaltLength: uint8(len(z.Config.Nsec3.Salt) / 2),
+		Salt:       z.Config.Nsec3.Salt,
+	}
+}
+
+// MatchingNsec3 returns an NSEC3 record whose owner is the hash of name
+func MatchingNsec3(name string, z *types.Zone, bitmap []uint16) *dns.NSEC3 {
+	hash := dns.HashName(name, dns.SHA1, z.Config.Nsec3.Iterations, z.Config.Nsec3.Salt)
+	return newNsec3(hash, shiftHash(hash, 1), z, bitmap, false)
+}
+
+// CoveringNsec3 returns a minimally covering NSEC3 record for hash of name, spanning from hash-1 to hash+1
+func CoveringNsec3(name string, z *types.Zone, optOut bool) *dns.NSEC3 {
+	hash := dns.HashName(name, dns.SHA1, z.Config.Nsec3.Iterations, z.Config.Nsec3.Salt)
+	return newNsec3(shiftHash(hash, -1), shiftHash(hash, 1), z, []uint16{}, optOut)
+}
+
+func newNsec3(owner string, next string, z *types.Zone, bitmap []uint16, optOut bool) *dns.NSEC3 {
+	var flags uint8
+	if optOut {
+		flags = 1
+	}
+	return &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: strings.ToLower(owner) + "." + z.Name, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: z.Config.SOA.MinTtl},
+		Hash:       dns.SHA1,
+		Flags:      flags,
+		Iterations: z.Config.Nsec3.Iterations,
+		SaltLength: uint8(len(z.Config.Nsec3.Salt) / 2),
+		Salt:       z.Config.Nsec3.Salt,
+		HashLength: 20,
+		NextDomain: next,
+		TypeBitMap: bitmap,
+	}
+}
+
+// shiftHash adds delta (+1 or -1) to a base32hex encoded hash, wrapping around at the ends of hash space
+func shiftHash(hash string, delta int) string {
+	b, err := base32.HexEncoding.DecodeString(hash)
+	if err != nil {
+		return hash
+	}
+	for i := len(b) - 1; i >= 0; i-- {
+		if delta > 0 {
+			b[i]++
+			if b[i] != 0 {
+				break
+			}
+		} else {
+			b[i]--
+			if b[i] != 0xff {
+				break
+			}
+		}
+	}
+	return base32.HexEncoding.EncodeToString(b)
+}
+
+// NextCloser returns the name one label longer than closest encloser ce on the path to name
+func NextCloser(name string, ce string) string {
+	labels := dns.SplitDomainName(name)
+	ceLabels := dns.CountLabel(ce)
+	if len(labels) <= ceLabels {
+		return name
+	}
+	return dns.Fqdn(strings.Join(labels[len(labels)-ceLabels-1:], "."))
+}
+
+// SignWildcardRRSet signs rrs synthesized from wildcard, signature is computed over wildcard owner and carries the expanded name
+func SignWildcardRRSet(rrs []dns.RR, wildcard string, key *types.ZoneKey, ttl uint32) *dns.RRSIG {
+	expanded := rrs[0].Header().Name
+	source := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		rr = dns.Copy(rr)
+		rr.Header().Name = wildcard
+		source = append(source, rr)
+	}
+	rrsig := SignRRSet(source, wildcard, key, ttl)
+	if rrsig != nil {
+		rrsig.Hdr.Name = expanded
+	}
+	return rrsig
+}
@@ -0,0 +1,311 @@
+package dnstap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/hawell/z42/internal/metrics"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+type Config struct {
+	Enable     bool   `json:"enable"`
+	Target     string `json:"target"`
+	Address    string `json:"address"`
+	Identity   string `json:"identity"`
+	Version    string `json:"version"`
+	BufferSize int    `json:"buffer_size"`
+	Queries    bool   `json:"queries"`
+	Responses  bool   `json:"responses"`
+}
+
+const (
+	TargetUnix = "unix"
+	TargetTcp  = "tcp"
+	TargetFile = "file"
+
+	defaultBufferSize = 10000
+	retryInterval     = 5 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+var (
+	ErrInvalidTarget = errors.New("dnstap target must be one of unix, tcp or file")
+	ErrNoAddress     = errors.New("dnstap address is empty")
+)
+
+// Verify checks target and address
+func (config *Config) Verify() error {
+	switch config.Target {
+	case TargetUnix, TargetFile:
+	case TargetTcp:
+		if _, _, err := net.SplitHostPort(config.Address); err != nil {
+			return err
+		}
+	default:
+		return ErrInvalidTarget
+	}
+	if config.Address == "" {
+		return ErrNoAddress
+	}
+	return nil
+}
+
+// Tap sends AUTH_QUERY and AUTH_RESPONSE messages to a frame stream output, messages are dropped when buffer is full so a slow collector never delays responses
+type Tap struct {
+	config   *Config
+	output   tap.Output
+	messages chan *tap.Dnstap
+	identity []byte
+	version  []byte
+	dropped  uint64
+	// lock guards closed, messages is never closed since writers of in-flight requests may still send after ShutDown
+	lock   sync.RWMutex
+	closed bool
+	quit   chan struct{}
+	quitWG sync.WaitGroup
+}
+
+// NewTap returns nil if dnstap is disabled or output cannot be created
+func NewTap(config *Config) *Tap {
+	if !config.Enable {
+		return nil
+	}
+	if err := config.Verify(); err != nil {
+		zap.L().Error("invalid dnstap config", zap.Error(err))
+		return nil
+	}
+	output, err := newOutput(config)
+	if err != nil {
+		zap.L().Error("cannot create dnstap output", zap.String("target", config.Target), zap.String("address", config.Address), zap.Error(err))
+		return nil
+	}
+	bufferSize := config.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	t := &Tap{
+		config:   config,
+		output:   output,
+		messages: make(chan *tap.Dnstap, bufferSize),
+		quit:     make(chan struct{}),
+	}
+	if config.Identity != "" {
+		t.identity = []byte(config.Identity)
+	}
+	if config.Version != "" {
+		t.version = []byte(config.Version)
+	}
+	go output.RunOutputLoop()
+	t.quitWG.Add(1)
+	go t.run()
+	return t
+}
+
+func newOutput(config *Config) (tap.Output, error) {
+	switch config.Target {
+	case TargetUnix:
+		addr, err := net.ResolveUnixAddr("unix", config.Address)
+		if err != nil {
+			return nil, err
+		}
+		return sockOutput(addr)
+	case TargetTcp:
+		addr, err := net.ResolveTCPAddr("tcp", config.Address)
+		if err != nil {
+			return nil, err
+		}
+		return sockOutput(addr)
+	case TargetFile:
+		output, err := tap.NewFrameStreamOutputFromFilename(config.Address)
+		if err != nil {
+			return nil, err
+		}
+		output.SetLogger(logger{})
+		return output, nil
+	default:
+		return nil, ErrInvalidTarget
+	}
+}
+
+// sockOutput reconnects to collector every retryInterval while it is unreachable
+func sockOutput(addr net.Addr) (tap.Output, error) {
+	output, err := tap.NewFrameStreamSockOutput(addr)
+	if err != nil {
+		return nil, err
+	}
+	output.SetRetryInterval(retryInterval)
+	output.SetLogger(logger{})
+	return output, nil
+}
+
+type logger struct{}
+
+func (logger) Printf(format string, v ...interface{}) {
+	zap.L().Warn("dnstap output", zap.String("message", fmt.Sprintf(format, v...)))
+}
+
+// run encodes buffered messages, only this goroutine blocks when output is slow or reconnecting
+func (t *Tap) run() {
+	defer t.quitWG.Done()
+	output := t.output.GetOutputChannel()
+	write := func(m *tap.Dnstap) {
+		buf, err := proto.Marshal(m)
+		if err != nil {
+			zap.L().Error("cannot encode dnstap message", zap.Error(err))
+			return
+		}
+		output <- buf
+	}
+	for {
+		select {
+		case m := <-t.messages:
+			write(m)
+		case <-t.quit:
+			// no message is added after quit, flush what is buffered
+			for {
+				select {
+				case m := <-t.messages:
+					write(m)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// ShutDown flushes buffered messages, it gives up after shutdownTimeout if collector is unreachable
+func (t *Tap) ShutDown() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	if t.closed {
+		t.lock.Unlock()
+		return
+	}
+	t.closed = true
+	close(t.quit)
+	t.lock.Unlock()
+	done := make(chan struct{})
+	go func() {
+		t.quitWG.Wait()
+		t.output.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		zap.L().Error("dnstap output not flushed", zap.String("target", t.config.Target), zap.String("address", t.config.Address))
+	}
+}
+
+// Dropped returns number of messages dropped because buffer was full
+func (t *Tap) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// send drops m if tap is shut down, responses of requests started before a reload may arrive after it
+func (t *Tap) send(m *tap.Message) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.messages <- &tap.Dnstap{
+		Identity: t.identity,
+		Version:  t.version,
+		Type:     tap.Dnstap_MESSAGE.Enum(),
+		Message:  m,
+	}:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+		metrics.DnstapDropped.Inc()
+	}
+}
+
+// Wrap logs r as a query and returns a writer logging responses written to w
+func (t *Tap) Wrap(w dns.ResponseWriter, r *dns.Msg) dns.ResponseWriter {
+	if t == nil {
+		return w
+	}
+	now := time.Now()
+	if t.config.Queries {
+		if buf, err := r.Pack(); err == nil {
+			m := message(tap.Message_AUTH_QUERY, w)
+			m.QueryTimeSec, m.QueryTimeNsec = timestamp(now)
+			m.QueryMessage = buf
+			t.send(m)
+		}
+	}
+	if !t.config.Responses {
+		return w
+	}
+	return &responseWriter{ResponseWriter: w, tap: t, queryTime: now}
+}
+
+type responseWriter struct {
+	dns.ResponseWriter
+	tap       *Tap
+	queryTime time.Time
+}
+
+func (w *responseWriter) WriteMsg(res *dns.Msg) error {
+	err := w.ResponseWriter.WriteMsg(res)
+	if buf, packErr := res.Pack(); packErr == nil {
+		m := message(tap.Message_AUTH_RESPONSE, w.ResponseWriter)
+		m.QueryTimeSec, m.QueryTimeNsec = timestamp(w.queryTime)
+		m.ResponseTimeSec, m.ResponseTimeNsec = timestamp(time.Now())
+		m.ResponseMessage = buf
+		w.tap.send(m)
+	}
+	return err
+}
+
+// message returns a message of type with client and server addresses of w, stream based transports are reported as tcp
+func message(messageType tap.Message_Type, w dns.ResponseWriter) *tap.Message {
+	m := &tap.Message{Type: messageType.Enum()}
+	protocol := tap.SocketProtocol_TCP
+	queryIp, queryPort := address(w.RemoteAddr())
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		protocol = tap.SocketProtocol_UDP
+	}
+	responseIp, responsePort := address(w.LocalAddr())
+	family := tap.SocketFamily_INET6
+	if ip4 := queryIp.To4(); ip4 != nil {
+		family = tap.SocketFamily_INET
+		queryIp = ip4
+		if ip4 = responseIp.To4(); ip4 != nil {
+			responseIp = ip4
+		}
+	}
+	m.SocketFamily = family.Enum()
+	m.SocketProtocol = protocol.Enum()
+	m.QueryAddress, m.QueryPort = queryIp, &queryPort
+	m.ResponseAddress, m.ResponsePort = responseIp, &responsePort
+	return m
+}
+
+func address(addr net.Addr) (net.IP, uint32) {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP, uint32(a.Port)
+	case *net.TCPAddr:
+		return a.IP, uint32(a.Port)
+	}
+	return nil, 0
+}
+
+func timestamp(t time.Time) (*uint64, *uint32) {
+	sec, nsec := uint64(t.Unix()), uint32(t.Nanosecond())
+	return &sec, &nsec
+}
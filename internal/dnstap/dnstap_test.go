@@ -0,0 +1,109 @@
+package dnstap
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/hawell/z42/internal/test"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFileOutput(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(NewTap(&Config{Enable: false})).To(BeNil())
+
+	path := filepath.Join(t.TempDir(), "dnstap.fstrm")
+	dt := NewTap(&Config{Enable: true, Target: TargetFile, Address: path, Identity: "ns1", Version: "z42", Queries: true, Responses: true})
+	g.Expect(dt).NotTo(BeNil())
+
+	r := new(dns.Msg)
+	r.SetQuestion("www.example.com.", dns.TypeA)
+	w := dt.Wrap(&test.ResponseWriter{}, r)
+	m := new(dns.Msg)
+	m.SetReply(r)
+	g.Expect(w.WriteMsg(m)).To(Succeed())
+	dt.ShutDown()
+	g.Expect(dt.Dropped()).To(BeZero())
+
+	input, err := tap.NewFrameStreamInputFromFilename(path)
+	g.Expect(err).To(BeNil())
+	frames := make(chan []byte, 10)
+	go func() {
+		input.ReadInto(frames)
+		close(frames)
+	}()
+	var messages []*tap.Dnstap
+	for frame := range frames {
+		d := &tap.Dnstap{}
+		g.Expect(proto.Unmarshal(frame, d)).To(Succeed())
+		messages = append(messages, d)
+	}
+	g.Expect(len(messages)).To(Equal(2))
+
+	query := messages[0]
+	g.Expect(string(query.Identity)).To(Equal("ns1"))
+	g.Expect(string(query.Version)).To(Equal("z42"))
+	g.Expect(query.Message.GetType()).To(Equal(tap.Message_AUTH_QUERY))
+	g.Expect(query.Message.GetSocketFamily()).To(Equal(tap.SocketFamily_INET))
+	g.Expect(query.Message.GetSocketProtocol()).To(Equal(tap.SocketProtocol_UDP))
+	g.Expect(net.IP(query.Message.QueryAddress).String()).To(Equal("10.240.0.1"))
+	g.Expect(query.Message.GetQueryPort()).To(Equal(uint32(40212)))
+	q := new(dns.Msg)
+	g.Expect(q.Unpack(query.Message.QueryMessage)).To(Succeed())
+	g.Expect(q.Question[0].Name).To(Equal("www.example.com."))
+
+	response := messages[1]
+	g.Expect(response.Message.GetType()).To(Equal(tap.Message_AUTH_RESPONSE))
+	g.Expect(net.IP(response.Message.ResponseAddress).String()).To(Equal("127.0.0.1"))
+	g.Expect(response.Message.GetQueryTimeSec()).To(Equal(query.Message.GetQueryTimeSec()))
+	a := new(dns.Msg)
+	g.Expect(a.Unpack(response.Message.ResponseMessage)).To(Succeed())
+	g.Expect(a.Id).To(Equal(r.Id))
+	g.Expect(a.Response).To(BeTrue())
+}
+
+func TestSendAfterShutDown(t *testing.T) {
+	g := NewGomegaWithT(t)
+	path := filepath.Join(t.TempDir(), "dnstap.fstrm")
+	dt := NewTap(&Config{Enable: true, Target: TargetFile, Address: path, Queries: true, Responses: true})
+	g.Expect(dt).NotTo(BeNil())
+
+	// request in flight during reload
+	r := new(dns.Msg)
+	r.SetQuestion("www.example.com.", dns.TypeA)
+	w := dt.Wrap(&test.ResponseWriter{}, r)
+	dt.ShutDown()
+	dt.ShutDown()
+	m := new(dns.Msg)
+	m.SetReply(r)
+	g.Expect(w.WriteMsg(m)).To(Succeed())
+	g.Expect(dt.Dropped()).To(BeZero())
+}
+
+func TestDrop(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// nothing listens on socket, so output blocks and buffer fills up
+	path := filepath.Join(t.TempDir(), "dnstap.sock")
+	dt := NewTap(&Config{Enable: true, Target: TargetUnix, Address: path, BufferSize: 1, Queries: true, Responses: false})
+	g.Expect(dt).NotTo(BeNil())
+	r := new(dns.Msg)
+	r.SetQuestion("www.example.com.", dns.TypeA)
+	w := &test.ResponseWriter{}
+	for i := 0; i < 1000; i++ {
+		g.Expect(dt.Wrap(w, r)).To(Equal(w))
+	}
+	g.Expect(dt.Dropped()).To(BeNumerically(">", 0))
+}
+
+func TestVerify(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect((&Config{Target: "udp", Address: "127.0.0.1:6000"}).Verify()).To(Equal(ErrInvalidTarget))
+	g.Expect((&Config{Target: TargetFile}).Verify()).To(Equal(ErrNoAddress))
+	g.Expect((&Config{Target: TargetTcp, Address: "127.0.0.1"}).Verify()).NotTo(BeNil())
+	g.Expect((&Config{Target: TargetTcp, Address: "127.0.0.1:6000"}).Verify()).To(BeNil())
+}
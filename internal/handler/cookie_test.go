@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/hawell/z42/internal/cookie"
+	"github.com/hawell/z42/internal/test"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+func TestCookie(t *testing.T) {
+	g := NewGomegaWithT(t)
+	tc := TestCase{
+		RedisDataConfig: DefaultRedisDataTestConfig,
+		HandlerConfig:   DefaultHandlerTestConfig,
+		Zones:           []string{"cookie.com."},
+		ZoneConfigs:     []string{""},
+		Entries: [][][]string{
+			{
+				{"www",
+					`{"txt":{"ttl":300, "records":[{"text":"foo"}]}}`,
+				},
+			},
+		},
+	}
+	tc.HandlerConfig.Cookie = cookie.Config{Enable: true, Secret: "e5e973e5a6b2a43f48e7dc849e37bfcf", BadCookie: true}
+	h, err := DefaultInitialize(&tc)
+	g.Expect(err).To(BeNil())
+	defer h.ShutDown()
+
+	query := func(value string, tcp bool) (*dns.Msg, bool) {
+		r := test.Case{Qname: "www.cookie.com.", Qtype: dns.TypeTXT}.Msg()
+		r.SetEdns0(4096, false)
+		if value != "" {
+			opt := r.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: value})
+		}
+		w := test.NewRecorder(&test.ResponseWriter{TCP: tcp})
+		context := NewRequestContext(w, r)
+		valid := h.CheckCookie(context)
+		if context.Res == dns.RcodeSuccess {
+			h.HandleRequest(context)
+		} else {
+			context.Response()
+		}
+		return w.Msg, valid
+	}
+	responseCookie := func(m *dns.Msg) string {
+		for _, o := range m.IsEdns0().Option {
+			if c, ok := o.(*dns.EDNS0_COOKIE); ok {
+				return c.Cookie
+			}
+		}
+		return ""
+	}
+
+	// no cookie
+	m, valid := query("", false)
+	g.Expect(valid).To(BeFalse())
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	g.Expect(responseCookie(m)).To(BeEmpty())
+
+	// client cookie gets a new server cookie with BADCOOKIE over udp
+	m, valid = query("0102030405060708", false)
+	g.Expect(valid).To(BeFalse())
+	g.Expect(m.Rcode).To(Equal(dns.RcodeBadCookie))
+	g.Expect(len(m.Answer)).To(Equal(0))
+	serverCookie := responseCookie(m)
+	g.Expect(len(serverCookie)).To(Equal(48))
+	g.Expect(serverCookie[:16]).To(Equal("0102030405060708"))
+	buf, err := m.Pack()
+	g.Expect(err).To(BeNil())
+	g.Expect(m.Unpack(buf)).To(BeNil())
+	g.Expect(m.Rcode).To(Equal(dns.RcodeBadCookie))
+	m, valid = query("0102030405060708", true)
+	g.Expect(valid).To(BeFalse())
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	g.Expect(len(m.Answer)).To(Equal(1))
+
+	// valid server cookie
+	m, valid = query(serverCookie, false)
+	g.Expect(valid).To(BeTrue())
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	g.Expect(len(m.Answer)).To(Equal(1))
+	g.Expect(responseCookie(m)).To(Equal(serverCookie))
+	_, err = m.Pack()
+	g.Expect(err).To(BeNil())
+
+	// malformed
+	m, _ = query("0102", false)
+	g.Expect(m.Rcode).To(Equal(dns.RcodeFormatError))
+	g.Expect(responseCookie(m)).To(BeEmpty())
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"errors"
 	"fmt"
+	"github.com/hawell/z42/internal/dnssec"
 	"github.com/hawell/z42/internal/storage"
 	"github.com/hawell/z42/internal/test"
 	"github.com/hawell/z42/internal/types"
@@ -12,6 +13,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 var zone1ZskPriv = `
@@ -556,8 +558,8 @@ var dnssecTestCases = []*TestCase{
 				Ns: []dns.RR{
 					test.SOA("example. 3600 IN SOA ns1.example. bugs.x.w.example. 1081539377 3600 300 3600000 3600"),
 					test.RRSIG("example.	3600	IN	RRSIG	SOA 8 1 3600 20200216151051 20200208121051 28743 example. dSsS8DyvgC5ZJR38JDPmMYeZaQYSC6vjsyAz3XQgTIa3KTqHPPgtAF7uIAPNuYW8j5pb6WNUysNfg2lFiefY68VZu5oFYNONlqU956jFinK71nYF8btSOruWHPlmLhiu0pbsHZI9EefObTEnET9wsC+YGQnSKADIkyjy2Chljnk="),
-					test.NSEC("ns1.example. 3600 IN NSEC \\000.ns1.example. A CNAME PTR TXT AAAA SRV RRSIG NSEC TLSA CAA"),
-					test.RRSIG("ns1.example.	3600	IN	RRSIG	NSEC 8 2 3600 20200212122320 20200204092320 28743 example. PXRFcyuDlGx4t7SXBPOL6M0r1lxlectaATAoqruOhWcJcmOKgVvuV0A+RccLuNwiQzqa2CV2np2ZXXt1F42fHd+WtnpYeT5btZEeICGRgt1S0ABUuIlhARmow0wxEeFmQUrteEDKfVsOuDrGL0sAxCe8c1zq1acwntVz1VqtLzM="),
+					test.NSEC("ns1.example. 3600 IN NSEC \\000.ns1.example. A CNAME PTR HINFO TXT AAAA SRV NAPTR SSHFP RRSIG NSEC TLSA SMIMEA OPENPGPKEY SVCB HTTPS URI CAA"),
+					test.RRSIG("ns1.example.	3600	IN	RRSIG	NSEC 8 2 3600 20200212122320 20200204092320 28743 example. VMQkfywOjDSGl0H6rQOpqJIjRSJGgBt1uIqo6sKriqXrIdufbzG9K153cHazkMC7gaz7uHEjdo82JvxlBrqDp8CA7UDrNtrP8z1lur5PzzvKQcMvhmNhKppIGfGsJNXrkaf8K/lL5vnWinip5BXnkeoLFzguQWlx4/yW9Hpe51A="),
 				},
 				Do: true,
 				Extra: []dns.RR{
@@ -618,8 +620,8 @@ var dnssecTestCases = []*TestCase{
 				Ns: []dns.RR{
 					test.SOA("example. 3600 IN SOA ns1.example. bugs.x.w.example. 1081539377 3600 300 3600000 3600"),
 					test.RRSIG("example.	3600	IN	RRSIG	SOA 8 1 3600 20200218121950 20200210091950 28743 example. lqLI5JNgfRJ/11i2La2Ydk1qeW6wyv5Acbxxwleq0Rxp8H0d0yuaarjII6IlRmI8SSq0tuEFFqiXhRp5Fn5jAmR6zMB9XtSFVG1yv3NrcmUurVx2wuuvjI3Oft2+UFq74gmDM0oOFxZHpWy0Zur90/KOlANjd/tfBnCNSQydinA="),
-					test.NSEC("a.z.w.example. 3600 IN NSEC \\000.a.z.w.example. A CNAME PTR MX TXT SRV RRSIG NSEC TLSA CAA"),
-					test.RRSIG("a.z.w.example.	3600	IN	RRSIG	NSEC 8 4 3600 20200218235854 20200210205854 28743 example. K7fb20RzhxAlosOmIuolGeuPxIUuY5fTHwtzQoPmLRF3iTH23ICjvWBVX4mx8aEAGlwXIik68rx7WCmuSG0+RbNDbRVfB540q5PT2Y0QoG4gTzueOUR0eboU7qxyAJ+w6KjiNzM0TQ8+SWkVT83gryff2jZAQDJQrMCMxAVV0JI="),
+					test.NSEC("a.z.w.example. 3600 IN NSEC \\000.a.z.w.example. A CNAME PTR HINFO MX TXT SRV NAPTR SSHFP RRSIG NSEC TLSA SMIMEA OPENPGPKEY SVCB HTTPS URI CAA"),
+					test.RRSIG("a.z.w.example.	3600	IN	RRSIG	NSEC 8 4 3600 20200218235854 20200210205854 28743 example. SZhyPd83HnNFt7oJO+W8oaeIh1Y2c5A4x0GRCS2aHvMZF6HrjQwV11sDjAbUOsNysaeN90EXBnOkcg1VajXWZCf2mpqHbQXOD1m5S4frD28f0M1vuQuNunp7IuQizQv/0zkp7ghwI+caoVIbL/cAVl3ChKsGYtotDYLpIqhFEEA="),
 				},
 				Extra: []dns.RR{
 					test.OPT(4096, true),
@@ -633,8 +635,8 @@ var dnssecTestCases = []*TestCase{
 				Ns: []dns.RR{
 					test.SOA("example. 3600 IN SOA ns1.example. bugs.x.w.example. 1081539377 3600 300 3600000 3600"),
 					test.RRSIG("example.	3600	IN	RRSIG	SOA 8 1 3600 20200218121950 20200210091950 28743 example. lqLI5JNgfRJ/11i2La2Ydk1qeW6wyv5Acbxxwleq0Rxp8H0d0yuaarjII6IlRmI8SSq0tuEFFqiXhRp5Fn5jAmR6zMB9XtSFVG1yv3NrcmUurVx2wuuvjI3Oft2+UFq74gmDM0oOFxZHpWy0Zur90/KOlANjd/tfBnCNSQydinA="),
-					test.NSEC("example.	3600	IN	NSEC	\\000.example. A NS SOA PTR MX TXT AAAA SRV RRSIG NSEC TLSA CAA"),
-					test.RRSIG("example.	3600	IN	RRSIG	NSEC 8 1 3600 20200219000030 20200210210030 28743 example. hey30Zt0MMAuvYKhETYD6RXAK2guvQo72n4kANyOza0EP6Zcw0cp8ol6ZOpex8MavyuGmFXp4FPCVM9H682MIYfXNDCGPu/MFTJrhVaWdK/G9ng0/1ywgj9EYfbIYYlhrGb7g94aP95rX8X/O1zH/+MpRIIj0ZGUNm8YJkzI02U="),
+					test.NSEC("example.	3600	IN	NSEC	\\000.example. A NS SOA PTR HINFO MX TXT AAAA SRV NAPTR SSHFP RRSIG NSEC TLSA SMIMEA CDS CDNSKEY OPENPGPKEY SVCB HTTPS URI CAA"),
+					test.RRSIG("example.	3600	IN	RRSIG	NSEC 8 1 3600 20200219000030 20200210210030 28743 example. OHazESfxfBmBIiJGtdw7kPy7o73+TkHPAwNVIStyGj1ewXGhP4hXSTnbopfIfbS2CuUQKHfysrWsrHmSkXCGAw5RNnTSH72u0Dev2nzglHiZPoX3q++Gfsygr6H4j4QrX69z/+ir40bMPKmwka0gnP5Sna48+FAuVLDMqxXCBpw="),
 				},
 				Extra: []dns.RR{
 					test.OPT(4096, true),
@@ -660,3 +662,443 @@ func TestAllDnssec(t *testing.T) {
 		fmt.Println(strings.Repeat("-", 80))
 	}
 }
+
+var nsec3TestCase = &TestCase{
+	Name:          "nsec3",
+	Description:   "nsec3 authenticated denial of existence",
+	Enabled:       true,
+	HandlerConfig: DefaultHandlerTestConfig,
+	Initialize:    DefaultDnssecInitialize(zone2ZskPub, zone2ZskPriv, zone2KskPub, zone2KskPriv),
+	Zones:         []string{"example."},
+	ZoneConfigs: []string{
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.example.","ns":"ns1.example.","refresh":44,"retry":55,"expire":66},"dnssec":true,"nsec3":{"iterations":5,"salt":"aabbccdd"}}`,
+	},
+	Entries: [][][]string{
+		{
+			{"@",
+				`{"ns":{"ttl":300,"records":[{"host":"ns1.example."}]}}`,
+			},
+			{"www",
+				`{"a":{"ttl":300,"records":[{"ip":"1.2.3.4"}]}}`,
+			},
+			{"*.w",
+				`{"txt":{"ttl":300,"records":[{"text":"wildcard"}]}}`,
+			},
+			{"a.b",
+				`{"a":{"ttl":300,"records":[{"ip":"1.2.3.4"}]}}`,
+			},
+			{"sub",
+				`{"ns":{"ttl":300,"records":[{"host":"ns1.sub.example."}]}}`,
+			},
+		},
+	},
+}
+
+func TestNsec3(t *testing.T) {
+	g := NewGomegaWithT(t)
+	zsk, err := dns.NewRR(zone2ZskPub)
+	g.Expect(err).To(BeNil())
+
+	query := func(h *DnsRequestHandler, qname string, qtype uint16) *dns.Msg {
+		tc := test.Case{Qname: qname, Qtype: qtype, Do: true}
+		w := test.NewRecorder(&test.ResponseWriter{})
+		h.HandleRequest(NewRequestContext(w, tc.Msg()))
+		for _, rrs := range [][]dns.RR{w.Msg.Answer, w.Msg.Ns} {
+			for _, set := range types.SplitSets(rrs) {
+				if set[0].Header().Rrtype == dns.TypeRRSIG || set[0].Header().Rrtype == dns.TypeNS {
+					continue
+				}
+				signed := false
+				for _, rr := range rrs {
+					if rrsig, ok := rr.(*dns.RRSIG); ok && rrsig.Hdr.Name == set[0].Header().Name && rrsig.TypeCovered == set[0].Header().Rrtype {
+						g.Expect(rrsig.Verify(zsk.(*dns.DNSKEY), set)).To(BeNil())
+						signed = true
+					}
+				}
+				g.Expect(signed).To(BeTrue())
+			}
+		}
+		return w.Msg
+	}
+	nsec3s := func(m *dns.Msg) []*dns.NSEC3 {
+		var res []*dns.NSEC3
+		for _, rr := range m.Ns {
+			if nsec3, ok := rr.(*dns.NSEC3); ok {
+				res = append(res, nsec3)
+			}
+		}
+		return res
+	}
+	matches := func(records []*dns.NSEC3, name string) *dns.NSEC3 {
+		for _, nsec3 := range records {
+			if nsec3.Match(name) {
+				return nsec3
+			}
+		}
+		return nil
+	}
+	covers := func(records []*dns.NSEC3, name string) *dns.NSEC3 {
+		for _, nsec3 := range records {
+			if nsec3.Cover(name) {
+				return nsec3
+			}
+		}
+		return nil
+	}
+
+	h, err := nsec3TestCase.Initialize(nsec3TestCase)
+	g.Expect(err).To(BeNil())
+
+	// nsec3param
+	m := query(h, "example.", dns.TypeNSEC3PARAM)
+	g.Expect(len(m.Answer)).To(Equal(2))
+	param := m.Answer[0].(*dns.NSEC3PARAM)
+	g.Expect(param.Iterations).To(Equal(uint16(5)))
+	g.Expect(param.Salt).To(Equal("AABBCCDD"))
+
+	// nxdomain
+	m = query(h, "x.example.", dns.TypeA)
+	g.Expect(m.Rcode).To(Equal(dns.RcodeNameError))
+	records := nsec3s(m)
+	g.Expect(len(records)).To(Equal(3))
+	g.Expect(matches(records, "example.")).NotTo(BeNil())
+	g.Expect(matches(records, "example.").TypeBitMap).To(ContainElement(dns.TypeNSEC3PARAM))
+	g.Expect(covers(records, "x.example.")).NotTo(BeNil())
+	g.Expect(covers(records, "*.example.")).NotTo(BeNil())
+
+	m = query(h, "y.x.www.example.", dns.TypeA)
+	g.Expect(m.Rcode).To(Equal(dns.RcodeNameError))
+	records = nsec3s(m)
+	g.Expect(matches(records, "www.example.")).NotTo(BeNil())
+	g.Expect(covers(records, "x.www.example.")).NotTo(BeNil())
+	g.Expect(covers(records, "*.www.example.")).NotTo(BeNil())
+
+	// nodata
+	m = query(h, "www.example.", dns.TypeTXT)
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	records = nsec3s(m)
+	g.Expect(len(records)).To(Equal(1))
+	g.Expect(matches(records, "www.example.")).NotTo(BeNil())
+	g.Expect(records[0].TypeBitMap).NotTo(ContainElement(dns.TypeTXT))
+	g.Expect(records[0].TypeBitMap).NotTo(ContainElement(dns.TypeCNAME))
+
+	m = query(h, "b.example.", dns.TypeA)
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	records = nsec3s(m)
+	g.Expect(len(records)).To(Equal(1))
+	g.Expect(matches(records, "b.example.")).NotTo(BeNil())
+	g.Expect(records[0].TypeBitMap).To(BeEmpty())
+
+	// wildcard answer
+	m = query(h, "foo.w.example.", dns.TypeTXT)
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	g.Expect(len(m.Answer)).To(Equal(2))
+	g.Expect(m.Answer[1].(*dns.RRSIG).Labels).To(Equal(uint8(2)))
+	records = nsec3s(m)
+	g.Expect(len(records)).To(Equal(1))
+	g.Expect(covers(records, "foo.w.example.")).NotTo(BeNil())
+
+	// wildcard nodata
+	m = query(h, "foo.w.example.", dns.TypeA)
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	records = nsec3s(m)
+	g.Expect(len(records)).To(Equal(3))
+	g.Expect(matches(records, "w.example.")).NotTo(BeNil())
+	g.Expect(covers(records, "foo.w.example.")).NotTo(BeNil())
+	g.Expect(matches(records, "*.w.example.")).NotTo(BeNil())
+	g.Expect(matches(records, "*.w.example.").TypeBitMap).NotTo(ContainElement(dns.TypeA))
+	g.Expect(matches(records, "*.w.example.").TypeBitMap).NotTo(ContainElement(dns.TypeCNAME))
+
+	// unsigned delegation
+	m = query(h, "host.sub.example.", dns.TypeA)
+	records = nsec3s(m)
+	g.Expect(len(records)).To(Equal(1))
+	g.Expect(matches(records, "sub.example.")).NotTo(BeNil())
+	g.Expect(records[0].TypeBitMap).To(ContainElement(dns.TypeNS))
+	g.Expect(records[0].TypeBitMap).NotTo(ContainElement(dns.TypeDS))
+
+	// unsigned delegation with opt-out
+	optOut := *nsec3TestCase
+	optOut.ZoneConfigs = []string{
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.example.","ns":"ns1.example.","refresh":44,"retry":55,"expire":66},"dnssec":true,"nsec3":{"iterations":0,"opt_out":true}}`,
+	}
+	h, err = optOut.Initialize(&optOut)
+	g.Expect(err).To(BeNil())
+	m = query(h, "sub.example.", dns.TypeA)
+	records = nsec3s(m)
+	g.Expect(len(records)).To(Equal(2))
+	g.Expect(matches(records, "example.")).NotTo(BeNil())
+	g.Expect(matches(records, "example.").Flags).To(Equal(uint8(0)))
+	g.Expect(covers(records, "sub.example.")).NotTo(BeNil())
+	g.Expect(covers(records, "sub.example.").Flags).To(Equal(uint8(1)))
+}
+
+func TestCds(t *testing.T) {
+	g := NewGomegaWithT(t)
+	kskRR, err := dns.NewRR(zone2KskPub)
+	g.Expect(err).To(BeNil())
+	ksk := kskRR.(*dns.DNSKEY)
+	zskRR, err := dns.NewRR(zone2ZskPub)
+	g.Expect(err).To(BeNil())
+
+	query := func(h *DnsRequestHandler, qtype uint16) *dns.Msg {
+		tc := test.Case{Qname: "example.", Qtype: qtype, Do: true}
+		w := test.NewRecorder(&test.ResponseWriter{})
+		h.HandleRequest(NewRequestContext(w, tc.Msg()))
+		return w.Msg
+	}
+
+	signed := *nsec3TestCase
+	signed.ZoneConfigs = []string{
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.example.","ns":"ns1.example.","refresh":44,"retry":55,"expire":66},"dnssec":true}`,
+	}
+	h, err := signed.Initialize(&signed)
+	g.Expect(err).To(BeNil())
+
+	m := query(h, dns.TypeCDS)
+	g.Expect(len(m.Answer)).To(Equal(2))
+	cds := m.Answer[0].(*dns.CDS)
+	ds := ksk.ToDS(dns.SHA256)
+	g.Expect(cds.KeyTag).To(Equal(ds.KeyTag))
+	g.Expect(cds.DigestType).To(Equal(dns.SHA256))
+	g.Expect(cds.Digest).To(Equal(ds.Digest))
+	g.Expect(m.Answer[1].(*dns.RRSIG).Verify(zskRR.(*dns.DNSKEY), m.Answer[:1])).To(BeNil())
+
+	m = query(h, dns.TypeCDNSKEY)
+	g.Expect(len(m.Answer)).To(Equal(2))
+	cdnskey := m.Answer[0].(*dns.CDNSKEY)
+	g.Expect(cdnskey.Flags).To(Equal(uint16(257)))
+	g.Expect(cdnskey.PublicKey).To(Equal(ksk.PublicKey))
+
+	unsigned := *nsec3TestCase
+	unsigned.ZoneConfigs = []string{
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.example.","ns":"ns1.example.","refresh":44,"retry":55,"expire":66},"dnssec":false}`,
+	}
+	h, err = unsigned.Initialize(&unsigned)
+	g.Expect(err).To(BeNil())
+
+	m = query(h, dns.TypeCDS)
+	g.Expect(len(m.Answer)).To(Equal(0))
+	m = query(h, dns.TypeCDNSKEY)
+	g.Expect(len(m.Answer)).To(Equal(0))
+
+	deleted := *nsec3TestCase
+	deleted.ZoneConfigs = []string{
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.example.","ns":"ns1.example.","refresh":44,"retry":55,"expire":66},"dnssec":true,"cds_delete":true}`,
+	}
+	h, err = deleted.Initialize(&deleted)
+	g.Expect(err).To(BeNil())
+
+	m = query(h, dns.TypeCDS)
+	g.Expect(len(m.Answer)).To(Equal(2))
+	cds = m.Answer[0].(*dns.CDS)
+	g.Expect(cds.KeyTag).To(Equal(uint16(0)))
+	g.Expect(cds.Algorithm).To(Equal(uint8(0)))
+	g.Expect(cds.Digest).To(Equal("00"))
+	g.Expect(m.Answer[1].(*dns.RRSIG).Verify(zskRR.(*dns.DNSKEY), m.Answer[:1])).To(BeNil())
+	m = query(h, dns.TypeCDNSKEY)
+	g.Expect(len(m.Answer)).To(Equal(2))
+	cdnskey = m.Answer[0].(*dns.CDNSKEY)
+	g.Expect(cdnskey.Flags).To(Equal(uint16(0)))
+	g.Expect(cdnskey.Algorithm).To(Equal(uint8(0)))
+	g.Expect(cdnskey.PublicKey).To(Equal("AA=="))
+	g.Expect(m.Answer[1].(*dns.RRSIG).Verify(zskRR.(*dns.DNSKEY), m.Answer[:1])).To(BeNil())
+}
+
+func TestDNameDnssec(t *testing.T) {
+	g := NewGomegaWithT(t)
+	zsk, err := dns.NewRR(zone2ZskPub)
+	g.Expect(err).To(BeNil())
+
+	query := func(h *DnsRequestHandler, qname string, qtype uint16) *dns.Msg {
+		tc := test.Case{Qname: qname, Qtype: qtype, Do: true}
+		w := test.NewRecorder(&test.ResponseWriter{})
+		h.HandleRequest(NewRequestContext(w, tc.Msg()))
+		return w.Msg
+	}
+	signature := func(rrs []dns.RR, name string, rtype uint16) *dns.RRSIG {
+		for _, rr := range rrs {
+			if rrsig, ok := rr.(*dns.RRSIG); ok && rrsig.Hdr.Name == name && rrsig.TypeCovered == rtype {
+				return rrsig
+			}
+		}
+		return nil
+	}
+	verify := func(m *dns.Msg, name string, rtype uint16) {
+		var set []dns.RR
+		for _, rr := range m.Answer {
+			if rr.Header().Name == name && rr.Header().Rrtype == rtype {
+				set = append(set, rr)
+			}
+		}
+		g.Expect(set).NotTo(BeEmpty())
+		rrsig := signature(m.Answer, name, rtype)
+		g.Expect(rrsig).NotTo(BeNil())
+		g.Expect(rrsig.Verify(zsk.(*dns.DNSKEY), set)).To(BeNil())
+	}
+
+	dname := *nsec3TestCase
+	dname.ZoneConfigs = []string{
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.example.","ns":"ns1.example.","refresh":44,"retry":55,"expire":66},"dnssec":true}`,
+	}
+	dname.Entries = [][][]string{
+		append(nsec3TestCase.Entries[0], []string{"old", `{"dname":{"ttl":300, "target":"example."}}`}),
+	}
+	h, err := dname.Initialize(&dname)
+	g.Expect(err).To(BeNil())
+
+	// dname and final answer are signed, synthesized cname is not
+	m := query(h, "www.old.example.", dns.TypeA)
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	verify(m, "old.example.", dns.TypeDNAME)
+	verify(m, "www.example.", dns.TypeA)
+	g.Expect(m.Answer).To(ContainElement(test.CNAME("www.old.example. 300 IN CNAME www.example.")))
+	g.Expect(signature(m.Answer, "www.old.example.", dns.TypeCNAME)).To(BeNil())
+
+	// denial of existence for synthesized target
+	m = query(h, "x.old.example.", dns.TypeA)
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	verify(m, "old.example.", dns.TypeDNAME)
+	g.Expect(signature(m.Answer, "x.old.example.", dns.TypeCNAME)).To(BeNil())
+	g.Expect(signature(m.Ns, "x.example.", dns.TypeNSEC)).NotTo(BeNil())
+
+	m = query(h, "old.example.", dns.TypeDNAME)
+	verify(m, "old.example.", dns.TypeDNAME)
+}
+
+func TestEd25519(t *testing.T) {
+	g := NewGomegaWithT(t)
+	zskPub, zskPriv, err := dnssec.GenerateKey("example.", "zsk", dns.ED25519, 300)
+	g.Expect(err).To(BeNil())
+	kskPub, kskPriv, err := dnssec.GenerateKey("example.", "ksk", dns.ED25519, 300)
+	g.Expect(err).To(BeNil())
+	zsk, err := dns.NewRR(zskPub)
+	g.Expect(err).To(BeNil())
+	ksk, err := dns.NewRR(kskPub)
+	g.Expect(err).To(BeNil())
+
+	query := func(h *DnsRequestHandler, qname string, qtype uint16) *dns.Msg {
+		tc := test.Case{Qname: qname, Qtype: qtype, Do: true}
+		w := test.NewRecorder(&test.ResponseWriter{})
+		h.HandleRequest(NewRequestContext(w, tc.Msg()))
+		return w.Msg
+	}
+
+	tc := *nsec3TestCase
+	tc.Initialize = DefaultDnssecInitialize(zskPub, zskPriv, kskPub, kskPriv)
+	h, err := tc.Initialize(&tc)
+	g.Expect(err).To(BeNil())
+
+	m := query(h, "www.example.", dns.TypeA)
+	g.Expect(len(m.Answer)).To(Equal(2))
+	sig := m.Answer[1].(*dns.RRSIG)
+	g.Expect(sig.Algorithm).To(Equal(dns.ED25519))
+	g.Expect(sig.Verify(zsk.(*dns.DNSKEY), m.Answer[:1])).To(BeNil())
+
+	m = query(h, "example.", dns.TypeDNSKEY)
+	g.Expect(len(m.Answer)).To(Equal(3))
+	g.Expect(m.Answer[2].(*dns.RRSIG).Verify(ksk.(*dns.DNSKEY), m.Answer[:2])).To(BeNil())
+}
+
+func TestEd448(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// rfc8080 section 6 example
+	kskRR, err := dns.NewRR("example.com. 3600 IN DNSKEY 257 3 16 3kgROaDjrh0H2iuixWBrc8g2EpBBLCdGzHmn+G2MpTPhpj/OiBVHHSfPodx1FYYUcJKm1MDpJtIA")
+	g.Expect(err).To(BeNil())
+	ksk := kskRR.(*dns.DNSKEY)
+	g.Expect(ksk.KeyTag()).To(Equal(uint16(9713)))
+	priv, err := dnssec.NewPrivateKey(ksk, "Private-key-format: v1.2\nAlgorithm: 16 (ED448)\nPrivateKey: xZ+5Cgm463xugtkY5B0Jx6erFTXp13rYegst0qRtNsOYnaVpMx0Z/c5EiA9x8wWbDDct/U3FhYWA\n")
+	g.Expect(err).To(BeNil())
+	mx, err := dns.NewRR("example.com. 3600 IN MX 10 mail.example.com.")
+	g.Expect(err).To(BeNil())
+	key := &types.ZoneKey{DnsKey: ksk, PrivateKey: priv, KeyInception: 1438207200, KeyExpiration: 1440021600}
+	rrsig := dnssec.SignRRSet([]dns.RR{mx}, "example.com.", key, 3600)
+	g.Expect(rrsig).NotTo(BeNil())
+	g.Expect(rrsig.String()).To(Equal("example.com.\t3600\tIN\tRRSIG\tMX 16 2 3600 20150819220000 20150729220000 9713 example.com. 3cPAHkmlnxcDHMyg7vFC34l0blBhuG1qpwLmjInI8w1CMB29FkEAIJUA0amxWndkmnBZ6SKiwZSAxGILn/NBtOXft0+Gj7FSvOKxE/07+4RQvE581N3Aj/JtIyaiYVdnYtyMWbSNyGEY2213WKsJlwEA"))
+	g.Expect(dnssec.Verify(rrsig, ksk, []dns.RR{mx})).To(BeNil())
+	mx.(*dns.MX).Preference = 20
+	g.Expect(dnssec.Verify(rrsig, ksk, []dns.RR{mx})).To(Equal(dnssec.ErrInvalidSignature))
+
+	zskPub, zskPriv, err := dnssec.GenerateKey("example.", "zsk", dns.ED448, 300)
+	g.Expect(err).To(BeNil())
+	kskPub, kskPriv, err := dnssec.GenerateKey("example.", "ksk", dns.ED448, 300)
+	g.Expect(err).To(BeNil())
+	zsk, err := dns.NewRR(zskPub)
+	g.Expect(err).To(BeNil())
+	kskRR, err = dns.NewRR(kskPub)
+	g.Expect(err).To(BeNil())
+
+	query := func(h *DnsRequestHandler, qname string, qtype uint16) *dns.Msg {
+		tc := test.Case{Qname: qname, Qtype: qtype, Do: true}
+		w := test.NewRecorder(&test.ResponseWriter{})
+		h.HandleRequest(NewRequestContext(w, tc.Msg()))
+		return w.Msg
+	}
+
+	tc := *nsec3TestCase
+	tc.Initialize = DefaultDnssecInitialize(zskPub, zskPriv, kskPub, kskPriv)
+	h, err := tc.Initialize(&tc)
+	g.Expect(err).To(BeNil())
+
+	m := query(h, "www.example.", dns.TypeA)
+	g.Expect(len(m.Answer)).To(Equal(2))
+	sig := m.Answer[1].(*dns.RRSIG)
+	g.Expect(sig.Algorithm).To(Equal(dns.ED448))
+	g.Expect(dnssec.Verify(sig, zsk.(*dns.DNSKEY), m.Answer[:1])).To(BeNil())
+
+	// wildcard answer is signed as wildcard owner
+	m = query(h, "foo.w.example.", dns.TypeTXT)
+	g.Expect(len(m.Answer)).To(Equal(2))
+	g.Expect(dnssec.Verify(m.Answer[1].(*dns.RRSIG), zsk.(*dns.DNSKEY), m.Answer[:1])).To(BeNil())
+
+	m = query(h, "example.", dns.TypeDNSKEY)
+	g.Expect(len(m.Answer)).To(Equal(3))
+	g.Expect(dnssec.Verify(m.Answer[2].(*dns.RRSIG), kskRR.(*dns.DNSKEY), m.Answer[:2])).To(BeNil())
+}
+
+func TestSignatureCache(t *testing.T) {
+	g := NewGomegaWithT(t)
+	zsk, err := dns.NewRR(zone2ZskPub)
+	g.Expect(err).To(BeNil())
+
+	query := func(h *DnsRequestHandler, qname string) *dns.RRSIG {
+		tc := test.Case{Qname: qname, Qtype: dns.TypeTXT, Do: true}
+		w := test.NewRecorder(&test.ResponseWriter{})
+		h.HandleRequest(NewRequestContext(w, tc.Msg()))
+		g.Expect(len(w.Msg.Answer)).To(Equal(2))
+		rrsig := w.Msg.Answer[1].(*dns.RRSIG)
+		g.Expect(rrsig.Verify(zsk.(*dns.DNSKEY), w.Msg.Answer[:1])).To(BeNil())
+		time.Sleep(10 * time.Millisecond)
+		return rrsig
+	}
+
+	tc := *nsec3TestCase
+	tc.HandlerConfig.SignatureCache = dnssec.SignatureCacheConfig{Size: 1000, Refresh: 3600}
+	h, err := tc.Initialize(&tc)
+	g.Expect(err).To(BeNil())
+
+	// answer and nsec3 proof of wildcard expansion are signed separately
+	first := query(h, "a.w.example.")
+	g.Expect(h.Signatures.Misses()).To(Equal(uint64(2)))
+	g.Expect(query(h, "a.w.example.").Signature).To(Equal(first.Signature))
+	g.Expect(h.Signatures.Hits()).To(Equal(uint64(2)))
+
+	// different expansion of the same wildcard is a different rrset
+	query(h, "b.w.example.")
+	g.Expect(h.Signatures.Misses()).To(Equal(uint64(4)))
+
+	h.Signatures.Invalidate("example.")
+	g.Expect(query(h, "a.w.example.").Signature).To(Equal(first.Signature))
+	g.Expect(h.Signatures.Misses()).To(Equal(uint64(6)))
+	g.Expect(h.Signatures.Hits()).To(Equal(uint64(2)))
+
+	// signatures expiring within refresh period are never served from cache
+	tc.HandlerConfig.SignatureCache = dnssec.SignatureCacheConfig{Size: 1000, Refresh: 30 * 24 * 3600}
+	h, err = tc.Initialize(&tc)
+	g.Expect(err).To(BeNil())
+	query(h, "a.w.example.")
+	query(h, "a.w.example.")
+	g.Expect(h.Signatures.Hits()).To(Equal(uint64(0)))
+	g.Expect(h.Signatures.Misses()).To(Equal(uint64(4)))
+}
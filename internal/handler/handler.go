@@ -1,8 +1,13 @@
 package handler
 
 import (
+	"encoding/hex"
+	"github.com/hawell/z42/internal/cookie"
 	"github.com/hawell/z42/internal/geotools"
+	"github.com/hawell/z42/internal/metrics"
+	"github.com/hawell/z42/internal/rrl"
 	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/internal/tsig"
 	"github.com/hawell/z42/pkg/geoip"
 	"go.uber.org/zap"
 	"net"
@@ -18,19 +23,36 @@ import (
 )
 
 type DnsRequestHandler struct {
-	Config        *DnsRequestHandlerConfig
-	RedisData     *storage.DataHandler
-	requestLogger *zap.Logger
-	geoip         *geoip.GeoIp
-	upstream      *upstream.Upstream
-	quit          chan struct{}
-	quitWG        sync.WaitGroup
+	Config              *DnsRequestHandlerConfig
+	RedisData           *storage.DataHandler
+	Keyring             *tsig.Keyring
+	Signatures          *dnssec.SignatureCache
+	Cookies             *cookie.Cookies
+	responseLimiter     *rrl.RateLimiter
+	requestLogger       *zap.Logger
+	geoip               *geoip.GeoIp
+	upstream            *upstream.Upstream
+	quit                chan struct{}
+	quitWG              sync.WaitGroup
+	updateLock          sync.Mutex
+	removeUpdateHandler func()
 }
 
 type DnsRequestHandlerConfig struct {
-	Upstream          []upstream.Config `json:"upstream"`
-	GeoIp             geoip.Config      `json:"geoip"`
-	LogSourceLocation bool              `json:"log_source_location"`
+	Upstream          []upstream.Config           `json:"upstream"`
+	GeoIp             geoip.Config                `json:"geoip"`
+	LogSourceLocation bool                        `json:"log_source_location"`
+	Tsig              tsig.Config                 `json:"tsig"`
+	SignatureCache    dnssec.SignatureCacheConfig `json:"signature_cache"`
+	Ecs               EcsConfig                   `json:"ecs"`
+	Cookie            cookie.Config               `json:"cookie"`
+	Rrl               rrl.Config                  `json:"rrl"`
+}
+
+// EcsConfig limits the client subnet prefix used for geo filtering, 0 means no limit
+type EcsConfig struct {
+	MaxSourcePrefixV4 uint8 `json:"max_source_prefix_v4"`
+	MaxSourcePrefixV6 uint8 `json:"max_source_prefix_v6"`
 }
 
 func NewHandler(config *DnsRequestHandlerConfig, redisData *storage.DataHandler, requestLogger *zap.Logger) *DnsRequestHandler {
@@ -42,6 +64,11 @@ func NewHandler(config *DnsRequestHandlerConfig, redisData *storage.DataHandler,
 
 	h.geoip = geoip.NewGeoIp(&config.GeoIp)
 	h.upstream = upstream.NewUpstream(config.Upstream)
+	h.Keyring = tsig.NewKeyring(&config.Tsig, redisData)
+	h.Signatures = dnssec.NewSignatureCache(&config.SignatureCache)
+	h.removeUpdateHandler = redisData.OnZoneUpdate(h.Signatures.Invalidate)
+	h.Cookies = cookie.NewCookies(&config.Cookie, redisData)
+	h.responseLimiter = rrl.NewRateLimiter(&config.Rrl)
 	h.quit = make(chan struct{})
 
 	return h
@@ -51,12 +78,84 @@ func (h *DnsRequestHandler) ShutDown() {
 	zap.L().Debug("handler : stopping")
 	close(h.quit)
 	h.quitWG.Wait()
+	h.removeUpdateHandler()
+	h.Cookies.ShutDown()
 	zap.L().Debug("handler : stopped")
 }
 
+// CheckCookie validates dns cookie of request and sets cookie of response, true is returned for requests with a valid server cookie.
+// requests with malformed cookies and, if configured, udp requests without a valid server cookie get a FORMERR or BADCOOKIE result in context.Res
+func (h *DnsRequestHandler) CheckCookie(context *RequestContext) bool {
+	opt := context.Req.IsEdns0()
+	if opt == nil || h.Cookies == nil {
+		return false
+	}
+	var value []byte
+	for _, o := range opt.Option {
+		if c, ok := o.(*dns.EDNS0_COOKIE); ok {
+			var err error
+			if value, err = hex.DecodeString(c.Cookie); err != nil {
+				value = []byte{}
+			}
+			break
+		}
+	}
+	status, response := h.Cookies.Check(value, net.ParseIP(context.IP()), time.Now())
+	context.cookie = response
+	switch status {
+	case cookie.StatusMalformed:
+		context.Res = dns.RcodeFormatError
+	case cookie.StatusClientOnly, cookie.StatusInvalid:
+		if h.Cookies.BadCookie() && context.Proto() == "udp" {
+			context.Res = dns.RcodeBadCookie
+		}
+	case cookie.StatusValid:
+		context.cookieValid = true
+		return true
+	}
+	return false
+}
+
 func (h *DnsRequestHandler) response(context *RequestContext) {
 	h.logRequest(context)
+	zone := ""
+	if context.zone != nil {
+		zone = context.zone.Name
+	}
+	metrics.Queries.WithLabelValues(metrics.Zone(zone), metrics.QType(context.QType()), dns.RcodeToString[context.Res]).Inc()
+	switch h.limitResponse(context) {
+	case rrl.ActionDrop:
+		metrics.RateLimited.WithLabelValues("rrl", "drop").Inc()
+		return
+	case rrl.ActionSlip:
+		metrics.RateLimited.WithLabelValues("rrl", "slip").Inc()
+		context.slip()
+	}
 	context.Response()
+	metrics.QueryDuration.WithLabelValues(context.Proto()).Observe(time.Since(context.StartTime).Seconds())
+}
+
+// limitResponse applies response rate limiting to udp responses, tcp clients and clients with a valid cookie cannot be spoofed
+func (h *DnsRequestHandler) limitResponse(context *RequestContext) rrl.Action {
+	if h.responseLimiter == nil || context.Proto() != "udp" || context.cookieValid {
+		return rrl.ActionSend
+	}
+	category := rrl.CategoryResponse
+	name := context.RawName()
+	if context.matchedWildcard != "" {
+		name = context.matchedWildcard
+	}
+	switch context.Res {
+	case dns.RcodeSuccess:
+	case dns.RcodeNameError:
+		category = rrl.CategoryNxdomain
+		if context.zone != nil {
+			name = context.zone.Name
+		}
+	default:
+		category = rrl.CategoryError
+	}
+	return h.responseLimiter.Check(net.ParseIP(context.IP()), category, name, context.QType(), time.Now())
 }
 
 func (h *DnsRequestHandler) HandleRequest(context *RequestContext) {
@@ -66,6 +165,16 @@ func (h *DnsRequestHandler) HandleRequest(context *RequestContext) {
 		zap.String("query", context.RawName()),
 		zap.String("type", context.Type()),
 	)
+	if context.ecsError {
+		zap.L().Debug(
+			"invalid client subnet",
+			zap.Uint16("id", context.Req.Id),
+		)
+		context.Res = dns.RcodeFormatError
+		h.response(context)
+		return
+	}
+
 	if h.Config.LogSourceLocation {
 		sourceIP := context.SourceIp
 		context.SourceCountry, _ = h.geoip.GetCountry(sourceIP)
@@ -95,12 +204,25 @@ func (h *DnsRequestHandler) HandleRequest(context *RequestContext) {
 		return
 	}
 	context.DomainUid = context.zone.Config.DomainId
+	context.applyEcs(&h.Config.Ecs, context.zone.Config.Ecs)
+
+	if context.Req.Opcode == dns.OpcodeUpdate {
+		h.handleUpdate(context)
+		return
+	}
+
+	if context.QType() == dns.TypeAXFR || context.QType() == dns.TypeIXFR {
+		h.handleTransfer(context)
+		return
+	}
 
 	context.dnssec = context.Do() && context.Auth && context.zone.Config.DnsSec
 	cnameFlattening := context.dnssec || context.zone.Config.CnameFlattening
 
 	loopCount := 0
 	currentQName := context.RawName()
+	// answers are owned by target of last synthesized cname if a dname is followed
+	ownerName := context.RawName()
 loop:
 	for {
 		if loopCount > 10 {
@@ -128,7 +250,20 @@ loop:
 			break loop
 		}
 
+		target, res := h.ancestorDName(context, currentQName)
+		if res != dns.RcodeSuccess {
+			context.Res = res
+			break loop
+		}
+		if target != "" {
+			currentQName, ownerName = target, target
+			continue
+		}
+
 		location, match := context.zone.FindLocation(currentQName)
+		if match == types.WildCardMatch && loopCount == 1 {
+			context.matchedWildcard = location + "." + context.zone.Name
+		}
 		switch match {
 		case types.NoMatch:
 			zap.L().Debug(
@@ -184,7 +319,7 @@ loop:
 					break loop
 				}
 				if ds.Empty() {
-					addNSec(context, cutPoint, dns.TypeDS)
+					addDelegationNSec(context, cutPoint)
 				}
 				context.Authority = append(context.Authority, ds.Value(cutPoint)...)
 				for _, ns := range ns.Data {
@@ -193,12 +328,12 @@ loop:
 						glueA, err := h.RedisData.A(context.zone.Name, glueLocation)
 						// XXX : should we return with RcodeServerFailure?
 						if err == nil {
-							ips := h.filter(context.SourceIp, glueA)
+							ips := h.filter(context, glueA)
 							context.Additional = append(context.Additional, generateA(ns.Host, glueA.Ttl(), ips)...)
 						}
 						glueAAAA, err := h.RedisData.AAAA(context.zone.Name, glueLocation)
 						if err == nil {
-							ips := h.filter(context.SourceIp, glueAAAA)
+							ips := h.filter(context, glueAAAA)
 							context.Additional = append(context.Additional, generateAAAA(ns.Host, glueAAAA.Ttl(), ips)...)
 						}
 					}
@@ -237,7 +372,7 @@ loop:
 				if !cnameFlattening {
 					context.Answer = append(context.Answer, cname.Value(currentQName)...)
 				} else if h.RedisData.FindZone(cname.Host) != zoneName {
-					context.Answer = append(context.Answer, cname.Value(context.RawName())...)
+					context.Answer = append(context.Answer, cname.Value(ownerName)...)
 					context.Res = dns.RcodeSuccess
 					break loop
 				}
@@ -261,7 +396,7 @@ loop:
 						break loop
 					}
 					if ds.Empty() {
-						addNSec(context, currentQName, dns.TypeDS)
+						addDelegationNSec(context, currentQName)
 					} else {
 						if context.QType() == dns.TypeDS {
 							context.Answer = append(context.Answer, ds.Value(currentQName)...)
@@ -274,17 +409,7 @@ loop:
 					for _, data := range ns.Data {
 						glueLocation, match := context.zone.FindLocation(data.Host)
 						if match != types.NoMatch {
-							glueA, err := h.RedisData.A(context.zone.Name, glueLocation)
-							// XXX : should we return with RcodeServerFailure?
-							if err == nil {
-								ips := h.filter(context.SourceIp, glueA)
-								context.Additional = append(context.Additional, generateA(data.Host, glueA.Ttl(), ips)...)
-							}
-							glueAAAA, err := h.RedisData.AAAA(context.zone.Name, glueLocation)
-							if err == nil {
-								ips := h.filter(context.SourceIp, glueAAAA)
-								context.Additional = append(context.Additional, generateAAAA(data.Host, glueAAAA.Ttl(), ips)...)
-							}
+							context.Additional = append(context.Additional, h.addresses(context, data.Host, glueLocation)...)
 						}
 					}
 					context.Res = dns.RcodeSuccess
@@ -298,7 +423,7 @@ loop:
 				zap.String("qname", currentQName),
 			)
 			if cnameFlattening {
-				currentQName = context.RawName()
+				currentQName = ownerName
 			}
 			var answer []dns.RR
 			switch context.QType() {
@@ -319,7 +444,7 @@ loop:
 					ips, context.Res, ttl = h.findANAME(context, aname.Location, dns.TypeA)
 				} else {
 					ttl = a.Ttl()
-					ips = h.filter(context.SourceIp, a)
+					ips = h.filter(context, a)
 				}
 				answer = generateA(currentQName, ttl, ips)
 			case dns.TypeAAAA:
@@ -339,7 +464,7 @@ loop:
 					ips, context.Res, ttl = h.findANAME(context, aname.Location, dns.TypeAAAA)
 				} else {
 					ttl = aaaa.Ttl()
-					ips = h.filter(context.SourceIp, aaaa)
+					ips = h.filter(context, aaaa)
 				}
 				answer = generateAAAA(currentQName, ttl, ips)
 			case dns.TypeCNAME:
@@ -398,14 +523,91 @@ loop:
 					break loop
 				}
 				answer = tlsa.Value(currentQName)
+			case dns.TypeSSHFP:
+				sshfp, err := h.RedisData.SSHFP(context.zone.Name, location)
+				if err != nil {
+					context.Res = dns.RcodeServerFailure
+					break loop
+				}
+				answer = sshfp.Value(currentQName)
+			case dns.TypeNAPTR:
+				naptr, err := h.RedisData.NAPTR(context.zone.Name, location)
+				if err != nil {
+					context.Res = dns.RcodeServerFailure
+					break loop
+				}
+				answer = naptr.Value(currentQName)
+			case dns.TypeURI:
+				uri, err := h.RedisData.URI(context.zone.Name, location)
+				if err != nil {
+					context.Res = dns.RcodeServerFailure
+					break loop
+				}
+				answer = uri.Value(currentQName)
+			case dns.TypeHINFO:
+				hinfo, err := h.RedisData.HINFO(context.zone.Name, location)
+				if err != nil {
+					context.Res = dns.RcodeServerFailure
+					break loop
+				}
+				answer = hinfo.Value(currentQName)
+			case dns.TypeSMIMEA:
+				smimea, err := h.RedisData.SMIMEA(context.zone.Name, location)
+				if err != nil {
+					context.Res = dns.RcodeServerFailure
+					break loop
+				}
+				answer = smimea.Value(currentQName)
+			case dns.TypeOPENPGPKEY:
+				openpgpkey, err := h.RedisData.OPENPGPKEY(context.zone.Name, location)
+				if err != nil {
+					context.Res = dns.RcodeServerFailure
+					break loop
+				}
+				answer = openpgpkey.Value(currentQName)
+			case dns.TypeSVCB:
+				svcb, err := h.RedisData.SVCB(context.zone.Name, location)
+				if err != nil {
+					context.Res = dns.RcodeServerFailure
+					break loop
+				}
+				answer = svcb.Value(currentQName)
+				h.addServiceTargets(context, currentQName, location, svcb.Data)
+			case dns.TypeHTTPS:
+				https, err := h.RedisData.HTTPS(context.zone.Name, location)
+				if err != nil {
+					context.Res = dns.RcodeServerFailure
+					break loop
+				}
+				answer = https.Value(currentQName)
+				h.addServiceTargets(context, currentQName, location, https.Data)
+			case dns.TypeDNAME:
+				dname, err := h.RedisData.DNAME(context.zone.Name, location)
+				if err != nil {
+					context.Res = dns.RcodeServerFailure
+					break loop
+				}
+				answer = dname.Value(currentQName)
 			case dns.TypeSOA:
 				answer = []dns.RR{context.zone.Config.SOA.Data}
 			case dns.TypeDNSKEY:
 				if context.zone.Config.DnsSec {
-					answer = []dns.RR{context.zone.ZSK.DnsKey, context.zone.KSK.DnsKey}
+					answer = context.zone.DnsKeys
 				}
 			case dns.TypeDS:
 				answer = []dns.RR{}
+			case dns.TypeCDS:
+				if currentQName == context.zone.Name {
+					answer = dnssec.CDS(context.zone)
+				}
+			case dns.TypeCDNSKEY:
+				if currentQName == context.zone.Name {
+					answer = dnssec.CDNSKEY(context.zone)
+				}
+			case dns.TypeNSEC3PARAM:
+				if context.zone.Config.DnsSec && context.zone.Config.Nsec3 != nil && currentQName == context.zone.Name {
+					answer = []dns.RR{dnssec.Nsec3Param(context.zone)}
+				}
 			default:
 				context.Answer = []dns.RR{}
 				context.Authority = []dns.RR{context.zone.Config.SOA.Data}
@@ -418,12 +620,14 @@ loop:
 				if context.Res == dns.RcodeSuccess {
 					context.Authority = append(context.Authority, context.zone.Config.SOA.Data)
 				}
+			} else if match == types.WildCardMatch {
+				addWildcardNSec(context, currentQName, location)
 			}
 			break loop
 		}
 	}
 
-	applyDnssec(context)
+	h.applyDnssec(context)
 
 	h.response(context)
 	zap.L().Debug(
@@ -434,8 +638,52 @@ loop:
 	)
 }
 
-func (h *DnsRequestHandler) filter(sourceIp net.IP, rrset *types.IP_RRSet) []net.IP {
+// addresses returns filtered A and AAAA records of location with name as owner
+func (h *DnsRequestHandler) addresses(context *RequestContext, name string, location string) []dns.RR {
+	var res []dns.RR
+	a, err := h.RedisData.A(context.zone.Name, location)
+	// XXX : should we return with RcodeServerFailure?
+	if err == nil {
+		res = append(res, generateA(name, a.Ttl(), h.filter(context, a))...)
+	}
+	aaaa, err := h.RedisData.AAAA(context.zone.Name, location)
+	if err == nil {
+		res = append(res, generateAAAA(name, aaaa.Ttl(), h.filter(context, aaaa))...)
+	}
+	return res
+}
+
+// addServiceTargets adds addresses of in-zone svcb targets to additional section, "." target refers to owner name in service mode and means no service in alias mode
+func (h *DnsRequestHandler) addServiceTargets(context *RequestContext, name string, location string, records []types.SVCB_RR) {
+	added := make(map[string]bool)
+	for _, rr := range records {
+		target, targetLocation := dns.Fqdn(rr.Target), location
+		if target == "." {
+			if rr.Priority == 0 {
+				continue
+			}
+			target = name
+		} else {
+			if !dns.IsSubDomain(context.zone.Name, target) {
+				continue
+			}
+			var match int
+			targetLocation, match = context.zone.FindLocation(target)
+			if match == types.NoMatch {
+				continue
+			}
+		}
+		if added[target] {
+			continue
+		}
+		added[target] = true
+		context.Additional = append(context.Additional, h.addresses(context, target, targetLocation)...)
+	}
+}
+
+func (h *DnsRequestHandler) filter(context *RequestContext, rrset *types.IP_RRSet) []net.IP {
 	mask := make([]int, len(rrset.Data))
+	sourceIp := context.SourceIp
 	// TODO: filterHealthCheck in redisStat
 	//mask = h.healthcheck.FilterHealthcheck(name, rrset, mask)
 	switch rrset.FilterConfig.GeoFilter {
@@ -449,7 +697,9 @@ func (h *DnsRequestHandler) filter(sourceIp net.IP, rrset *types.IP_RRSet) []net
 	case "location":
 		mask, _ = geotools.GetMinimumDistance(h.geoip, sourceIp, rrset.Data, mask)
 	default:
+		return orderIps(rrset, mask)
 	}
+	context.useEcs()
 
 	return orderIps(rrset, mask)
 }
@@ -673,7 +923,7 @@ func (h *DnsRequestHandler) findANAME(context *RequestContext, aname string, qty
 			}
 			if !a.Empty() {
 				zap.L().Debug("found a")
-				return h.filter(context.SourceIp, a), dns.RcodeSuccess, a.TtlValue
+				return h.filter(context, a), dns.RcodeSuccess, a.TtlValue
 			}
 		} else if qtype == dns.TypeAAAA {
 			aaaa, err := h.RedisData.AAAA(context.zone.Name, location)
@@ -682,7 +932,7 @@ func (h *DnsRequestHandler) findANAME(context *RequestContext, aname string, qty
 			}
 			if !aaaa.Empty() {
 				zap.L().Debug("found aaaa")
-				return h.filter(context.SourceIp, aaaa), dns.RcodeSuccess, aaaa.TtlValue
+				return h.filter(context, aaaa), dns.RcodeSuccess, aaaa.TtlValue
 			}
 		}
 
@@ -700,10 +950,60 @@ func (h *DnsRequestHandler) findANAME(context *RequestContext, aname string, qty
 	}
 }
 
+// ancestorDName follows dname of topmost ancestor of qname having one, names below a dname owner are occluded (rfc6672 section 2.4)
+func (h *DnsRequestHandler) ancestorDName(context *RequestContext, qname string) (string, int) {
+	for _, location := range context.zone.Ancestors(qname) {
+		target, res := h.dname(context, qname, location)
+		if res != dns.RcodeSuccess || target != "" {
+			return target, res
+		}
+	}
+	return "", dns.RcodeSuccess
+}
+
+// dname adds dname at ancestor location of qname and cname synthesized from it to answer (rfc6672 section 3.2)
+// it returns target of synthesized cname, target is empty if location has no dname
+func (h *DnsRequestHandler) dname(context *RequestContext, qname string, location string) (string, int) {
+	dname, err := h.RedisData.DNAME(context.zone.Name, location)
+	if err != nil {
+		return "", dns.RcodeServerFailure
+	}
+	if dname.Empty() {
+		return "", dns.RcodeSuccess
+	}
+	owner := context.zone.Name
+	if location != "@" {
+		owner = location + "." + context.zone.Name
+	}
+	context.Answer = append(context.Answer, dname.Value(owner)...)
+	cname, ok := dname.Synthesize(qname, owner)
+	if !ok {
+		zap.L().Debug(
+			"synthesized name too long",
+			zap.Uint16("id", context.Req.Id),
+			zap.String("qname", qname),
+			zap.String("dname", owner),
+		)
+		return "", dns.RcodeYXDomain
+	}
+	zap.L().Debug(
+		"dname substitution",
+		zap.Uint16("id", context.Req.Id),
+		zap.String("source", qname),
+		zap.String("destination", cname.Target),
+	)
+	context.Answer = append(context.Answer, cname)
+	return cname.Target, dns.RcodeSuccess
+}
+
 func addNSec(context *RequestContext, name string, qtype uint16) {
 	if !context.dnssec {
 		return
 	}
+	if context.zone.Config.Nsec3 != nil {
+		addNSec3(context, name, qtype)
+		return
+	}
 	var bitmap []uint16
 	if name == context.zone.Name {
 		context.Res = dns.RcodeSuccess
@@ -729,12 +1029,83 @@ func addNSec(context *RequestContext, name string, qtype uint16) {
 	context.Authority = append(context.Authority, nsec)
 }
 
-func applyDnssec(context *RequestContext) {
+// addNSec3 adds white lie nsec3 records proving nonexistence of name or qtype at name
+func addNSec3(context *RequestContext, name string, qtype uint16) {
+	z := context.zone
+	if context.Res == dns.RcodeNameError {
+		ce := z.ClosestEncloser(name)
+		context.Authority = append(context.Authority,
+			dnssec.MatchingNsec3(ce, z, nsec3Bitmap(z, ce)),
+			dnssec.CoveringNsec3(dnssec.NextCloser(name, ce), z, false),
+			dnssec.CoveringNsec3("*."+ce, z, false),
+		)
+		return
+	}
+	location, match := z.FindLocation(name)
+	if match == types.WildCardMatch && name != z.Name {
+		wildcard := location + "." + z.Name
+		ce := strings.TrimPrefix(wildcard, "*.")
+		context.Authority = append(context.Authority,
+			dnssec.MatchingNsec3(ce, z, nsec3Bitmap(z, ce)),
+			dnssec.CoveringNsec3(dnssec.NextCloser(name, ce), z, false),
+			dnssec.MatchingNsec3(wildcard, z, dnssec.FilterNsecBitmap(qtype, dnssec.Nsec3BitmapZone)),
+		)
+		return
+	}
+	context.Authority = append(context.Authority, dnssec.MatchingNsec3(name, z, dnssec.FilterNsecBitmap(qtype, nsec3Bitmap(z, name))))
+}
+
+// addDelegationNSec proves absence of DS records at an unsigned delegation
+func addDelegationNSec(context *RequestContext, cut string) {
+	if !context.dnssec {
+		return
+	}
+	z := context.zone
+	if z.Config.Nsec3 == nil {
+		addNSec(context, cut, dns.TypeDS)
+		return
+	}
+	if z.Config.Nsec3.OptOut {
+		ce := cut[dns.Split(cut)[1]:]
+		context.Authority = append(context.Authority,
+			dnssec.MatchingNsec3(ce, z, nsec3Bitmap(z, ce)),
+			dnssec.CoveringNsec3(cut, z, true),
+		)
+		return
+	}
+	context.Authority = append(context.Authority, dnssec.MatchingNsec3(cut, z, dnssec.FilterNsecBitmap(dns.TypeDS, dnssec.Nsec3BitmapSubDelegation)))
+}
+
+// addWildcardNSec proves that name does not exist for answers synthesized from wildcard location
+func addWildcardNSec(context *RequestContext, name string, location string) {
+	if !context.dnssec || context.zone.Config.Nsec3 == nil {
+		return
+	}
+	wildcard := location + "." + context.zone.Name
+	ce := strings.TrimPrefix(wildcard, "*.")
+	if name == ce || !dns.IsSubDomain(ce, name) {
+		return
+	}
+	context.wildcard, context.expanded = wildcard, name
+	context.Authority = append(context.Authority, dnssec.CoveringNsec3(dnssec.NextCloser(name, ce), context.zone, false))
+}
+
+func nsec3Bitmap(z *types.Zone, name string) []uint16 {
+	if name == z.Name {
+		return dnssec.Nsec3BitmapAppex
+	}
+	if _, match := z.FindLocation(name); match == types.EmptyNonterminalMatch {
+		return []uint16{}
+	}
+	return dnssec.Nsec3BitmapZone
+}
+
+func (h *DnsRequestHandler) applyDnssec(context *RequestContext) {
 	if !context.dnssec {
 		return
 	}
-	context.Answer = dnssec.SignResponse(context.Answer, context.RawName(), context.zone)
-	context.Authority = dnssec.SignResponse(context.Authority, context.RawName(), context.zone)
+	context.Answer = dnssec.SignWildcardResponse(context.Answer, context.RawName(), context.expanded, context.wildcard, context.zone, h.Signatures)
+	context.Authority = dnssec.SignResponse(context.Authority, context.RawName(), context.zone, h.Signatures)
 	// context.Additional = Sign(context.Additional, context.RawName(), zone)
 
 }
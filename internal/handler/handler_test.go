@@ -64,6 +64,24 @@ var handlerTestCases = []*TestCase{
 						]}
 					}`,
 				},
+				{"host",
+					`{
+						"sshfp":{"ttl":300, "records":[{"algorithm":4, "type":2, "fingerprint":"123456789abcdef67890123456789abcdef67890123456789abcdef123456789"}]},
+						"hinfo":{"ttl":300, "records":[{"cpu":"x86", "os":"linux"}]}
+					}`,
+				},
+				{"_ftp._tcp",
+					`{"uri":{"ttl":300, "records":[{"priority":10, "weight":1, "target":"ftp://ftp1.example.com/public"}]}}`,
+				},
+				{"sipnaptr",
+					`{"naptr":{"ttl":300, "records":[{"order":100, "preference":10, "flags":"S", "service":"SIP+D2U", "regexp":"", "replacement":"_sip._udp.example.com."}]}}`,
+				},
+				{"c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert",
+					`{
+						"smimea":{"ttl":300, "records":[{"usage":3, "selector":1, "matching_type":1, "certificate":"d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971"}]},
+						"openpgpkey":{"ttl":300, "records":[{"public_key":"mQINBFit2jsBEADrbl5vjVxYeAE0g0IDYCBpHirv1Sjlqxx5gjtPhb2YhvyDMXjq"}]}
+					}`,
+				},
 				{"sip",
 					`{
 						"a":{"ttl":300, "records":[{"ip":"7.7.7.7"}]},
@@ -167,6 +185,54 @@ var handlerTestCases = []*TestCase{
 					test.TLSA("_990._tcp.example.com. 300 IN TLSA 1 1 1 62D5414CD1CC657E3D30"),
 				},
 			},
+			// SSHFP Test
+			{
+				Desc:  "SSHFP Test",
+				Qname: "host.example.com.", Qtype: dns.TypeSSHFP,
+				Answer: []dns.RR{
+					test.SSHFP("host.example.com. 300 IN SSHFP 4 2 123456789abcdef67890123456789abcdef67890123456789abcdef123456789"),
+				},
+			},
+			// HINFO Test
+			{
+				Desc:  "HINFO Test",
+				Qname: "host.example.com.", Qtype: dns.TypeHINFO,
+				Answer: []dns.RR{
+					test.HINFO("host.example.com. 300 IN HINFO x86 linux"),
+				},
+			},
+			// URI Test
+			{
+				Desc:  "URI Test",
+				Qname: "_ftp._tcp.example.com.", Qtype: dns.TypeURI,
+				Answer: []dns.RR{
+					test.URI("_ftp._tcp.example.com. 300 IN URI 10 1 \"ftp://ftp1.example.com/public\""),
+				},
+			},
+			// NAPTR Test
+			{
+				Desc:  "NAPTR Test",
+				Qname: "sipnaptr.example.com.", Qtype: dns.TypeNAPTR,
+				Answer: []dns.RR{
+					test.NAPTR("sipnaptr.example.com. 300 IN NAPTR 100 10 \"S\" \"SIP+D2U\" \"\" _sip._udp.example.com."),
+				},
+			},
+			// SMIMEA Test
+			{
+				Desc:  "SMIMEA Test",
+				Qname: "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.com.", Qtype: dns.TypeSMIMEA,
+				Answer: []dns.RR{
+					test.SMIMEA("c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.com. 300 IN SMIMEA 3 1 1 d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971"),
+				},
+			},
+			// OPENPGPKEY Test
+			{
+				Desc:  "OPENPGPKEY Test",
+				Qname: "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.com.", Qtype: dns.TypeOPENPGPKEY,
+				Answer: []dns.RR{
+					test.OPENPGPKEY("c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.com. 300 IN OPENPGPKEY mQINBFit2jsBEADrbl5vjVxYeAE0g0IDYCBpHirv1Sjlqxx5gjtPhb2YhvyDMXjq"),
+				},
+			},
 			// NXDOMAIN Test
 			{
 				Desc:  "NXDOMAIN Test",
@@ -2583,3 +2649,241 @@ func TestAllHandler(t *testing.T) {
 		fmt.Println(strings.Repeat("-", 80))
 	}
 }
+
+var serviceBindingTestCase = &TestCase{
+	Name:            "svcb",
+	Description:     "svcb and https records with in-zone targets",
+	Enabled:         true,
+	RedisDataConfig: DefaultRedisDataTestConfig,
+	HandlerConfig:   DefaultHandlerTestConfig,
+	Initialize:      DefaultInitialize,
+	ApplyAndVerify:  DefaultApplyAndVerify,
+	Zones:           []string{"svcb.com."},
+	ZoneConfigs:     []string{`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.svcb.com.","ns":"ns1.svcb.com.","refresh":44,"retry":55,"expire":66}}`},
+	Entries: [][][]string{
+		{
+			{"@",
+				`{
+					"ns":{"ttl":300, "records":[{"host":"ns1.svcb.com."}]},
+					"https":{"ttl":300, "records":[{"priority":0, "target":"www.svcb.com."}]}
+				}`,
+			},
+			{"www",
+				`{
+					"a":{"ttl":300, "records":[{"ip":"1.2.3.4"}]},
+					"aaaa":{"ttl":300, "records":[{"ip":"2001:db8::1"}]},
+					"https":{"ttl":300, "records":[{"priority":1, "target":".", "alpn":["h2","h3"], "ipv4hint":["1.2.3.4"], "ipv6hint":["2001:db8::1"]}]}
+				}`,
+			},
+			{"_8443._foo.api",
+				`{"svcb":{"ttl":300, "records":[
+					{"priority":1, "target":"svc.svcb.com.", "port":8443},
+					{"priority":2, "target":"svc.example.net.", "port":8443}
+				]}}`,
+			},
+			{"svc",
+				`{"a":{"ttl":300, "filter":{"count":"single", "order":"weighted", "geo_filter":"none"}, "records":[{"ip":"5.6.7.8", "weight":10}, {"ip":"6.7.8.9", "weight":0}]}}`,
+			},
+			{"alias",
+				`{"https":{"ttl":300, "records":[{"priority":0, "target":"."}]}}`,
+			},
+		},
+	},
+	TestCases: []test.Case{
+		{
+			Desc:  "alias mode at apex",
+			Qname: "svcb.com.", Qtype: dns.TypeHTTPS,
+			Answer: []dns.RR{
+				test.HTTPS("svcb.com. 300 IN HTTPS 0 www.svcb.com."),
+			},
+			Extra: []dns.RR{
+				test.A("www.svcb.com. 300 IN A 1.2.3.4"),
+				test.AAAA("www.svcb.com. 300 IN AAAA 2001:db8::1"),
+			},
+		},
+		{
+			Desc:  "service mode with owner as target",
+			Qname: "www.svcb.com.", Qtype: dns.TypeHTTPS,
+			Answer: []dns.RR{
+				test.HTTPS("www.svcb.com. 300 IN HTTPS 1 . alpn=\"h2,h3\" ipv4hint=\"1.2.3.4\" ipv6hint=\"2001:db8::1\""),
+			},
+			Extra: []dns.RR{
+				test.A("www.svcb.com. 300 IN A 1.2.3.4"),
+				test.AAAA("www.svcb.com. 300 IN AAAA 2001:db8::1"),
+			},
+		},
+		{
+			Desc:  "out of zone targets are not resolved",
+			Qname: "_8443._foo.api.svcb.com.", Qtype: dns.TypeSVCB,
+			Answer: []dns.RR{
+				test.SVCB("_8443._foo.api.svcb.com. 300 IN SVCB 1 svc.svcb.com. port=\"8443\""),
+				test.SVCB("_8443._foo.api.svcb.com. 300 IN SVCB 2 svc.example.net. port=\"8443\""),
+			},
+			Extra: []dns.RR{
+				test.A("svc.svcb.com. 300 IN A 5.6.7.8"),
+			},
+		},
+		{
+			Desc:  "alias mode with no service",
+			Qname: "alias.svcb.com.", Qtype: dns.TypeHTTPS,
+			Answer: []dns.RR{
+				test.HTTPS("alias.svcb.com. 300 IN HTTPS 0 ."),
+			},
+		},
+		{
+			Desc:  "https nodata",
+			Qname: "svc.svcb.com.", Qtype: dns.TypeHTTPS,
+			Ns: []dns.RR{
+				test.SOA("svcb.com. 300 IN SOA ns1.svcb.com. hostmaster.svcb.com. 1460498836 44 55 66 100"),
+			},
+		},
+	},
+}
+
+func TestServiceBinding(t *testing.T) {
+	g := NewGomegaWithT(t)
+	h, err := serviceBindingTestCase.Initialize(serviceBindingTestCase)
+	g.Expect(err).To(BeNil())
+	serviceBindingTestCase.ApplyAndVerify(serviceBindingTestCase, h, t)
+}
+
+var dnameTestCase = &TestCase{
+	Name:            "dname",
+	Description:     "dname redirection of subtrees",
+	Enabled:         true,
+	RedisDataConfig: DefaultRedisDataTestConfig,
+	HandlerConfig:   DefaultHandlerTestConfig,
+	Initialize:      DefaultInitialize,
+	ApplyAndVerify:  DefaultApplyAndVerify,
+	Zones:           []string{"dname.com.", "brand.com."},
+	ZoneConfigs: []string{
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.dname.com.","ns":"ns1.dname.com.","refresh":44,"retry":55,"expire":66}}`,
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.dname.com.","ns":"ns1.dname.com.","refresh":44,"retry":55,"expire":66}}`,
+	},
+	Entries: [][][]string{
+		{
+			{"@",
+				`{"ns":{"ttl":300, "records":[{"host":"ns1.dname.com."}]}}`,
+			},
+			{"www",
+				`{"a":{"ttl":300, "records":[{"ip":"1.2.3.4"}]}}`,
+			},
+			{"old",
+				`{"dname":{"ttl":600, "target":"dname.com."}}`,
+			},
+			{"www.old",
+				`{"a":{"ttl":300, "records":[{"ip":"5.6.7.8"}]}}`,
+			},
+			{"*.old",
+				`{"a":{"ttl":300, "records":[{"ip":"5.6.7.8"}]}}`,
+			},
+			{"a.b.old",
+				`{"a":{"ttl":300, "records":[{"ip":"5.6.7.8"}]}}`,
+			},
+			{"ext",
+				`{"dname":{"ttl":300, "target":"example.net."}}`,
+			},
+			{"c",
+				`{"cname":{"ttl":300, "host":"www.old.dname.com."}}`,
+			},
+			{"long",
+				`{"dname":{"ttl":300, "target":"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb.bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb.bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb.dname.com."}}`,
+			},
+		},
+		{
+			{"@",
+				`{"dname":{"ttl":300, "target":"dname.com."}}`,
+			},
+		},
+	},
+	TestCases: []test.Case{
+		{
+			Desc:  "dname at ancestor occludes data below owner",
+			Qname: "www.old.dname.com.", Qtype: dns.TypeA,
+			Answer: []dns.RR{
+				test.DNAME("old.dname.com. 600 IN DNAME dname.com."),
+				test.A("www.dname.com. 300 IN A 1.2.3.4"),
+				test.CNAME("www.old.dname.com. 600 IN CNAME www.dname.com."),
+			},
+		},
+		{
+			Desc:  "dname query at owner",
+			Qname: "old.dname.com.", Qtype: dns.TypeDNAME,
+			Answer: []dns.RR{
+				test.DNAME("old.dname.com. 600 IN DNAME dname.com."),
+			},
+		},
+		{
+			Desc:  "dname does not apply to owner",
+			Qname: "old.dname.com.", Qtype: dns.TypeA,
+			Ns: []dns.RR{
+				test.SOA("dname.com. 300 IN SOA ns1.dname.com. hostmaster.dname.com. 1460498836 44 55 66 100"),
+			},
+		},
+		{
+			Desc:  "dname at ancestor occludes wildcard below owner",
+			Qname: "x.old.dname.com.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Answer: []dns.RR{
+				test.DNAME("old.dname.com. 600 IN DNAME dname.com."),
+				test.CNAME("x.old.dname.com. 600 IN CNAME x.dname.com."),
+			},
+			Ns: []dns.RR{
+				test.SOA("dname.com. 300 IN SOA ns1.dname.com. hostmaster.dname.com. 1460498836 44 55 66 100"),
+			},
+		},
+		{
+			Desc:  "empty non-terminal below dname",
+			Qname: "b.old.dname.com.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Answer: []dns.RR{
+				test.CNAME("b.old.dname.com. 600 IN CNAME b.dname.com."),
+				test.DNAME("old.dname.com. 600 IN DNAME dname.com."),
+			},
+			Ns: []dns.RR{
+				test.SOA("dname.com. 300 IN SOA ns1.dname.com. hostmaster.dname.com. 1460498836 44 55 66 100"),
+			},
+		},
+		{
+			Desc:  "out of zone dname target",
+			Qname: "www.ext.dname.com.", Qtype: dns.TypeA,
+			Answer: []dns.RR{
+				test.DNAME("ext.dname.com. 300 IN DNAME example.net."),
+				test.CNAME("www.ext.dname.com. 300 IN CNAME www.example.net."),
+			},
+		},
+		{
+			Desc:  "cname to name below dname",
+			Qname: "c.dname.com.", Qtype: dns.TypeA,
+			Answer: []dns.RR{
+				test.CNAME("c.dname.com. 300 IN CNAME www.old.dname.com."),
+				test.DNAME("old.dname.com. 600 IN DNAME dname.com."),
+				test.A("www.dname.com. 300 IN A 1.2.3.4"),
+				test.CNAME("www.old.dname.com. 600 IN CNAME www.dname.com."),
+			},
+		},
+		{
+			Desc:  "synthesized name too long",
+			Qname: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa.long.dname.com.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeYXDomain,
+			Answer: []dns.RR{
+				test.DNAME("long.dname.com. 300 IN DNAME bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb.bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb.bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb.dname.com."),
+			},
+		},
+		{
+			Desc:  "dname at apex",
+			Qname: "www.brand.com.", Qtype: dns.TypeA,
+			Answer: []dns.RR{
+				test.DNAME("brand.com. 300 IN DNAME dname.com."),
+				test.CNAME("www.brand.com. 300 IN CNAME www.dname.com."),
+			},
+		},
+	},
+}
+
+func TestDName(t *testing.T) {
+	g := NewGomegaWithT(t)
+	h, err := dnameTestCase.Initialize(dnameTestCase)
+	g.Expect(err).To(BeNil())
+	dnameTestCase.ApplyAndVerify(dnameTestCase, h, t)
+}
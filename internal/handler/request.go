@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"encoding/hex"
 	"github.com/coredns/coredns/request"
 	"github.com/hawell/z42/internal/types"
 	"github.com/miekg/dns"
@@ -15,6 +16,8 @@ type RequestContext struct {
 	Auth       bool
 	Res        int
 	dnssec     bool
+	wildcard   string
+	expanded   string
 	Answer     []dns.RR
 	Authority  []dns.RR
 	Additional []dns.RR
@@ -27,6 +30,17 @@ type RequestContext struct {
 
 	name string
 
+	ecs       *dns.EDNS0_SUBNET
+	ecsError  bool
+	ecsPrefix uint8
+	ecsScope  uint8
+
+	cookie      []byte
+	cookieValid bool
+
+	matchedWildcard string
+	truncated       bool
+
 	zone *types.Zone
 }
 
@@ -43,24 +57,93 @@ func NewRequestContext(w dns.ResponseWriter, r *dns.Msg) *RequestContext {
 		dnssec:    false,
 		name:      "",
 	}
+	context.ecs, context.ecsError = context.clientSubnet()
 	context.SourceIp = context.sourceIp()
 	context.SourceSubnet = context.sourceSubnet()
 	return context
 }
 
-func (context *RequestContext) sourceIp() net.IP {
+// clientSubnet returns the ecs option of request, invalid options (RFC 7871 section 6) are reported as error
+func (context *RequestContext) clientSubnet() (*dns.EDNS0_SUBNET, bool) {
 	opt := context.Req.IsEdns0()
-	if opt != nil && len(opt.Option) != 0 {
-		for _, o := range opt.Option {
-			switch v := o.(type) {
-			case *dns.EDNS0_SUBNET:
-				return v.Address
+	if opt == nil {
+		return nil, false
+	}
+	for _, o := range opt.Option {
+		ecs, ok := o.(*dns.EDNS0_SUBNET)
+		if !ok {
+			continue
+		}
+		var bits int
+		switch ecs.Family {
+		case 0:
+			// dig sends family 0 with a zero source prefix
+			return ecs, ecs.SourceNetmask != 0
+		case 1:
+			bits = net.IPv4len * 8
+			if ecs.Address.To4() == nil {
+				return nil, true
 			}
+		case 2:
+			bits = net.IPv6len * 8
+			if ecs.Address.To4() != nil {
+				return nil, true
+			}
+		default:
+			return nil, true
+		}
+		if int(ecs.SourceNetmask) > bits || ecs.SourceScope != 0 {
+			return nil, true
 		}
+		// address bits beyond source prefix must be zero
+		if !ecsAddress(ecs.Address, ecs.SourceNetmask, bits).Equal(ecs.Address) {
+			return nil, true
+		}
+		return ecs, false
+	}
+	return nil, false
+}
+
+func ecsAddress(ip net.IP, prefix uint8, bits int) net.IP {
+	return ip.Mask(net.CIDRMask(int(prefix), bits))
+}
+
+func (context *RequestContext) sourceIp() net.IP {
+	if context.ecs != nil && context.ecs.SourceNetmask != 0 {
+		return context.ecs.Address
 	}
 	return net.ParseIP(context.IP())
 }
 
+// applyEcs limits source address to the configured prefix lengths, client address is used if ecs is disabled for zone or client opted out using a zero source prefix
+func (context *RequestContext) applyEcs(config *EcsConfig, trusted bool) {
+	if context.ecs == nil {
+		return
+	}
+	if !trusted || context.ecs.SourceNetmask == 0 {
+		context.SourceIp = net.ParseIP(context.IP())
+		return
+	}
+	prefix, bits := context.ecs.SourceNetmask, net.IPv4len*8
+	limit := config.MaxSourcePrefixV4
+	if context.ecs.Family == 2 {
+		bits = net.IPv6len * 8
+		limit = config.MaxSourcePrefixV6
+	}
+	if limit > 0 && prefix > limit {
+		prefix = limit
+	}
+	context.SourceIp = ecsAddress(context.ecs.Address, prefix, bits)
+	context.ecsPrefix = prefix
+}
+
+// useEcs marks the response as tailored to the client subnet
+func (context *RequestContext) useEcs() {
+	if context.ecsPrefix > context.ecsScope {
+		context.ecsScope = context.ecsPrefix
+	}
+}
+
 func (context *RequestContext) sourceSubnet() string {
 	opt := context.Req.IsEdns0()
 	if opt != nil && len(opt.Option) != 0 {
@@ -100,9 +183,57 @@ func (context *RequestContext) Response() {
 	m.Extra = append(m.Extra, context.Additional...)
 
 	context.SizeAndDo(m)
+	context.echoEcs(m)
+	context.setCookie(m)
 	m = context.Scrub(m)
+	m.Truncated = m.Truncated || context.truncated
+	context.sign(m)
 	if err := context.W.WriteMsg(m); err != nil {
 		// zap.L().Error("write error", zap.Error(err), zap.String("msg", m.String()))
 		_ = context.W.Close()
 	}
 }
+
+// echoEcs copies ecs option of request to m with scope prefix set to the number of source bits the answer depends on, 0 if not tailored
+func (context *RequestContext) echoEcs(m *dns.Msg) {
+	opt := m.IsEdns0()
+	if context.ecs == nil || opt == nil || context.Res == dns.RcodeFormatError {
+		return
+	}
+	ecs := *context.ecs
+	ecs.SourceScope = context.ecsScope
+	options := make([]dns.EDNS0, 0, len(opt.Option)+1)
+	options = append(options, opt.Option...)
+	opt.Option = append(options, &ecs)
+}
+
+// slip turns response into an empty truncated response so client retries over tcp
+func (context *RequestContext) slip() {
+	context.Answer, context.Authority, context.Additional = nil, nil, nil
+	context.truncated = true
+}
+
+// setCookie replaces the cookie option copied from request with the server generated cookie
+func (context *RequestContext) setCookie(m *dns.Msg) {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return
+	}
+	options := make([]dns.EDNS0, 0, len(opt.Option))
+	for _, o := range opt.Option {
+		if o.Option() != dns.EDNS0COOKIE {
+			options = append(options, o)
+		}
+	}
+	if context.cookie != nil {
+		options = append(options, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: hex.EncodeToString(context.cookie)})
+	}
+	opt.Option = options
+}
+
+// sign adds a tsig record to m if request had a valid signature, the signature itself is computed when writing m
+func (context *RequestContext) sign(m *dns.Msg) {
+	if t := context.Req.IsTsig(); t != nil && context.W.TsigStatus() == nil {
+		m.SetTsig(t.Hdr.Name, t.Algorithm, t.Fudge, time.Now().Unix())
+	}
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/hawell/z42/internal/rrl"
+	"github.com/hawell/z42/internal/test"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+func TestResponseRateLimit(t *testing.T) {
+	g := NewGomegaWithT(t)
+	tc := TestCase{
+		RedisDataConfig: DefaultRedisDataTestConfig,
+		HandlerConfig:   DefaultHandlerTestConfig,
+		Zones:           []string{"rrl.com."},
+		ZoneConfigs:     []string{""},
+		Entries: [][][]string{
+			{
+				{"www",
+					`{"txt":{"ttl":300, "records":[{"text":"foo"}]}}`,
+				},
+				{"*",
+					`{"txt":{"ttl":300, "records":[{"text":"bar"}]}}`,
+				},
+			},
+		},
+	}
+	tc.HandlerConfig.Rrl = rrl.Config{Enable: true, ResponsesPerSecond: 2, NxdomainsPerSecond: 2, ErrorsPerSecond: 2, Slip: 2}
+	h, err := DefaultInitialize(&tc)
+	g.Expect(err).To(BeNil())
+
+	query := func(qname string, tcp bool) *dns.Msg {
+		r := test.Case{Qname: qname, Qtype: dns.TypeTXT}.Msg()
+		w := test.NewRecorder(&test.ResponseWriter{TCP: tcp})
+		h.HandleRequest(NewRequestContext(w, r))
+		return w.Msg
+	}
+
+	g.Expect(len(query("www.rrl.com.", false).Answer)).To(Equal(1))
+	g.Expect(len(query("www.rrl.com.", false).Answer)).To(Equal(1))
+	g.Expect(query("www.rrl.com.", false)).To(BeNil())
+	m := query("www.rrl.com.", false)
+	g.Expect(m.Truncated).To(BeTrue())
+	g.Expect(len(m.Answer)).To(Equal(0))
+	g.Expect(len(query("www.rrl.com.", true).Answer)).To(Equal(1))
+
+	// names synthesized from the same wildcard share a bucket
+	g.Expect(len(query("a.rrl.com.", false).Answer)).To(Equal(1))
+	g.Expect(len(query("b.rrl.com.", false).Answer)).To(Equal(1))
+	g.Expect(query("c.rrl.com.", false)).To(BeNil())
+
+	// errors are limited by client prefix
+	g.Expect(query("www.example.com.", false).Rcode).To(Equal(dns.RcodeNotAuth))
+	g.Expect(query("www.example.net.", false).Rcode).To(Equal(dns.RcodeNotAuth))
+	g.Expect(query("www.example.org.", false)).To(BeNil())
+}
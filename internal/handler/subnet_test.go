@@ -38,3 +38,99 @@ func TestSubnet(t *testing.T) {
 	address := state.SourceIp
 	g.Expect(address.String()).To(Equal(sa))
 }
+
+func TestEcsScope(t *testing.T) {
+	g := NewGomegaWithT(t)
+	tc := TestCase{
+		RedisDataConfig: DefaultRedisDataTestConfig,
+		HandlerConfig:   DefaultHandlerTestConfig,
+		Zones:           []string{"ecs.com.", "noecs.com."},
+		ZoneConfigs:     []string{"", `{"ecs": false}`},
+		Entries: [][][]string{
+			{
+				{"www",
+					`{
+						"a":{"ttl":300, "records":[{"ip":"127.0.0.1", "country":["GB"]},{"ip":"127.0.0.2", "country":[""]}],
+						"filter":{"count":"multi","order":"none","geo_filter":"country"}},
+						"txt":{"ttl":300, "records":[{"text":"foo"}]}
+					}`,
+				},
+			},
+			{
+				{"www",
+					`{
+						"a":{"ttl":300, "records":[{"ip":"127.0.0.1", "country":["GB"]},{"ip":"127.0.0.2", "country":[""]}],
+						"filter":{"count":"multi","order":"none","geo_filter":"country"}}
+					}`,
+				},
+			},
+		},
+	}
+	tc.HandlerConfig.Ecs = EcsConfig{MaxSourcePrefixV4: 24, MaxSourcePrefixV6: 56}
+	h, err := DefaultInitialize(&tc)
+	g.Expect(err).To(BeNil())
+
+	query := func(qname string, qtype uint16, ecs *dns.EDNS0_SUBNET) *dns.Msg {
+		r := test.Case{Qname: qname, Qtype: qtype}.Msg()
+		r.SetEdns0(4096, false)
+		if ecs != nil {
+			ecs.Code = dns.EDNS0SUBNET
+			opt := r.IsEdns0()
+			opt.Option = append(opt.Option, ecs)
+		}
+		w := test.NewRecorder(&test.ResponseWriter{})
+		h.HandleRequest(NewRequestContext(w, r))
+		return w.Msg
+	}
+	responseEcs := func(m *dns.Msg) *dns.EDNS0_SUBNET {
+		g.Expect(m.IsEdns0()).NotTo(BeNil())
+		for _, o := range m.IsEdns0().Option {
+			if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+				return ecs
+			}
+		}
+		return nil
+	}
+
+	// geo filtered answer is scoped to source prefix, limited to max_source_prefix_v4
+	m := query("www.ecs.com.", dns.TypeA, &dns.EDNS0_SUBNET{Family: 1, SourceNetmask: 32, Address: net.ParseIP("94.76.229.204")})
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	ecs := responseEcs(m)
+	g.Expect(ecs).NotTo(BeNil())
+	g.Expect(ecs.SourceNetmask).To(Equal(uint8(32)))
+	g.Expect(ecs.SourceScope).To(Equal(uint8(24)))
+	g.Expect(ecs.Address.String()).To(Equal("94.76.229.204"))
+
+	m = query("www.ecs.com.", dns.TypeA, &dns.EDNS0_SUBNET{Family: 1, SourceNetmask: 16, Address: net.ParseIP("94.76.0.0")})
+	g.Expect(responseEcs(m).SourceScope).To(Equal(uint8(16)))
+
+	// non-geo rrsets don't depend on source
+	m = query("www.ecs.com.", dns.TypeTXT, &dns.EDNS0_SUBNET{Family: 1, SourceNetmask: 24, Address: net.ParseIP("94.76.229.0")})
+	g.Expect(len(m.Answer)).To(Equal(1))
+	g.Expect(responseEcs(m).SourceScope).To(Equal(uint8(0)))
+
+	// zero source prefix and untrusted zones use client address, answer is not tailored
+	m = query("www.ecs.com.", dns.TypeA, &dns.EDNS0_SUBNET{Family: 1, SourceNetmask: 0, Address: net.ParseIP("0.0.0.0")})
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	g.Expect(responseEcs(m).SourceScope).To(Equal(uint8(0)))
+	m = query("www.noecs.com.", dns.TypeA, &dns.EDNS0_SUBNET{Family: 1, SourceNetmask: 24, Address: net.ParseIP("94.76.229.0")})
+	g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+	g.Expect(responseEcs(m).SourceScope).To(Equal(uint8(0)))
+
+	// no ecs in request, no ecs in response
+	m = query("www.ecs.com.", dns.TypeA, nil)
+	g.Expect(responseEcs(m)).To(BeNil())
+
+	// invalid options
+	for _, ecs := range []*dns.EDNS0_SUBNET{
+		{Family: 1, SourceNetmask: 16, Address: net.ParseIP("94.76.229.204")},
+		{Family: 1, SourceNetmask: 24, SourceScope: 24, Address: net.ParseIP("94.76.229.0")},
+		{Family: 1, SourceNetmask: 33, Address: net.ParseIP("94.76.229.204")},
+		{Family: 2, SourceNetmask: 56, Address: net.ParseIP("94.76.229.0")},
+		{Family: 3, SourceNetmask: 24, Address: net.ParseIP("94.76.229.0")},
+	} {
+		m = query("www.ecs.com.", dns.TypeA, ecs)
+		g.Expect(m.Rcode).To(Equal(dns.RcodeFormatError))
+		g.Expect(responseEcs(m)).To(BeNil())
+	}
+}
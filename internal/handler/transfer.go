@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"github.com/hawell/z42/internal/tsig"
+	"github.com/hawell/z42/internal/types"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"net"
+	"sort"
+	"strings"
+)
+
+const (
+	transferEnvelopeSize = 16 * 1024
+)
+
+func (h *DnsRequestHandler) handleTransfer(context *RequestContext) {
+	zap.L().Debug(
+		"zone transfer",
+		zap.Uint16("id", context.Req.Id),
+		zap.String("zone", context.zone.Name),
+		zap.String("type", context.Type()),
+		zap.String("source", context.IP()),
+	)
+	if context.RawName() != context.zone.Name {
+		context.Res = dns.RcodeNotAuth
+		h.response(context)
+		return
+	}
+	if context.Proto() != "tcp" && context.QType() == dns.TypeAXFR {
+		context.Res = dns.RcodeRefused
+		h.response(context)
+		return
+	}
+	if context.Req.IsTsig() != nil {
+		if err := h.Keyring.Authorize(context.Req, context.W.TsigStatus(), context.zone.Name, tsig.OperationTransfer); err != nil {
+			zap.L().Error(
+				"zone transfer not authorized",
+				zap.String("zone", context.zone.Name),
+				zap.String("source", context.IP()),
+				zap.Error(err),
+			)
+			context.Res = tsig.Rcode(err)
+			h.response(context)
+			return
+		}
+	} else if !aclMatch(context.zone.Config.AllowTransfer, net.ParseIP(context.IP())) {
+		zap.L().Error(
+			"zone transfer refused",
+			zap.String("zone", context.zone.Name),
+			zap.String("source", context.IP()),
+		)
+		context.Res = dns.RcodeRefused
+		h.response(context)
+		return
+	}
+
+	var (
+		records []dns.RR
+		err     error
+	)
+	if context.QType() == dns.TypeIXFR {
+		if len(context.Req.Ns) == 0 {
+			context.Res = dns.RcodeFormatError
+			h.response(context)
+			return
+		}
+		clientSOA, ok := context.Req.Ns[0].(*dns.SOA)
+		if !ok {
+			context.Res = dns.RcodeFormatError
+			h.response(context)
+			return
+		}
+		if context.Proto() != "tcp" {
+			// answer with current SOA over udp, client should retry over tcp
+			context.Answer = []dns.RR{context.zone.Config.SOA.Data}
+			h.response(context)
+			return
+		}
+		records, err = h.incrementalRecords(context.zone, clientSOA.Serial)
+	} else {
+		records, err = h.zoneRecords(context.zone)
+	}
+	if err != nil {
+		zap.L().Error("cannot load zone records", zap.String("zone", context.zone.Name), zap.Error(err))
+		context.Res = dns.RcodeServerFailure
+		h.response(context)
+		return
+	}
+	h.transferOut(context, records)
+}
+
+func (h *DnsRequestHandler) transferOut(context *RequestContext, records []dns.RR) {
+	ch := make(chan *dns.Envelope)
+	tr := new(dns.Transfer)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- tr.Out(context.W, context.Req, ch)
+	}()
+	// Out stops reading ch on first write error, so sending must not block once it has returned
+	var err error
+	done := false
+send:
+	for _, envelope := range splitEnvelopes(records) {
+		select {
+		case ch <- envelope:
+		case err = <-errCh:
+			done = true
+			break send
+		}
+	}
+	close(ch)
+	if !done {
+		err = <-errCh
+	}
+	if err != nil {
+		zap.L().Error("zone transfer failed", zap.String("zone", context.zone.Name), zap.Error(err))
+		context.Res = dns.RcodeServerFailure
+	}
+	h.logRequest(context)
+}
+
+func (h *DnsRequestHandler) zoneRecords(zone *types.Zone) ([]dns.RR, error) {
+	soa := zone.Config.SOA.Data
+	records := []dns.RR{soa}
+	locations := make([]string, len(zone.LocationsList))
+	copy(locations, zone.LocationsList)
+	sort.Strings(locations)
+	for _, location := range locations {
+		name := zone.Name
+		if location != "@" {
+			name = location + "." + zone.Name
+		}
+		for _, rtype := range types.TransferTypes {
+			rrset, err := h.RedisData.RRSet(zone.Name, location, rtype)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, types.RRSetRecords(name, rtype, rrset)...)
+		}
+	}
+	records = append(records, soa)
+	return records, nil
+}
+
+func (h *DnsRequestHandler) incrementalRecords(zone *types.Zone, serial uint32) ([]dns.RR, error) {
+	soa := zone.Config.SOA.Data
+	if !serialLess(serial, soa.Serial) {
+		return []dns.RR{soa}, nil
+	}
+	entries, ok, err := h.RedisData.Journal(zone.Name, serial)
+	if err != nil {
+		return nil, err
+	}
+	for len(entries) > 0 && serialLess(soa.Serial, entries[len(entries)-1].Serial) {
+		entries = entries[:len(entries)-1]
+	}
+	if !ok || len(entries) == 0 || entries[len(entries)-1].Serial != soa.Serial {
+		zap.L().Debug(
+			"journal not available, sending full zone",
+			zap.String("zone", zone.Name),
+			zap.Uint32("serial", serial),
+		)
+		return h.zoneRecords(zone)
+	}
+
+	records := []dns.RR{soa}
+	previous := serial
+	for _, entry := range entries {
+		var deleted, added []dns.RR
+		for i := range entry.Changes {
+			d, a, err := entry.Changes[i].Diff(zone.Name)
+			if err != nil {
+				return nil, err
+			}
+			deleted = append(deleted, d...)
+			added = append(added, a...)
+		}
+		records = append(records, serialSOA(soa, previous))
+		records = append(records, deleted...)
+		records = append(records, serialSOA(soa, entry.Serial))
+		records = append(records, added...)
+		previous = entry.Serial
+	}
+	records = append(records, soa)
+	return records, nil
+}
+
+func serialSOA(soa *dns.SOA, serial uint32) *dns.SOA {
+	r := dns.Copy(soa).(*dns.SOA)
+	r.Serial = serial
+	return r
+}
+
+// serial number arithmetic, rfc 1982
+func serialLess(a uint32, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+func splitEnvelopes(records []dns.RR) []*dns.Envelope {
+	var envelopes []*dns.Envelope
+	size := 0
+	current := &dns.Envelope{}
+	for _, rr := range records {
+		rrSize := dns.Len(rr)
+		if size+rrSize > transferEnvelopeSize && len(current.RR) > 0 {
+			envelopes = append(envelopes, current)
+			current = &dns.Envelope{}
+			size = 0
+		}
+		current.RR = append(current.RR, rr)
+		size += rrSize
+	}
+	if len(current.RR) > 0 {
+		envelopes = append(envelopes, current)
+	}
+	return envelopes
+}
+
+func aclMatch(acl []string, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, entry := range acl {
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if aclIp := net.ParseIP(entry); aclIp != nil && aclIp.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"errors"
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/internal/test"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+type transferRecorder struct {
+	test.ResponseWriter
+	Msgs []*dns.Msg
+}
+
+func (r *transferRecorder) WriteMsg(m *dns.Msg) error {
+	r.Msgs = append(r.Msgs, m)
+	return nil
+}
+
+// brokenWriter fails like a connection closed by secondary
+type brokenWriter struct {
+	test.ResponseWriter
+}
+
+func (w *brokenWriter) WriteMsg(*dns.Msg) error {
+	return errors.New("connection reset")
+}
+
+var transferTestCase = &TestCase{
+	Name:            "zone transfer",
+	Description:     "outbound zone transfer",
+	Enabled:         true,
+	RedisDataConfig: DefaultRedisDataTestConfig,
+	HandlerConfig:   DefaultHandlerTestConfig,
+	Initialize:      DefaultInitialize,
+	Zones:           []string{"transfer.com.", "notallowed.com."},
+	ZoneConfigs: []string{
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.transfer.com.","ns":"ns1.transfer.com.","refresh":44,"retry":55,"expire":66, "serial":100}, "allow_transfer":["10.240.0.0/16"]}`,
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.notallowed.com.","ns":"ns1.notallowed.com.","refresh":44,"retry":55,"expire":66, "serial":100}, "allow_transfer":["10.0.0.1"]}`,
+	},
+	Entries: [][][]string{
+		{
+			{"@",
+				`{"ns":{"ttl":300, "records":[{"host":"ns1.transfer.com."},{"host":"ns2.transfer.com."}]}}`,
+			},
+			{"www",
+				`{
+					"a":{"ttl":300, "records":[{"ip":"1.2.3.4"},{"ip":"5.6.7.8"}]},
+					"aaaa":{"ttl":300, "records":[{"ip":"::1"}]},
+					"txt":{"ttl":300, "records":[{"text":"foo"}]}
+				}`,
+			},
+			{"alias",
+				`{"cname":{"ttl":300, "host":"www.transfer.com."}}`,
+			},
+		},
+		{
+			{"www",
+				`{"a":{"ttl":300, "records":[{"ip":"1.2.3.4"}]}}`,
+			},
+		},
+	},
+}
+
+func TestTransfer(t *testing.T) {
+	g := NewGomegaWithT(t)
+	h, err := transferTestCase.Initialize(transferTestCase)
+	g.Expect(err).To(BeNil())
+
+	axfr := func(zone string, tcp bool) *transferRecorder {
+		r := new(dns.Msg)
+		r.SetAxfr(zone)
+		w := &transferRecorder{ResponseWriter: test.ResponseWriter{TCP: tcp}}
+		h.HandleRequest(NewRequestContext(w, r))
+		return w
+	}
+
+	w := axfr("transfer.com.", true)
+	g.Expect(len(w.Msgs)).To(BeNumerically(">", 0))
+	var records []dns.RR
+	for _, m := range w.Msgs {
+		g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+		records = append(records, m.Answer...)
+	}
+	g.Expect(len(records)).To(Equal(9))
+	g.Expect(records[0].Header().Rrtype).To(Equal(dns.TypeSOA))
+	g.Expect(records[len(records)-1].Header().Rrtype).To(Equal(dns.TypeSOA))
+	g.Expect(records[0].(*dns.SOA).Serial).To(Equal(uint32(100)))
+
+	w = axfr("transfer.com.", false)
+	g.Expect(len(w.Msgs)).To(Equal(1))
+	g.Expect(w.Msgs[0].Rcode).To(Equal(dns.RcodeRefused))
+
+	w = axfr("notallowed.com.", true)
+	g.Expect(len(w.Msgs)).To(Equal(1))
+	g.Expect(w.Msgs[0].Rcode).To(Equal(dns.RcodeRefused))
+
+	w = axfr("www.transfer.com.", true)
+	g.Expect(len(w.Msgs)).To(Equal(1))
+	g.Expect(w.Msgs[0].Rcode).To(Equal(dns.RcodeNotAuth))
+}
+
+func TestIncrementalTransfer(t *testing.T) {
+	g := NewGomegaWithT(t)
+	_, err := transferTestCase.Initialize(transferTestCase)
+	g.Expect(err).To(BeNil())
+
+	config := DefaultRedisDataTestConfig
+	config.JournalSize = 10
+	dh := storage.NewDataHandler(&config)
+	err = dh.SetRRSetFromJson("transfer.com.", "www", dns.TypeA, `{"ttl":300, "records":[{"ip":"1.2.3.4"},{"ip":"9.9.9.9"}]}`)
+	g.Expect(err).To(BeNil())
+	err = dh.SetRRSetFromJson("transfer.com.", "www", dns.TypeTXT, `{"ttl":300, "records":[{"text":"bar"}]}`)
+	g.Expect(err).To(BeNil())
+	dh.ShutDown()
+
+	l, _ := zap.NewProduction()
+	h := NewHandler(&DefaultHandlerTestConfig, storage.NewDataHandler(&config), l)
+
+	ixfr := func(serial uint32, tcp bool) []dns.RR {
+		r := new(dns.Msg)
+		r.SetIxfr("transfer.com.", serial, "ns1.transfer.com.", "hostmaster.transfer.com.")
+		w := &transferRecorder{ResponseWriter: test.ResponseWriter{TCP: tcp}}
+		h.HandleRequest(NewRequestContext(w, r))
+		var records []dns.RR
+		for _, m := range w.Msgs {
+			g.Expect(m.Rcode).To(Equal(dns.RcodeSuccess))
+			records = append(records, m.Answer...)
+		}
+		return records
+	}
+
+	records := ixfr(100, true)
+	g.Expect(len(records)).To(Equal(10))
+	expected := []string{
+		"transfer.com.	300	IN	SOA	ns1.transfer.com. hostmaster.transfer.com. 102 44 55 66 100",
+		"transfer.com.	300	IN	SOA	ns1.transfer.com. hostmaster.transfer.com. 100 44 55 66 100",
+		"www.transfer.com.	300	IN	A	5.6.7.8",
+		"transfer.com.	300	IN	SOA	ns1.transfer.com. hostmaster.transfer.com. 101 44 55 66 100",
+		"www.transfer.com.	300	IN	A	9.9.9.9",
+		"transfer.com.	300	IN	SOA	ns1.transfer.com. hostmaster.transfer.com. 101 44 55 66 100",
+		"www.transfer.com.	300	IN	TXT	\"foo\"",
+		"transfer.com.	300	IN	SOA	ns1.transfer.com. hostmaster.transfer.com. 102 44 55 66 100",
+		"www.transfer.com.	300	IN	TXT	\"bar\"",
+		"transfer.com.	300	IN	SOA	ns1.transfer.com. hostmaster.transfer.com. 102 44 55 66 100",
+	}
+	for i := range expected {
+		g.Expect(records[i].String()).To(Equal(expected[i]))
+	}
+
+	records = ixfr(101, true)
+	g.Expect(len(records)).To(Equal(6))
+
+	records = ixfr(102, true)
+	g.Expect(len(records)).To(Equal(1))
+	g.Expect(records[0].(*dns.SOA).Serial).To(Equal(uint32(102)))
+
+	records = ixfr(100, false)
+	g.Expect(len(records)).To(Equal(1))
+	g.Expect(records[0].(*dns.SOA).Serial).To(Equal(uint32(102)))
+
+	// journal doesn't reach back, fall back to full transfer
+	records = ixfr(50, true)
+	g.Expect(len(records)).To(Equal(9))
+	g.Expect(records[0].(*dns.SOA).Serial).To(Equal(uint32(102)))
+}
+
+func TestSplitEnvelopes(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var records []dns.RR
+	for i := 0; i < 2000; i++ {
+		records = append(records, test.A("www.example.com. 300 IN A 1.2.3.4"))
+	}
+	envelopes := splitEnvelopes(records)
+	g.Expect(len(envelopes)).To(BeNumerically(">", 1))
+	count := 0
+	for _, envelope := range envelopes {
+		count += len(envelope.RR)
+	}
+	g.Expect(count).To(Equal(2000))
+}
+
+func TestTransferOutWriteError(t *testing.T) {
+	g := NewGomegaWithT(t)
+	h, err := transferTestCase.Initialize(transferTestCase)
+	g.Expect(err).To(BeNil())
+	var records []dns.RR
+	for i := 0; i < 2000; i++ {
+		records = append(records, test.A("www.transfer.com. 300 IN A 1.2.3.4"))
+	}
+	r := new(dns.Msg)
+	r.SetAxfr("transfer.com.")
+	context := NewRequestContext(&brokenWriter{ResponseWriter: test.ResponseWriter{TCP: true}}, r)
+	context.zone = h.RedisData.GetZone("transfer.com.")
+	done := make(chan struct{})
+	go func() {
+		h.transferOut(context, records)
+		close(done)
+	}()
+	g.Eventually(done, time.Second).Should(BeClosed())
+	g.Expect(context.Res).To(Equal(dns.RcodeServerFailure))
+}
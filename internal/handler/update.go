@@ -0,0 +1,427 @@
+package handler
+
+import (
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/internal/tsig"
+	"github.com/hawell/z42/internal/types"
+	"github.com/json-iterator/go"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+)
+
+type updateKey struct {
+	label string
+	rtype uint16
+}
+
+// update holds rrsets of a zone touched by a dynamic update
+type update struct {
+	h        *DnsRequestHandler
+	zone     *types.Zone
+	original map[updateKey]types.RRSet
+	current  map[updateKey][]dns.RR
+	modified map[updateKey]bool
+}
+
+func (h *DnsRequestHandler) handleUpdate(context *RequestContext) {
+	zap.L().Debug(
+		"dynamic update",
+		zap.Uint16("id", context.Req.Id),
+		zap.String("zone", context.zone.Name),
+		zap.String("source", context.IP()),
+	)
+	if context.RawName() != context.zone.Name {
+		context.Res = dns.RcodeNotAuth
+		h.updateResponse(context)
+		return
+	}
+	if context.QType() != dns.TypeSOA {
+		context.Res = dns.RcodeFormatError
+		h.updateResponse(context)
+		return
+	}
+	if len(context.zone.Config.Primaries) > 0 {
+		context.Res = dns.RcodeRefused
+		h.updateResponse(context)
+		return
+	}
+	if err := h.Keyring.Authorize(context.Req, context.W.TsigStatus(), context.zone.Name, tsig.OperationUpdate); err != nil {
+		zap.L().Error(
+			"update not authorized",
+			zap.String("zone", context.zone.Name),
+			zap.String("source", context.IP()),
+			zap.Error(err),
+		)
+		context.Res = tsig.Rcode(err)
+		h.updateResponse(context)
+		return
+	}
+
+	h.updateLock.Lock()
+	defer h.updateLock.Unlock()
+	u := &update{
+		h:        h,
+		zone:     context.zone,
+		original: make(map[updateKey]types.RRSet),
+		current:  make(map[updateKey][]dns.RR),
+		modified: make(map[updateKey]bool),
+	}
+	context.Res = u.checkPrerequisites(context.Req.Answer)
+	if context.Res == dns.RcodeSuccess {
+		context.Res = u.apply(context.Req.Ns)
+	}
+	if context.Res == dns.RcodeSuccess {
+		if err := u.commit(); err != nil {
+			zap.L().Error("cannot apply update", zap.String("zone", context.zone.Name), zap.Error(err))
+			context.Res = dns.RcodeServerFailure
+		}
+	}
+	h.updateResponse(context)
+}
+
+// updateResponse writes response of an update request, responses are signed if request had a valid signature
+func (h *DnsRequestHandler) updateResponse(context *RequestContext) {
+	h.logRequest(context)
+	m := new(dns.Msg)
+	m.SetRcode(context.Req, context.Res)
+	context.sign(m)
+	if err := context.W.WriteMsg(m); err != nil {
+		_ = context.W.Close()
+	}
+}
+
+func (u *update) label(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if name == u.zone.Name {
+		return "@", true
+	}
+	if !strings.HasSuffix(name, "."+u.zone.Name) {
+		return "", false
+	}
+	return strings.TrimSuffix(name, "."+u.zone.Name), true
+}
+
+func (u *update) ownerName(label string) string {
+	if label == "@" {
+		return u.zone.Name
+	}
+	return label + "." + u.zone.Name
+}
+
+func (u *update) rrset(label string, rtype uint16) ([]dns.RR, error) {
+	key := updateKey{label: label, rtype: rtype}
+	if rrs, ok := u.current[key]; ok {
+		return rrs, nil
+	}
+	rrset, err := u.h.RedisData.RRSet(u.zone.Name, label, rtype)
+	if err != nil {
+		return nil, err
+	}
+	rrs := types.RRSetRecords(u.ownerName(label), rtype, rrset)
+	u.original[key] = rrset
+	u.current[key] = rrs
+	return rrs, nil
+}
+
+func (u *update) set(label string, rtype uint16, rrs []dns.RR) {
+	key := updateKey{label: label, rtype: rtype}
+	u.current[key] = rrs
+	u.modified[key] = true
+}
+
+func (u *update) nameUsed(label string) (bool, error) {
+	for _, rtype := range types.TransferTypes {
+		rrs, err := u.rrset(label, rtype)
+		if err != nil {
+			return false, err
+		}
+		if len(rrs) > 0 {
+			return true, nil
+		}
+	}
+	return label == "@", nil
+}
+
+// cnameConflict reports whether adding an rrset of rtype at label violates rfc2136 section 3.4.2.2 cname rules:
+// a cname cannot be added to a name with other data and other data cannot be added to a cname owner
+func (u *update) cnameConflict(label string, rtype uint16) (bool, error) {
+	cname, err := u.rrset(label, dns.TypeCNAME)
+	if err != nil {
+		return false, err
+	}
+	if rtype != dns.TypeCNAME {
+		return len(cname) > 0, nil
+	}
+	if len(cname) > 0 {
+		return false, nil
+	}
+	return u.nameUsed(label)
+}
+
+// checkPrerequisites implements rfc2136 section 3.2
+func (u *update) checkPrerequisites(prerequisites []dns.RR) int {
+	expected := make(map[updateKey][]dns.RR)
+	for _, rr := range prerequisites {
+		hdr := rr.Header()
+		if hdr.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		label, ok := u.label(hdr.Name)
+		if !ok {
+			return dns.RcodeNotZone
+		}
+		switch hdr.Class {
+		case dns.ClassANY, dns.ClassNONE:
+			if hdr.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			var exists bool
+			if hdr.Rrtype == dns.TypeANY {
+				used, err := u.nameUsed(label)
+				if err != nil {
+					return dns.RcodeServerFailure
+				}
+				exists = used
+			} else {
+				rrs, err := u.rrset(label, hdr.Rrtype)
+				if err != nil {
+					return dns.RcodeServerFailure
+				}
+				exists = len(rrs) > 0
+			}
+			switch {
+			case hdr.Class == dns.ClassANY && !exists && hdr.Rrtype == dns.TypeANY:
+				return dns.RcodeNameError
+			case hdr.Class == dns.ClassANY && !exists:
+				return dns.RcodeNXRrset
+			case hdr.Class == dns.ClassNONE && exists && hdr.Rrtype == dns.TypeANY:
+				return dns.RcodeYXDomain
+			case hdr.Class == dns.ClassNONE && exists:
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			key := updateKey{label: label, rtype: hdr.Rrtype}
+			expected[key] = append(expected[key], rr)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	for key, rrs := range expected {
+		current, err := u.rrset(key.label, key.rtype)
+		if err != nil {
+			return dns.RcodeServerFailure
+		}
+		if !sameRecords(current, rrs, false) {
+			return dns.RcodeNXRrset
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// apply implements rfc2136 sections 3.4.1 and 3.4.2
+func (u *update) apply(updates []dns.RR) int {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		if _, ok := u.label(hdr.Name); !ok {
+			return dns.RcodeNotZone
+		}
+		switch hdr.Class {
+		case dns.ClassINET:
+			if isMetaType(hdr.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if hdr.Ttl != 0 || hdr.Rdlength != 0 || (isMetaType(hdr.Rrtype) && hdr.Rrtype != dns.TypeANY) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 || isMetaType(hdr.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+		if hdr.Rrtype != dns.TypeANY && hdr.Rrtype != dns.TypeSOA && !isTransferType(hdr.Rrtype) {
+			zap.L().Error("unsupported type in update", zap.String("zone", u.zone.Name), zap.String("type", dns.TypeToString[hdr.Rrtype]))
+			return dns.RcodeRefused
+		}
+	}
+
+	for _, rr := range updates {
+		hdr := rr.Header()
+		label, _ := u.label(hdr.Name)
+		// soa is managed by z42
+		if hdr.Rrtype == dns.TypeSOA {
+			continue
+		}
+		switch hdr.Class {
+		case dns.ClassINET:
+			ignore, err := u.cnameConflict(label, hdr.Rrtype)
+			if err != nil {
+				return dns.RcodeServerFailure
+			}
+			if ignore {
+				zap.L().Debug("update conflicting with cname ignored", zap.String("zone", u.zone.Name), zap.String("record", rr.String()))
+				continue
+			}
+			rrs, err := u.rrset(label, hdr.Rrtype)
+			if err != nil {
+				return dns.RcodeServerFailure
+			}
+			record := dns.Copy(rr)
+			record.Header().Name = u.ownerName(label)
+			var res []dns.RR
+			// cname and ptr rrsets hold a single record
+			if hdr.Rrtype != dns.TypeCNAME && hdr.Rrtype != dns.TypePTR {
+				for _, x := range rrs {
+					if !dns.IsDuplicate(x, record) {
+						res = append(res, x)
+					}
+				}
+			}
+			res = append(res, record)
+			for _, x := range res {
+				x.Header().Ttl = hdr.Ttl
+			}
+			u.set(label, hdr.Rrtype, res)
+		case dns.ClassANY:
+			rtypes := []uint16{hdr.Rrtype}
+			if hdr.Rrtype == dns.TypeANY {
+				rtypes = types.TransferTypes
+			}
+			for _, rtype := range rtypes {
+				if label == "@" && rtype == dns.TypeNS {
+					continue
+				}
+				rrs, err := u.rrset(label, rtype)
+				if err != nil {
+					return dns.RcodeServerFailure
+				}
+				if len(rrs) > 0 {
+					u.set(label, rtype, nil)
+				}
+			}
+		case dns.ClassNONE:
+			rrs, err := u.rrset(label, hdr.Rrtype)
+			if err != nil {
+				return dns.RcodeServerFailure
+			}
+			record := dns.Copy(rr)
+			record.Header().Class = dns.ClassINET
+			var res []dns.RR
+			for _, x := range rrs {
+				if !dns.IsDuplicate(x, record) {
+					res = append(res, x)
+				}
+			}
+			// last ns record of zone cannot be deleted
+			if label == "@" && hdr.Rrtype == dns.TypeNS && len(res) == 0 {
+				continue
+			}
+			if len(res) != len(rrs) {
+				u.set(label, hdr.Rrtype, res)
+			}
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+func (u *update) commit() error {
+	var changes []storage.RRSetChange
+	for key := range u.modified {
+		rrs := u.current[key]
+		if sameRecords(types.RRSetRecords(u.ownerName(key.label), key.rtype, u.original[key]), rrs, true) {
+			continue
+		}
+		change := storage.RRSetChange{Location: key.label, Type: key.rtype}
+		if len(rrs) > 0 {
+			rrset := mergeRRSet(u.original[key], types.RRSetFromRecords(key.rtype, rrs))
+			value, err := jsoniter.Marshal(rrset)
+			if err != nil {
+				return err
+			}
+			change.New = string(value)
+		}
+		changes = append(changes, change)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Location != changes[j].Location {
+			return changes[i].Location < changes[j].Location
+		}
+		return changes[i].Type < changes[j].Type
+	})
+	return u.h.RedisData.UpdateRRSets(u.zone.Name, changes)
+}
+
+// mergeRRSet keeps z42 specific settings of ip rrsets which are not present in wire format
+func mergeRRSet(original types.RRSet, updated types.RRSet) types.RRSet {
+	o, ok := original.(*types.IP_RRSet)
+	if !ok {
+		return updated
+	}
+	u, ok := updated.(*types.IP_RRSet)
+	if !ok {
+		return updated
+	}
+	u.FilterConfig = o.FilterConfig
+	u.HealthCheckConfig = o.HealthCheckConfig
+	for i := range u.Data {
+		for _, data := range o.Data {
+			if data.Ip.Equal(u.Data[i].Ip) {
+				u.Data[i] = data
+				break
+			}
+		}
+	}
+	return u
+}
+
+// sameRecords compares two rrsets regardless of records order and class
+func sameRecords(a []dns.RR, b []dns.RR, compareTtl bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	contains := func(rrs []dns.RR, rr dns.RR) bool {
+		rr = dns.Copy(rr)
+		rr.Header().Class = dns.ClassINET
+		for _, x := range rrs {
+			if dns.IsDuplicate(x, rr) && (!compareTtl || x.Header().Ttl == rr.Header().Ttl) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rr := range a {
+		if !contains(b, rr) {
+			return false
+		}
+	}
+	for _, rr := range b {
+		if !contains(a, rr) {
+			return false
+		}
+	}
+	return true
+}
+
+func isMetaType(rtype uint16) bool {
+	switch rtype {
+	case dns.TypeNone, dns.TypeANY, dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG, dns.TypeTKEY:
+		return true
+	}
+	return false
+}
+
+func isTransferType(rtype uint16) bool {
+	for _, t := range types.TransferTypes {
+		if t == rtype {
+			return true
+		}
+	}
+	return false
+}
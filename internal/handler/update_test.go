@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"errors"
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/internal/test"
+	"github.com/hawell/z42/internal/tsig"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"testing"
+	"time"
+)
+
+type updateRecorder struct {
+	transferRecorder
+	tsigErr error
+}
+
+func (r *updateRecorder) TsigStatus() error {
+	return r.tsigErr
+}
+
+func updateHandlerTestConfig() DnsRequestHandlerConfig {
+	config := DefaultHandlerTestConfig
+	config.Tsig = tsig.Config{
+		Keys: []tsig.KeyConfig{
+			{Name: "key1.", Algorithm: "hmac-sha256", Secret: "c2VjcmV0", Zones: []string{"update.com."}, Operations: []string{"update"}},
+			{Name: "key3.", Algorithm: "hmac-sha256", Secret: "c2VjcmV0", Zones: []string{"update.com."}, Operations: []string{"transfer"}},
+		},
+	}
+	return config
+}
+
+var updateTestCase = &TestCase{
+	Name:            "dynamic update",
+	Description:     "rfc2136 dynamic updates",
+	Enabled:         true,
+	RedisDataConfig: DefaultRedisDataTestConfig,
+	HandlerConfig:   updateHandlerTestConfig(),
+	Initialize:      DefaultInitialize,
+	Zones:           []string{"update.com."},
+	ZoneConfigs: []string{
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.update.com.","ns":"ns1.update.com.","refresh":44,"retry":55,"expire":66, "serial":100}}`,
+	},
+	Entries: [][][]string{
+		{
+			{"@",
+				`{"ns":{"ttl":300, "records":[{"host":"ns1.update.com."},{"host":"ns2.update.com."}]}}`,
+			},
+			{"www",
+				`{"a":{"ttl":300, "filter":{"count":"single"}, "records":[{"ip":"1.2.3.4", "weight":10, "country":["DE"]}]}}`,
+			},
+		},
+	},
+}
+
+func TestUpdate(t *testing.T) {
+	g := NewGomegaWithT(t)
+	h, err := updateTestCase.Initialize(updateTestCase)
+	g.Expect(err).To(BeNil())
+
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		g.Expect(err).To(BeNil())
+		return r
+	}
+	send := func(m *dns.Msg, key string, tsigErr error) int {
+		if key != "" {
+			m.SetTsig(key, dns.HmacSHA256, 300, time.Now().Unix())
+		}
+		buf, err := m.Pack()
+		g.Expect(err).To(BeNil())
+		r := new(dns.Msg)
+		g.Expect(r.Unpack(buf)).To(BeNil())
+		w := &updateRecorder{transferRecorder: transferRecorder{ResponseWriter: test.ResponseWriter{TCP: true}}, tsigErr: tsigErr}
+		h.HandleRequest(NewRequestContext(w, r))
+		g.Expect(len(w.Msgs)).To(Equal(1))
+		g.Expect(w.Msgs[0].Opcode).To(Equal(dns.OpcodeUpdate))
+		if key != "" && tsigErr == nil {
+			g.Expect(w.Msgs[0].IsTsig()).NotTo(BeNil())
+		}
+		return w.Msgs[0].Rcode
+	}
+	newUpdate := func() *dns.Msg {
+		m := new(dns.Msg)
+		m.SetUpdate("update.com.")
+		return m
+	}
+
+	// authentication
+	m := newUpdate()
+	m.Insert([]dns.RR{rr("www.update.com. 300 IN A 5.6.7.8")})
+	g.Expect(send(m, "", nil)).To(Equal(dns.RcodeRefused))
+	m = newUpdate()
+	m.Insert([]dns.RR{rr("www.update.com. 300 IN A 5.6.7.8")})
+	g.Expect(send(m, "key2.", nil)).To(Equal(dns.RcodeNotAuth))
+	m = newUpdate()
+	m.Insert([]dns.RR{rr("www.update.com. 300 IN A 5.6.7.8")})
+	g.Expect(send(m, "key3.", nil)).To(Equal(dns.RcodeRefused))
+	m = newUpdate()
+	m.Insert([]dns.RR{rr("www.update.com. 300 IN A 5.6.7.8")})
+	g.Expect(send(m, "key1.", errors.New("bad signature"))).To(Equal(dns.RcodeNotAuth))
+
+	// add records
+	m = newUpdate()
+	m.Insert([]dns.RR{
+		rr("www.update.com. 300 IN A 5.6.7.8"),
+		rr("new.update.com. 300 IN TXT \"foo\""),
+	})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeSuccess))
+	a, err := h.RedisData.A("update.com.", "www")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(a.Data)).To(Equal(2))
+	g.Expect(a.FilterConfig.Count).To(Equal("single"))
+	g.Expect(a.Data[0].Ip.String()).To(Equal("1.2.3.4"))
+	g.Expect(a.Data[0].Weight).To(Equal(10))
+	g.Expect(a.Data[0].Country).To(Equal([]string{"DE"}))
+	g.Expect(a.Data[1].Ip.String()).To(Equal("5.6.7.8"))
+	txt, err := h.RedisData.TXT("update.com.", "new")
+	g.Expect(err).To(BeNil())
+	g.Expect(txt.Data[0].Text).To(Equal("foo"))
+	fresh := storage.NewDataHandler(&updateTestCase.RedisDataConfig)
+	g.Expect(fresh.GetZoneLocations("update.com.")).To(ConsistOf("@", "www", "new"))
+	fresh.ShutDown()
+
+	// prerequisites
+	m = newUpdate()
+	m.RRsetNotUsed([]dns.RR{rr("www.update.com. 0 IN A 0.0.0.0")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeYXRrset))
+	m = newUpdate()
+	m.NameUsed([]dns.RR{rr("none.update.com. 0 IN A 0.0.0.0")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeNameError))
+	m = newUpdate()
+	m.NameNotUsed([]dns.RR{rr("new.update.com. 0 IN A 0.0.0.0")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeYXDomain))
+	m = newUpdate()
+	m.Used([]dns.RR{rr("www.update.com. 0 IN A 1.2.3.4")})
+	m.Remove([]dns.RR{rr("www.update.com. 0 IN A 1.2.3.4")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeNXRrset))
+
+	// prerequisites are checked before any change is made
+	m = newUpdate()
+	m.Used([]dns.RR{rr("www.update.com. 0 IN A 1.2.3.4"), rr("www.update.com. 0 IN A 5.6.7.8")})
+	m.RRsetUsed([]dns.RR{rr("new.update.com. 0 IN TXT \"\"")})
+	m.Remove([]dns.RR{rr("www.update.com. 0 IN A 1.2.3.4")})
+	m.RemoveName([]dns.RR{rr("new.update.com. 0 IN A 0.0.0.0")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeSuccess))
+	a, err = h.RedisData.A("update.com.", "www")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(a.Data)).To(Equal(1))
+	g.Expect(a.Data[0].Ip.String()).To(Equal("5.6.7.8"))
+	txt, err = h.RedisData.TXT("update.com.", "new")
+	g.Expect(err).To(BeNil())
+	g.Expect(txt.Empty()).To(BeTrue())
+	fresh = storage.NewDataHandler(&updateTestCase.RedisDataConfig)
+	g.Expect(fresh.GetZoneLocations("update.com.")).To(ConsistOf("@", "www"))
+	fresh.ShutDown()
+
+	// apex ns records are kept
+	m = newUpdate()
+	m.RemoveRRset([]dns.RR{rr("update.com. 0 IN NS ns1.update.com.")})
+	m.Remove([]dns.RR{rr("update.com. 0 IN NS ns1.update.com."), rr("update.com. 0 IN NS ns2.update.com.")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeSuccess))
+	ns, err := h.RedisData.NS("update.com.", "@")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(ns.Data)).To(Equal(1))
+
+	// cname cannot be added to a name with other data
+	m = newUpdate()
+	m.Insert([]dns.RR{rr("www.update.com. 300 IN CNAME other.update.com.")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeSuccess))
+	cname, err := h.RedisData.CNAME("update.com.", "www")
+	g.Expect(err).To(BeNil())
+	g.Expect(cname.Empty()).To(BeTrue())
+	a, err = h.RedisData.A("update.com.", "www")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(a.Data)).To(Equal(1))
+	m = newUpdate()
+	m.Insert([]dns.RR{rr("update.com. 300 IN CNAME other.update.com.")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeSuccess))
+	cname, err = h.RedisData.CNAME("update.com.", "@")
+	g.Expect(err).To(BeNil())
+	g.Expect(cname.Empty()).To(BeTrue())
+
+	// other data cannot be added to a cname owner, cname is replaced
+	m = newUpdate()
+	m.Insert([]dns.RR{rr("alias.update.com. 300 IN CNAME www.update.com.")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeSuccess))
+	m = newUpdate()
+	m.Insert([]dns.RR{
+		rr("alias.update.com. 300 IN A 5.6.7.8"),
+		rr("alias.update.com. 300 IN TXT \"foo\""),
+		rr("alias.update.com. 300 IN CNAME new.update.com."),
+	})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeSuccess))
+	cname, err = h.RedisData.CNAME("update.com.", "alias")
+	g.Expect(err).To(BeNil())
+	g.Expect(cname.Host).To(Equal("new.update.com."))
+	a, err = h.RedisData.A("update.com.", "alias")
+	g.Expect(err).To(BeNil())
+	g.Expect(a.Empty()).To(BeTrue())
+	txt, err = h.RedisData.TXT("update.com.", "alias")
+	g.Expect(err).To(BeNil())
+	g.Expect(txt.Empty()).To(BeTrue())
+
+	// invalid updates
+	m = newUpdate()
+	m.Insert([]dns.RR{rr("www.example.com. 300 IN A 5.6.7.8")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeNotZone))
+	m = newUpdate()
+	m.Insert([]dns.RR{rr("www.update.com. 300 IN RP mbox.update.com. txt.update.com.")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeRefused))
+	m = new(dns.Msg)
+	m.SetUpdate("www.update.com.")
+	m.Insert([]dns.RR{rr("www.update.com. 300 IN A 5.6.7.8")})
+	g.Expect(send(m, "key1.", nil)).To(Equal(dns.RcodeNotAuth))
+
+	// update keys are not valid for transfers
+	transfer := func(key string) int {
+		m := new(dns.Msg)
+		m.SetAxfr("update.com.")
+		m.SetTsig(key, dns.HmacSHA256, 300, time.Now().Unix())
+		w := &updateRecorder{transferRecorder: transferRecorder{ResponseWriter: test.ResponseWriter{TCP: true}}}
+		h.HandleRequest(NewRequestContext(w, m))
+		g.Expect(len(w.Msgs)).To(BeNumerically(">", 0))
+		return w.Msgs[0].Rcode
+	}
+	g.Expect(transfer("key1.")).To(Equal(dns.RcodeRefused))
+	g.Expect(transfer("key3.")).To(Equal(dns.RcodeSuccess))
+}
@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type Config struct {
+	Enable   bool   `json:"enable"`
+	Ip       string `json:"ip"`
+	Port     int    `json:"port"`
+	Path     string `json:"path"`
+	MaxZones int    `json:"max_zones"`
+}
+
+const (
+	namespace       = "z42"
+	defaultPath     = "/metrics"
+	defaultMaxZones = 100
+
+	// ZoneNone is used for requests not matching any zone
+	ZoneNone = "none"
+	// ZoneOther is used for zones exceeding max_zones
+	ZoneOther = "other"
+	// QTypeOther is used for query types not in knownQTypes
+	QTypeOther = "other"
+)
+
+var (
+	Queries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queries_total",
+		Help:      "number of answered queries by zone, qtype and rcode",
+	}, []string{"zone", "qtype", "rcode"})
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "query_duration_seconds",
+		Help:      "query processing time by transport protocol",
+		Buckets:   []float64{.00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"proto"})
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ratelimited_total",
+		Help:      "number of rate limited requests by limiter and action",
+	}, []string{"limiter", "action"})
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "number of zone, record and signature cache lookups by result",
+	}, []string{"cache", "result"})
+	RedisErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_errors_total",
+		Help:      "number of failed redis commands and connections",
+	}, []string{"redis"})
+	UpstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_duration_seconds",
+		Help:      "upstream query time for ANAME records",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"upstream"})
+	UpstreamFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_failures_total",
+		Help:      "number of failed upstream queries",
+	}, []string{"upstream"})
+	SigningDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "dnssec_signing_duration_seconds",
+		Help:      "time to sign an rrset by algorithm",
+		Buckets:   []float64{.00001, .000025, .00005, .0001, .00025, .0005, .001, .0025, .005, .01},
+	}, []string{"algorithm"})
+	DnstapDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dnstap_dropped_total",
+		Help:      "number of dnstap messages dropped because output buffer was full",
+	})
+
+	knownQTypes = map[uint16]struct{}{
+		dns.TypeA: {}, dns.TypeAAAA: {}, dns.TypeCNAME: {}, dns.TypeTXT: {}, dns.TypeNS: {}, dns.TypeMX: {},
+		dns.TypeSRV: {}, dns.TypeCAA: {}, dns.TypePTR: {}, dns.TypeTLSA: {}, dns.TypeDS: {}, dns.TypeSSHFP: {},
+		dns.TypeNAPTR: {}, dns.TypeURI: {}, dns.TypeHINFO: {}, dns.TypeSMIMEA: {}, dns.TypeOPENPGPKEY: {},
+		dns.TypeSVCB: {}, dns.TypeHTTPS: {}, dns.TypeDNAME: {}, dns.TypeSOA: {}, dns.TypeDNSKEY: {}, dns.TypeRRSIG: {},
+		dns.TypeNSEC: {}, dns.TypeNSEC3: {}, dns.TypeNSEC3PARAM: {}, dns.TypeCDS: {}, dns.TypeCDNSKEY: {},
+		dns.TypeAXFR: {}, dns.TypeIXFR: {}, dns.TypeANY: {},
+	}
+	registry = prometheus.NewRegistry()
+	zones    = zoneLabels{seen: make(map[string]struct{}), max: defaultMaxZones}
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Queries,
+		QueryDuration,
+		RateLimited,
+		CacheRequests,
+		RedisErrors,
+		UpstreamDuration,
+		UpstreamFailures,
+		SigningDuration,
+		DnstapDropped,
+	)
+}
+
+// zoneLabels caps number of distinct zone label values, zones seen after limit is reached share a single label
+type zoneLabels struct {
+	lock sync.RWMutex
+	seen map[string]struct{}
+	max  int
+}
+
+// Zone returns label value to use for zone
+func Zone(zone string) string {
+	if zone == "" {
+		return ZoneNone
+	}
+	zones.lock.RLock()
+	_, ok := zones.seen[zone]
+	full := len(zones.seen) >= zones.max
+	zones.lock.RUnlock()
+	if ok {
+		return zone
+	}
+	if full {
+		return ZoneOther
+	}
+	zones.lock.Lock()
+	defer zones.lock.Unlock()
+	if len(zones.seen) >= zones.max {
+		return ZoneOther
+	}
+	zones.seen[zone] = struct{}{}
+	return zone
+}
+
+// QType returns label value to use for qtype, unknown types share a single label
+func QType(qtype uint16) string {
+	if _, ok := knownQTypes[qtype]; !ok {
+		return QTypeOther
+	}
+	return dns.TypeToString[qtype]
+}
+
+// Server serves metrics over http
+type Server struct {
+	server *http.Server
+}
+
+// NewServer returns nil if metrics endpoint is disabled
+func NewServer(config *Config) *Server {
+	if config.MaxZones > 0 {
+		zones.lock.Lock()
+		zones.max = config.MaxZones
+		zones.lock.Unlock()
+	}
+	if !config.Enable {
+		return nil
+	}
+	path := config.Path
+	if path == "" {
+		path = defaultPath
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, Handler())
+	return &Server{
+		server: &http.Server{
+			Addr:    net.JoinHostPort(config.Ip, strconv.Itoa(config.Port)),
+			Handler: mux,
+		},
+	}
+}
+
+// Handler returns an http handler exposing all metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+func (s *Server) ListenAndServe() error {
+	if s == nil {
+		return nil
+	}
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Shutdown() error {
+	if s == nil {
+		return nil
+	}
+	return s.server.Shutdown(context.Background())
+}
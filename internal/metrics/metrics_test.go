@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+func TestZone(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(NewServer(&Config{Enable: false, MaxZones: 3})).To(BeNil())
+
+	g.Expect(Zone("")).To(Equal(ZoneNone))
+	for i := 0; i < 3; i++ {
+		zone := "zone" + strconv.Itoa(i) + ".com."
+		g.Expect(Zone(zone)).To(Equal(zone))
+		g.Expect(Zone(zone)).To(Equal(zone))
+	}
+	g.Expect(Zone("zone3.com.")).To(Equal(ZoneOther))
+	g.Expect(Zone("zone0.com.")).To(Equal("zone0.com."))
+}
+
+func TestQType(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(QType(dns.TypeA)).To(Equal("A"))
+	g.Expect(QType(dns.TypeHTTPS)).To(Equal("HTTPS"))
+	g.Expect(QType(dns.TypeAXFR)).To(Equal("AXFR"))
+	g.Expect(QType(dns.TypeNULL)).To(Equal(QTypeOther))
+	g.Expect(QType(65000)).To(Equal(QTypeOther))
+}
+
+func TestHandler(t *testing.T) {
+	g := NewGomegaWithT(t)
+	Queries.WithLabelValues("example.com.", "A", "NOERROR").Inc()
+	RateLimited.WithLabelValues("rrl", "drop").Inc()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	g.Expect(w.Code).To(Equal(200))
+	body, _ := io.ReadAll(w.Body)
+	g.Expect(string(body)).To(ContainSubstring(`z42_queries_total{qtype="A",rcode="NOERROR",zone="example.com."} 1`))
+	g.Expect(string(body)).To(ContainSubstring(`z42_ratelimited_total{action="drop",limiter="rrl"} 1`))
+	g.Expect(string(body)).To(ContainSubstring(`go_goroutines`))
+}
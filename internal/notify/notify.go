@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/internal/types"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"net"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Enable        bool `json:"enable"`
+	Delay         int  `json:"delay"`
+	Timeout       int  `json:"timeout"`
+	Retries       int  `json:"retries"`
+	RetryInterval int  `json:"retry_interval"`
+}
+
+type Notifier struct {
+	config    *Config
+	redisData *storage.DataHandler
+	client    *dns.Client
+	pending   map[string]*time.Timer
+	lock      sync.Mutex
+	quit      chan struct{}
+	quitWG    sync.WaitGroup
+
+	removeUpdateHandler func()
+}
+
+func NewNotifier(config *Config, redisData *storage.DataHandler) *Notifier {
+	n := &Notifier{
+		config:    config,
+		redisData: redisData,
+		client: &dns.Client{
+			Net:     "udp",
+			Timeout: time.Duration(config.Timeout) * time.Millisecond,
+		},
+		pending: make(map[string]*time.Timer),
+		quit:    make(chan struct{}),
+	}
+	if config.Enable {
+		n.removeUpdateHandler = redisData.OnZoneUpdate(n.ZoneUpdated)
+	}
+	return n
+}
+
+// ZoneUpdated schedules a notify for zone, changes received before it is sent are merged into one notify
+func (n *Notifier) ZoneUpdated(zone string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	select {
+	case <-n.quit:
+		return
+	default:
+	}
+	if _, ok := n.pending[zone]; ok {
+		return
+	}
+	n.quitWG.Add(1)
+	n.pending[zone] = time.AfterFunc(time.Duration(n.config.Delay)*time.Millisecond, func() {
+		defer n.quitWG.Done()
+		n.lock.Lock()
+		delete(n.pending, zone)
+		n.lock.Unlock()
+		n.notifyZone(zone)
+	})
+}
+
+func (n *Notifier) notifyZone(zone string) {
+	z := n.redisData.GetZone(zone)
+	if z == nil || len(z.Config.Notify) == 0 {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, target := range z.Config.Notify {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			n.send(z, target)
+		}(target)
+	}
+	wg.Wait()
+}
+
+func (n *Notifier) send(z *types.Zone, target string) {
+	address := target
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		address = net.JoinHostPort(target, "53")
+	}
+	m := new(dns.Msg)
+	m.SetNotify(z.Name)
+	m.Answer = []dns.RR{z.Config.SOA.Data}
+
+	for attempt := 0; attempt <= n.config.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-n.quit:
+				return
+			case <-time.After(time.Duration(n.config.RetryInterval) * time.Millisecond):
+			}
+		}
+		resp, _, err := n.client.Exchange(m, address)
+		if err != nil {
+			zap.L().Warn(
+				"notify timeout",
+				zap.String("zone", z.Name),
+				zap.String("target", address),
+				zap.Int("attempt", attempt+1),
+				zap.Error(err),
+			)
+			continue
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			zap.L().Error(
+				"notify rejected",
+				zap.String("zone", z.Name),
+				zap.String("target", address),
+				zap.String("rcode", dns.RcodeToString[resp.Rcode]),
+			)
+			return
+		}
+		zap.L().Info(
+			"notify sent",
+			zap.String("zone", z.Name),
+			zap.String("target", address),
+			zap.Uint32("serial", z.Config.SOA.Data.Serial),
+		)
+		return
+	}
+	zap.L().Error(
+		"notify failed",
+		zap.String("zone", z.Name),
+		zap.String("target", address),
+		zap.Int("attempts", n.config.Retries+1),
+	)
+}
+
+func (n *Notifier) ShutDown() {
+	n.lock.Lock()
+	close(n.quit)
+	for zone, timer := range n.pending {
+		if timer.Stop() {
+			n.quitWG.Done()
+		}
+		delete(n.pending, zone)
+	}
+	n.lock.Unlock()
+	n.quitWG.Wait()
+	if n.removeUpdateHandler != nil {
+		n.removeUpdateHandler()
+	}
+}
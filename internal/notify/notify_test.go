@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/pkg/hiredis"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var notifyRedisDataConfig = storage.DataHandlerConfig{
+	ZoneCacheSize:      10000,
+	ZoneCacheTimeout:   60,
+	ZoneReload:         60,
+	RecordCacheSize:    10000,
+	RecordCacheTimeout: 60,
+	MinTTL:             5,
+	MaxTTL:             300,
+	Redis: hiredis.Config{
+		Address:  "redis:6379",
+		Net:      "tcp",
+		DB:       0,
+		Password: "",
+		Prefix:   "notify_",
+		Suffix:   "_notify",
+		Connection: hiredis.ConnectionConfig{
+			MaxIdleConnections:   10,
+			MaxActiveConnections: 10,
+			ConnectTimeout:       500,
+			ReadTimeout:          500,
+			IdleKeepAlive:        30,
+			MaxKeepAlive:         0,
+			WaitForConnection:    true,
+		},
+	},
+}
+
+var notifyConfig = Config{
+	Enable:        true,
+	Delay:         100,
+	Timeout:       200,
+	Retries:       2,
+	RetryInterval: 100,
+}
+
+// secondary replies to notify messages after dropping the first `drop` ones
+func secondary(g *GomegaWithT, drop int32) (*dns.Server, string, *int32) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	g.Expect(err).To(BeNil())
+	var received int32
+	server := &dns.Server{
+		PacketConn: pc,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			if r.Opcode != dns.OpcodeNotify {
+				return
+			}
+			if atomic.AddInt32(&received, 1) <= drop {
+				return
+			}
+			m := new(dns.Msg)
+			m.SetReply(r)
+			_ = w.WriteMsg(m)
+		}),
+	}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	return server, pc.LocalAddr().String(), &received
+}
+
+func TestNotify(t *testing.T) {
+	g := NewGomegaWithT(t)
+	server, address, received := secondary(g, 0)
+	defer server.Shutdown()
+
+	dh := storage.NewDataHandler(&notifyRedisDataConfig)
+	defer dh.ShutDown()
+	g.Expect(dh.Clear()).To(BeNil())
+	g.Expect(dh.EnableZone("notify.com.")).To(BeNil())
+	g.Expect(dh.SetZoneConfigFromJson("notify.com.", `{"notify":["`+address+`"]}`)).To(BeNil())
+
+	n := NewNotifier(&notifyConfig, dh)
+	n.ZoneUpdated("notify.com.")
+	n.ZoneUpdated("notify.com.")
+	n.ZoneUpdated("notify.com.")
+	time.Sleep(500 * time.Millisecond)
+	g.Expect(atomic.LoadInt32(received)).To(Equal(int32(1)))
+
+	n.ZoneUpdated("notify.com.")
+	time.Sleep(500 * time.Millisecond)
+	g.Expect(atomic.LoadInt32(received)).To(Equal(int32(2)))
+	n.ShutDown()
+}
+
+func TestNotifyRetry(t *testing.T) {
+	g := NewGomegaWithT(t)
+	server, address, received := secondary(g, 1)
+	defer server.Shutdown()
+
+	dh := storage.NewDataHandler(&notifyRedisDataConfig)
+	defer dh.ShutDown()
+	g.Expect(dh.Clear()).To(BeNil())
+	g.Expect(dh.EnableZone("notify.com.")).To(BeNil())
+	g.Expect(dh.SetZoneConfigFromJson("notify.com.", `{"notify":["`+address+`"]}`)).To(BeNil())
+
+	n := NewNotifier(&notifyConfig, dh)
+	n.ZoneUpdated("notify.com.")
+	time.Sleep(800 * time.Millisecond)
+	g.Expect(atomic.LoadInt32(received)).To(Equal(int32(2)))
+	n.ShutDown()
+}
@@ -0,0 +1,298 @@
+package rollover
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hawell/z42/internal/dnssec"
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/internal/types"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Enable           bool   `json:"enable"`
+	CheckInterval    int    `json:"check_interval"`
+	Algorithm        string `json:"algorithm"`
+	DnsKeyTTL        int    `json:"dnskey_ttl"`
+	ZSKLifetime      int    `json:"zsk_lifetime"`
+	KSKLifetime      int    `json:"ksk_lifetime"`
+	PropagationDelay int    `json:"propagation_delay"`
+	MaxZoneTTL       int    `json:"max_zone_ttl"`
+	ParentDSTTL      int    `json:"parent_ds_ttl"`
+}
+
+var ErrInvalidInterval = errors.New("rollover check interval must be positive")
+
+// Verify checks rollover can be scheduled
+func (config *Config) Verify() error {
+	if config.CheckInterval <= 0 {
+		return ErrInvalidInterval
+	}
+	if !dnssec.SupportedAlgorithm(dns.StringToAlgorithm[strings.ToUpper(config.Algorithm)]) {
+		return dnssec.ErrUnsupportedAlgorithm
+	}
+	return nil
+}
+
+// Rollover generates, publishes, activates and retires zone signing keys of dnssec enabled zones
+type Rollover struct {
+	config    *Config
+	redisData *storage.DataHandler
+	algorithm uint8
+	quit      chan struct{}
+	quitWG    sync.WaitGroup
+}
+
+func NewRollover(config *Config, redisData *storage.DataHandler) *Rollover {
+	r := &Rollover{
+		config:    config,
+		redisData: redisData,
+		algorithm: dns.StringToAlgorithm[strings.ToUpper(config.Algorithm)],
+		quit:      make(chan struct{}),
+	}
+	if config.Enable {
+		if err := config.Verify(); err != nil {
+			zap.L().Error("rollover disabled", zap.Error(err))
+			return r
+		}
+		r.quitWG.Add(1)
+		go r.run()
+	}
+	return r
+}
+
+func (r *Rollover) ShutDown() {
+	close(r.quit)
+	r.quitWG.Wait()
+}
+
+func (r *Rollover) run() {
+	defer r.quitWG.Done()
+	ticker := time.NewTicker(time.Duration(r.config.CheckInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		r.CheckZones(time.Now())
+		select {
+		case <-r.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckZones advances key lifecycle of all dnssec enabled zones to time now
+func (r *Rollover) CheckZones(now time.Time) {
+	for _, zone := range r.redisData.GetZones() {
+		config, err := r.redisData.LoadZoneConfig(zone)
+		if err != nil {
+			zap.L().Error("cannot load zone config", zap.String("zone", zone), zap.Error(err))
+			continue
+		}
+		if !config.DnsSec {
+			continue
+		}
+		if err := r.checkZone(zone, now.Unix()); err != nil {
+			zap.L().Error("key rollover failed", zap.String("zone", zone), zap.Error(err))
+		}
+	}
+}
+
+func (r *Rollover) checkZone(zone string, now int64) error {
+	keys, err := r.redisData.GetZoneKeys(zone)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		if err := r.importKeys(zone, keys, now); err != nil {
+			return err
+		}
+	}
+	for _, keyType := range []string{"zsk", "ksk"} {
+		if err := r.rollKeys(zone, keyType, keys, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importKeys takes over keys set with SetZoneKey as active keys
+func (r *Rollover) importKeys(zone string, keys map[string]*types.ZoneKeyInfo, now int64) error {
+	for _, keyType := range []string{"zsk", "ksk"} {
+		pub, priv, err := r.redisData.GetZoneKey(zone, keyType)
+		if err != nil || pub == "" || priv == "" {
+			continue
+		}
+		key := &types.ZoneKeyInfo{
+			Type:      keyType,
+			State:     types.KeyStateActive,
+			Public:    pub,
+			Private:   priv,
+			Created:   now,
+			Published: now,
+			Activated: now,
+		}
+		if err := r.addKey(zone, key, keys); err != nil {
+			return err
+		}
+		zap.L().Info("key imported", zap.String("zone", zone), zap.String("type", keyType))
+	}
+	return nil
+}
+
+func (r *Rollover) rollKeys(zone string, keyType string, keys map[string]*types.ZoneKeyInfo, now int64) error {
+	lifetime := int64(r.config.ZSKLifetime)
+	retireDelay := int64(r.config.MaxZoneTTL + r.config.PropagationDelay)
+	if keyType == "ksk" {
+		lifetime = int64(r.config.KSKLifetime)
+		retireDelay = int64(r.config.ParentDSTTL + r.config.PropagationDelay)
+	}
+	publishDelay := int64(r.config.DnsKeyTTL + r.config.PropagationDelay)
+
+	ids := make([]string, 0, len(keys))
+	for id, key := range keys {
+		if key.Type == keyType {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	var actives []string
+	successorId := ""
+	for _, id := range ids {
+		key := keys[id]
+		switch key.State {
+		case types.KeyStateActive:
+			actives = append(actives, id)
+		case types.KeyStatePublished:
+			successorId = id
+		case types.KeyStateRetired:
+			if now >= key.Retired+retireDelay {
+				key.State, key.Removed = types.KeyStateRemoved, now
+				if err := r.redisData.SetZoneKeyInfo(zone, id, key); err != nil {
+					return err
+				}
+				zap.L().Info("key removed", zap.String("zone", zone), zap.String("id", id))
+			}
+		case types.KeyStateRemoved:
+			if now >= key.Removed+retireDelay {
+				if err := r.redisData.DeleteZoneKeyInfo(zone, id); err != nil {
+					return err
+				}
+				delete(keys, id)
+			}
+		}
+	}
+	sort.Slice(actives, func(i, j int) bool { return keys[actives[i]].Activated > keys[actives[j]].Activated })
+	// only the most recently activated key is used, others are left over from interrupted rollovers
+	for i := 1; i < len(actives); i++ {
+		if err := r.retire(zone, actives[i], keys[actives[i]], now); err != nil {
+			return err
+		}
+	}
+
+	if len(actives) == 0 {
+		if successorId != "" {
+			return r.activate(zone, successorId, keys[successorId], now)
+		}
+		key, err := r.generateKey(zone, keyType, r.algorithm, types.KeyStateActive, now)
+		if err != nil {
+			return err
+		}
+		zap.L().Info("key generated", zap.String("zone", zone), zap.String("type", keyType))
+		return r.addKey(zone, key, keys)
+	}
+
+	activeId := actives[0]
+	active := keys[activeId]
+	if now < active.Activated+lifetime-publishDelay {
+		return nil
+	}
+	if successorId == "" {
+		algorithm := r.algorithm
+		if rr, err := dns.NewRR(active.Public); err == nil && rr != nil {
+			if dnskey, ok := rr.(*dns.DNSKEY); ok {
+				algorithm = dnskey.Algorithm
+			}
+		}
+		key, err := r.generateKey(zone, keyType, algorithm, types.KeyStatePublished, now)
+		if err != nil {
+			return err
+		}
+		if err := r.addKey(zone, key, keys); err != nil {
+			return err
+		}
+		zap.L().Info("successor key published", zap.String("zone", zone), zap.String("type", keyType))
+		return nil
+	}
+	successor := keys[successorId]
+	if now >= successor.Published+publishDelay && now >= active.Activated+lifetime {
+		// old ksk is retired only after parent DS is known to point to successor, otherwise zone becomes bogus when it is removed
+		if keyType == "ksk" && successor.DSConfirmed == 0 {
+			zap.L().Warn("ksk rollover is waiting for ds confirmation", zap.String("zone", zone), zap.String("id", successorId))
+			return nil
+		}
+		if err := r.activate(zone, successorId, successor, now); err != nil {
+			return err
+		}
+		return r.retire(zone, activeId, active, now)
+	}
+	return nil
+}
+
+func (r *Rollover) activate(zone string, id string, key *types.ZoneKeyInfo, now int64) error {
+	key.State, key.Activated = types.KeyStateActive, now
+	if err := r.redisData.SetZoneKeyInfo(zone, id, key); err != nil {
+		return err
+	}
+	zap.L().Info("key activated", zap.String("zone", zone), zap.String("id", id))
+	return nil
+}
+
+func (r *Rollover) retire(zone string, id string, key *types.ZoneKeyInfo, now int64) error {
+	key.State, key.Retired = types.KeyStateRetired, now
+	if err := r.redisData.SetZoneKeyInfo(zone, id, key); err != nil {
+		return err
+	}
+	zap.L().Info("key retired", zap.String("zone", zone), zap.String("id", id))
+	return nil
+}
+
+func (r *Rollover) generateKey(zone string, keyType string, algorithm uint8, state string, now int64) (*types.ZoneKeyInfo, error) {
+	pub, priv, err := dnssec.GenerateKey(zone, keyType, algorithm, uint32(r.config.DnsKeyTTL))
+	if err != nil {
+		return nil, err
+	}
+	key := &types.ZoneKeyInfo{
+		Type:      keyType,
+		State:     state,
+		Public:    pub,
+		Private:   priv,
+		Created:   now,
+		Published: now,
+	}
+	if state == types.KeyStateActive {
+		key.Activated = now
+	}
+	return key, nil
+}
+
+func (r *Rollover) addKey(zone string, key *types.ZoneKeyInfo, keys map[string]*types.ZoneKeyInfo) error {
+	rr, err := dns.NewRR(key.Public)
+	if err != nil {
+		return err
+	}
+	dnskey, ok := rr.(*dns.DNSKEY)
+	if !ok {
+		return fmt.Errorf("invalid public key: %s", key.Public)
+	}
+	id := fmt.Sprintf("%s-%d-%d", key.Type, dnskey.KeyTag(), key.Created)
+	if key.Type == "ksk" && key.State == types.KeyStatePublished {
+		zap.L().Info("new ksk published, update ds records at parent and confirm with admin api", zap.String("zone", zone), zap.String("ds", dnskey.ToDS(dns.SHA256).String()))
+	}
+	keys[id] = key
+	return r.redisData.SetZoneKeyInfo(zone, id, key)
+}
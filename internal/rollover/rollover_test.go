@@ -0,0 +1,217 @@
+package rollover
+
+import (
+	"github.com/hawell/z42/internal/dnssec"
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/internal/types"
+	"github.com/hawell/z42/pkg/hiredis"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"testing"
+	"time"
+)
+
+var rolloverRedisDataConfig = storage.DataHandlerConfig{
+	ZoneCacheSize:      10000,
+	ZoneCacheTimeout:   60,
+	ZoneReload:         60,
+	RecordCacheSize:    10000,
+	RecordCacheTimeout: 60,
+	MinTTL:             5,
+	MaxTTL:             300,
+	Redis: hiredis.Config{
+		Address:  "redis:6379",
+		Net:      "tcp",
+		DB:       0,
+		Password: "",
+		Prefix:   "rollover_",
+		Suffix:   "_rollover",
+		Connection: hiredis.ConnectionConfig{
+			MaxIdleConnections:   10,
+			MaxActiveConnections: 10,
+			ConnectTimeout:       500,
+			ReadTimeout:          500,
+			IdleKeepAlive:        30,
+			MaxKeepAlive:         0,
+			WaitForConnection:    true,
+		},
+	},
+}
+
+var rolloverConfig = Config{
+	Enable:           false,
+	CheckInterval:    3600,
+	Algorithm:        "ECDSAP256SHA256",
+	DnsKeyTTL:        10,
+	ZSKLifetime:      100,
+	KSKLifetime:      1000,
+	PropagationDelay: 5,
+	MaxZoneTTL:       20,
+	ParentDSTTL:      50,
+}
+
+// loadZone reads zone with a new data handler since keyspace notifications are not available in tests
+func loadZone(g *GomegaWithT, zone string) *types.Zone {
+	dh := storage.NewDataHandler(&rolloverRedisDataConfig)
+	defer dh.ShutDown()
+	z := dh.GetZone(zone)
+	g.Expect(z).NotTo(BeNil())
+	g.Expect(z.Config.DnsSec).To(BeTrue())
+	for _, sig := range z.DnsKeySigs {
+		rrsig := sig.(*dns.RRSIG)
+		verified := false
+		for _, rr := range z.DnsKeys {
+			if key := rr.(*dns.DNSKEY); key.Flags == 257 && key.KeyTag() == rrsig.KeyTag {
+				g.Expect(rrsig.Verify(key, z.DnsKeys)).To(BeNil())
+				verified = true
+			}
+		}
+		g.Expect(verified).To(BeTrue())
+	}
+	return z
+}
+
+func countKeys(keys map[string]*types.ZoneKeyInfo, keyType string, state string) int {
+	count := 0
+	for _, key := range keys {
+		if key.Type == keyType && key.State == state {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRollover(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dh := storage.NewDataHandler(&rolloverRedisDataConfig)
+	defer dh.ShutDown()
+	g.Expect(dh.Clear()).To(BeNil())
+	g.Expect(dh.EnableZone("rollover.com.")).To(BeNil())
+	g.Expect(dh.SetZoneConfigFromJson("rollover.com.", `{"dnssec":true}`)).To(BeNil())
+	g.Expect(dh.EnableZone("unsigned.com.")).To(BeNil())
+	g.Expect(dh.SetZoneConfigFromJson("unsigned.com.", `{"dnssec":false}`)).To(BeNil())
+
+	r := NewRollover(&rolloverConfig, dh)
+	defer r.ShutDown()
+	t0 := time.Unix(1000000, 0)
+	at := func(offset int64) time.Time { return t0.Add(time.Duration(offset) * time.Second) }
+
+	// initial keys
+	r.CheckZones(t0)
+	keys, err := dh.GetZoneKeys("unsigned.com.")
+	g.Expect(err).To(BeNil())
+	g.Expect(keys).To(BeEmpty())
+	keys, err = dh.GetZoneKeys("rollover.com.")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(keys)).To(Equal(2))
+	z := loadZone(g, "rollover.com.")
+	g.Expect(len(z.DnsKeys)).To(Equal(2))
+	g.Expect(len(z.DnsKeySigs)).To(Equal(1))
+	g.Expect(z.ZSK.DnsKey.Algorithm).To(Equal(dns.ECDSAP256SHA256))
+	zsk := z.ZSK.DnsKey.KeyTag()
+	ksk := z.KSK.DnsKey.KeyTag()
+
+	// zsk pre-publish
+	r.CheckZones(at(84))
+	keys, _ = dh.GetZoneKeys("rollover.com.")
+	g.Expect(len(keys)).To(Equal(2))
+	r.CheckZones(at(85))
+	keys, _ = dh.GetZoneKeys("rollover.com.")
+	g.Expect(countKeys(keys, "zsk", types.KeyStatePublished)).To(Equal(1))
+	z = loadZone(g, "rollover.com.")
+	g.Expect(len(z.DnsKeys)).To(Equal(3))
+	g.Expect(z.ZSK.DnsKey.KeyTag()).To(Equal(zsk))
+
+	// zsk rollover
+	r.CheckZones(at(100))
+	keys, _ = dh.GetZoneKeys("rollover.com.")
+	g.Expect(countKeys(keys, "zsk", types.KeyStateActive)).To(Equal(1))
+	g.Expect(countKeys(keys, "zsk", types.KeyStateRetired)).To(Equal(1))
+	z = loadZone(g, "rollover.com.")
+	g.Expect(len(z.DnsKeys)).To(Equal(3))
+	g.Expect(z.ZSK.DnsKey.KeyTag()).NotTo(Equal(zsk))
+
+	// retired zsk is removed from dnskey rrset and later deleted
+	r.CheckZones(at(125))
+	keys, _ = dh.GetZoneKeys("rollover.com.")
+	g.Expect(countKeys(keys, "zsk", types.KeyStateRemoved)).To(Equal(1))
+	z = loadZone(g, "rollover.com.")
+	g.Expect(len(z.DnsKeys)).To(Equal(2))
+	r.CheckZones(at(150))
+	keys, _ = dh.GetZoneKeys("rollover.com.")
+	g.Expect(len(keys)).To(Equal(2))
+
+	// ksk double signature
+	r.CheckZones(at(985))
+	keys, _ = dh.GetZoneKeys("rollover.com.")
+	g.Expect(countKeys(keys, "ksk", types.KeyStatePublished)).To(Equal(1))
+	z = loadZone(g, "rollover.com.")
+	g.Expect(len(z.DnsKeySigs)).To(Equal(2))
+	g.Expect(z.KSK.DnsKey.KeyTag()).To(Equal(ksk))
+	g.Expect(len(z.KSKs)).To(Equal(2))
+
+	// old ksk is kept active until ds is confirmed
+	r.CheckZones(at(1000))
+	keys, _ = dh.GetZoneKeys("rollover.com.")
+	g.Expect(countKeys(keys, "ksk", types.KeyStatePublished)).To(Equal(1))
+	g.Expect(countKeys(keys, "ksk", types.KeyStateRetired)).To(Equal(0))
+	confirmed, err := dh.ConfirmDS("rollover.com.")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(confirmed)).To(Equal(1))
+
+	r.CheckZones(at(1000))
+	keys, _ = dh.GetZoneKeys("rollover.com.")
+	g.Expect(countKeys(keys, "ksk", types.KeyStateActive)).To(Equal(1))
+	g.Expect(countKeys(keys, "ksk", types.KeyStateRetired)).To(Equal(1))
+	z = loadZone(g, "rollover.com.")
+	g.Expect(len(z.DnsKeySigs)).To(Equal(2))
+	g.Expect(z.KSK.DnsKey.KeyTag()).NotTo(Equal(ksk))
+	g.Expect(len(z.KSKs)).To(Equal(1))
+
+	r.CheckZones(at(1055))
+	keys, _ = dh.GetZoneKeys("rollover.com.")
+	g.Expect(countKeys(keys, "ksk", types.KeyStateRemoved)).To(Equal(1))
+	z = loadZone(g, "rollover.com.")
+	g.Expect(len(z.DnsKeySigs)).To(Equal(1))
+}
+
+func TestVerifyConfig(t *testing.T) {
+	g := NewGomegaWithT(t)
+	config := rolloverConfig
+	g.Expect(config.Verify()).To(BeNil())
+	config.CheckInterval = 0
+	g.Expect(config.Verify()).To(Equal(ErrInvalidInterval))
+	config = rolloverConfig
+	config.Algorithm = "ED448"
+	g.Expect(config.Verify()).To(BeNil())
+	config.Algorithm = "RSAMD5"
+	g.Expect(config.Verify()).To(Equal(dnssec.ErrUnsupportedAlgorithm))
+}
+
+func TestImportKeys(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dh := storage.NewDataHandler(&rolloverRedisDataConfig)
+	defer dh.ShutDown()
+	g.Expect(dh.Clear()).To(BeNil())
+	g.Expect(dh.EnableZone("import.com.")).To(BeNil())
+	g.Expect(dh.SetZoneConfigFromJson("import.com.", `{"dnssec":true}`)).To(BeNil())
+	zskPub, zskPriv, err := dnssec.GenerateKey("import.com.", "zsk", dns.RSASHA256, 300)
+	g.Expect(err).To(BeNil())
+	kskPub, kskPriv, err := dnssec.GenerateKey("import.com.", "ksk", dns.RSASHA256, 300)
+	g.Expect(err).To(BeNil())
+	g.Expect(dh.SetZoneKey("import.com.", "zsk", zskPub, zskPriv)).To(BeNil())
+	g.Expect(dh.SetZoneKey("import.com.", "ksk", kskPub, kskPriv)).To(BeNil())
+	before := loadZone(g, "import.com.")
+
+	r := NewRollover(&rolloverConfig, dh)
+	defer r.ShutDown()
+	r.CheckZones(time.Now())
+	keys, err := dh.GetZoneKeys("import.com.")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(keys)).To(Equal(2))
+	g.Expect(countKeys(keys, "zsk", types.KeyStateActive)).To(Equal(1))
+	g.Expect(countKeys(keys, "ksk", types.KeyStateActive)).To(Equal(1))
+	after := loadZone(g, "import.com.")
+	g.Expect(after.ZSK.DnsKey.KeyTag()).To(Equal(before.ZSK.DnsKey.KeyTag()))
+	g.Expect(after.KSK.DnsKey.KeyTag()).To(Equal(before.KSK.DnsKey.KeyTag()))
+}
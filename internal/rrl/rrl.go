@@ -0,0 +1,175 @@
+package rrl
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	Enable             bool `json:"enable"`
+	ResponsesPerSecond int  `json:"responses_per_second"`
+	NxdomainsPerSecond int  `json:"nxdomains_per_second"`
+	ErrorsPerSecond    int  `json:"errors_per_second"`
+	Window             int  `json:"window"`
+	Slip               int  `json:"slip"`
+	IPv4PrefixLength   int  `json:"ipv4_prefix_length"`
+	IPv6PrefixLength   int  `json:"ipv6_prefix_length"`
+	LogOnly            bool `json:"log_only"`
+}
+
+// Category of a response, each category has its own rate
+type Category int
+
+const (
+	// CategoryResponse is a positive answer, nodata or referral, accounted by qname and qtype
+	CategoryResponse Category = iota
+	// CategoryNxdomain is accounted by zone so random subdomains share a bucket
+	CategoryNxdomain
+	// CategoryError is any other rcode, accounted by client prefix only
+	CategoryError
+)
+
+type Action int
+
+const (
+	ActionSend Action = iota
+	ActionDrop
+	// ActionSlip means a truncated response should be sent so legitimate clients retry over tcp
+	ActionSlip
+)
+
+const (
+	defaultWindow           = 15
+	defaultIPv4PrefixLength = 24
+	defaultIPv6PrefixLength = 56
+)
+
+// RateLimiter limits identical responses sent to a client network (BIND style response rate limiting)
+type RateLimiter struct {
+	config   *Config
+	buckets  *cache.Cache
+	window   time.Duration
+	ipv4Mask net.IPMask
+	ipv6Mask net.IPMask
+}
+
+type bucket struct {
+	lock     sync.Mutex
+	balance  float64
+	last     time.Time
+	dropped  int
+	limiting bool
+}
+
+// NewRateLimiter returns nil if rate limiting is disabled
+func NewRateLimiter(config *Config) *RateLimiter {
+	if !config.Enable {
+		return nil
+	}
+	window := config.Window
+	if window <= 0 {
+		window = defaultWindow
+	}
+	ipv4PrefixLength := config.IPv4PrefixLength
+	if ipv4PrefixLength <= 0 || ipv4PrefixLength > 32 {
+		ipv4PrefixLength = defaultIPv4PrefixLength
+	}
+	ipv6PrefixLength := config.IPv6PrefixLength
+	if ipv6PrefixLength <= 0 || ipv6PrefixLength > 128 {
+		ipv6PrefixLength = defaultIPv6PrefixLength
+	}
+	rl := &RateLimiter{
+		config:   config,
+		window:   time.Duration(window) * time.Second,
+		ipv4Mask: net.CIDRMask(ipv4PrefixLength, 32),
+		ipv6Mask: net.CIDRMask(ipv6PrefixLength, 128),
+	}
+	rl.buckets = cache.New(rl.window, rl.window*2)
+	return rl
+}
+
+func (rl *RateLimiter) rate(category Category) int {
+	switch category {
+	case CategoryNxdomain:
+		return rl.config.NxdomainsPerSecond
+	case CategoryError:
+		return rl.config.ErrorsPerSecond
+	default:
+		return rl.config.ResponsesPerSecond
+	}
+}
+
+// Check accounts a response to client, name and qtype are ignored for errors. a rate of 0 disables limiting for category
+func (rl *RateLimiter) Check(client net.IP, category Category, name string, qtype uint16, now time.Time) Action {
+	if rl == nil || client == nil {
+		return ActionSend
+	}
+	rate := rl.rate(category)
+	if rate <= 0 {
+		return ActionSend
+	}
+
+	var network net.IP
+	if ip := client.To4(); ip != nil {
+		network = ip.Mask(rl.ipv4Mask)
+	} else {
+		network = client.Mask(rl.ipv6Mask)
+	}
+	key := network.String() + "|" + strconv.Itoa(int(category))
+	switch category {
+	case CategoryResponse:
+		key += "|" + name + "|" + strconv.Itoa(int(qtype))
+	case CategoryNxdomain:
+		key += "|" + name
+	}
+
+	value, found := rl.buckets.Get(key)
+	if !found {
+		value = &bucket{balance: float64(rate), last: now}
+		// another goroutine may have added the bucket in between
+		if err := rl.buckets.Add(key, value, rl.window); err != nil {
+			value, _ = rl.buckets.Get(key)
+		}
+	} else {
+		rl.buckets.Set(key, value, rl.window)
+	}
+	b := value.(*bucket)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	// credit is limited to one second of responses, debt to window seconds
+	b.balance += now.Sub(b.last).Seconds() * float64(rate)
+	b.last = now
+	if b.balance > float64(rate) {
+		b.balance = float64(rate)
+	}
+	b.balance--
+	if debt := -float64(rate) * rl.window.Seconds(); b.balance < debt {
+		b.balance = debt
+	}
+	if b.balance >= 0 {
+		if b.limiting {
+			zap.L().Info("rrl stopped", zap.String("key", key), zap.Int("dropped", b.dropped))
+			b.limiting, b.dropped = false, 0
+		}
+		return ActionSend
+	}
+
+	if !b.limiting {
+		zap.L().Info("rrl started", zap.String("key", key), zap.Bool("log_only", rl.config.LogOnly))
+		b.limiting = true
+	}
+	b.dropped++
+	if rl.config.LogOnly {
+		return ActionSend
+	}
+	if rl.config.Slip > 0 && b.dropped%rl.config.Slip == 0 {
+		return ActionSlip
+	}
+	return ActionDrop
+}
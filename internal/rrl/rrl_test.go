@@ -0,0 +1,54 @@
+package rrl
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+func TestCheck(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(NewRateLimiter(&Config{Enable: false})).To(BeNil())
+	rl := NewRateLimiter(&Config{Enable: true, ResponsesPerSecond: 5, NxdomainsPerSecond: 2, ErrorsPerSecond: 0, Window: 5, Slip: 2})
+
+	now := time.Now()
+	client := net.ParseIP("192.0.2.1")
+	count := func(category Category, name string, qtype uint16, client net.IP) map[Action]int {
+		res := make(map[Action]int)
+		for i := 0; i < 10; i++ {
+			res[rl.Check(client, category, name, qtype, now)]++
+		}
+		return res
+	}
+
+	// over limit responses are dropped, every second one is truncated
+	g.Expect(count(CategoryResponse, "www.example.com.", dns.TypeA, client)).To(Equal(map[Action]int{ActionSend: 5, ActionDrop: 3, ActionSlip: 2}))
+	// same network shares buckets, different responses don't
+	g.Expect(rl.Check(net.ParseIP("192.0.2.200"), CategoryResponse, "www.example.com.", dns.TypeA, now)).NotTo(Equal(ActionSend))
+	g.Expect(rl.Check(net.ParseIP("192.0.3.1"), CategoryResponse, "www.example.com.", dns.TypeA, now)).To(Equal(ActionSend))
+	g.Expect(rl.Check(client, CategoryResponse, "www.example.com.", dns.TypeAAAA, now)).To(Equal(ActionSend))
+	g.Expect(rl.Check(client, CategoryResponse, "example.com.", dns.TypeA, now)).To(Equal(ActionSend))
+
+	// limited clients have to stay below rate for a while
+	now = now.Add(time.Second)
+	g.Expect(rl.Check(client, CategoryResponse, "www.example.com.", dns.TypeA, now)).NotTo(Equal(ActionSend))
+	now = now.Add(5 * time.Second)
+	g.Expect(rl.Check(client, CategoryResponse, "www.example.com.", dns.TypeA, now)).To(Equal(ActionSend))
+
+	// nxdomains have their own rate, errors are not limited with a zero rate
+	g.Expect(count(CategoryNxdomain, "example.com.", dns.TypeA, client)[ActionSend]).To(Equal(2))
+	g.Expect(count(CategoryError, "", dns.TypeA, client)[ActionSend]).To(Equal(10))
+
+	// ipv6 clients are grouped by /56
+	client = net.ParseIP("2001:db8:0:1::1")
+	g.Expect(count(CategoryResponse, "www.example.com.", dns.TypeA, client)[ActionSend]).To(Equal(5))
+	g.Expect(rl.Check(net.ParseIP("2001:db8:0:ff::1"), CategoryResponse, "www.example.com.", dns.TypeA, now)).NotTo(Equal(ActionSend))
+	g.Expect(rl.Check(net.ParseIP("2001:db8:0:100::1"), CategoryResponse, "www.example.com.", dns.TypeA, now)).To(Equal(ActionSend))
+
+	// log only mode never limits
+	rl = NewRateLimiter(&Config{Enable: true, ResponsesPerSecond: 1, LogOnly: true})
+	g.Expect(count(CategoryResponse, "www.example.com.", dns.TypeA, client)[ActionSend]).To(Equal(10))
+}
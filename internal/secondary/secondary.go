@@ -0,0 +1,484 @@
+package secondary
+
+import (
+	"errors"
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/internal/tsig"
+	"github.com/hawell/z42/internal/types"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PrimaryConfig struct {
+	Address string `json:"address"`
+	TsigKey string `json:"tsig_key"`
+}
+
+// UnmarshalJSON accepts a plain address as well as an object
+func (p *PrimaryConfig) UnmarshalJSON(data []byte) error {
+	var address string
+	if err := jsoniter.Unmarshal(data, &address); err == nil {
+		*p = PrimaryConfig{Address: address}
+		return nil
+	}
+	type primaryConfig PrimaryConfig
+	return jsoniter.Unmarshal(data, (*primaryConfig)(p))
+}
+
+type ZoneConfig struct {
+	Zone      string          `json:"zone"`
+	Primaries []PrimaryConfig `json:"primaries"`
+}
+
+type Config struct {
+	Enable  bool         `json:"enable"`
+	Timeout int          `json:"timeout"`
+	Zones   []ZoneConfig `json:"zones"`
+}
+
+type Secondary struct {
+	config    *Config
+	redisData *storage.DataHandler
+	keyring   func() *tsig.Keyring
+	zones     map[string]*zone
+	quit      chan struct{}
+	quitWG    sync.WaitGroup
+}
+
+type zone struct {
+	name        string
+	primaries   []string
+	keys        map[string]string
+	loaded      bool
+	expired     bool
+	serial      uint32
+	refresh     time.Duration
+	retry       time.Duration
+	expire      time.Duration
+	lastRefresh time.Time
+	notify      chan struct{}
+}
+
+const (
+	defaultRetry = 60 * time.Second
+)
+
+var (
+	noPrimaryError = errors.New("no primary available")
+	invalidAnswer  = errors.New("invalid transfer answer")
+	unknownKey     = errors.New("unknown tsig key")
+)
+
+// NewSecondary starts refreshing configured zones, keyring returns the current keyring used to sign requests to primaries
+func NewSecondary(config *Config, redisData *storage.DataHandler, keyring func() *tsig.Keyring) *Secondary {
+	s := &Secondary{
+		config:    config,
+		redisData: redisData,
+		keyring:   keyring,
+		zones:     make(map[string]*zone),
+		quit:      make(chan struct{}),
+	}
+	if !config.Enable {
+		return s
+	}
+	for _, zoneConfig := range config.Zones {
+		z := &zone{
+			name:   dns.Fqdn(strings.ToLower(zoneConfig.Zone)),
+			retry:  defaultRetry,
+			notify: make(chan struct{}, 1),
+			keys:   make(map[string]string),
+		}
+		for _, primaryConfig := range zoneConfig.Primaries {
+			primary := primaryConfig.Address
+			if _, _, err := net.SplitHostPort(primary); err != nil {
+				primary = net.JoinHostPort(primary, "53")
+			}
+			z.primaries = append(z.primaries, primary)
+			if primaryConfig.TsigKey != "" {
+				z.keys[primary] = primaryConfig.TsigKey
+			}
+		}
+		s.zones[z.name] = z
+		s.quitWG.Add(1)
+		go s.run(z)
+	}
+	return s
+}
+
+// Notify triggers an immediate refresh of zone if source is one of its primaries
+func (s *Secondary) Notify(zoneName string, source string) bool {
+	z, ok := s.zones[zoneName]
+	if !ok {
+		return false
+	}
+	ip := net.ParseIP(source)
+	for _, primary := range z.primaries {
+		host, _, _ := net.SplitHostPort(primary)
+		if primaryIp := net.ParseIP(host); primaryIp != nil && primaryIp.Equal(ip) {
+			return s.Refresh(zoneName)
+		}
+	}
+	return false
+}
+
+// Refresh triggers an immediate refresh of zone regardless of notification source
+func (s *Secondary) Refresh(zoneName string) bool {
+	z, ok := s.zones[zoneName]
+	if !ok {
+		return false
+	}
+	select {
+	case z.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (s *Secondary) ShutDown() {
+	close(s.quit)
+	s.quitWG.Wait()
+}
+
+func (s *Secondary) run(z *zone) {
+	defer s.quitWG.Done()
+	s.loadZone(z)
+	for {
+		wait := s.refreshZone(z)
+		select {
+		case <-s.quit:
+			return
+		case <-z.notify:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// loadZone picks up zone data from previous runs
+func (s *Secondary) loadZone(z *zone) {
+	config := s.zoneConfig(z)
+	for _, name := range s.redisData.GetZones() {
+		if name == z.name && len(config.Primaries) > 0 {
+			z.loaded = true
+			z.lastRefresh = time.Now()
+			z.setTimers(config.SOA.Data)
+			return
+		}
+	}
+}
+
+func (s *Secondary) zoneConfig(z *zone) *types.ZoneConfig {
+	config, err := s.redisData.GetZoneConfig(z.name)
+	if err != nil {
+		config = types.ZoneConfigFromJson(z.name, "")
+	}
+	return config
+}
+
+func (z *zone) setTimers(soa *dns.SOA) {
+	z.serial = soa.Serial
+	z.refresh = time.Duration(soa.Refresh) * time.Second
+	z.retry = time.Duration(soa.Retry) * time.Second
+	z.expire = time.Duration(soa.Expire) * time.Second
+}
+
+func (s *Secondary) refreshZone(z *zone) time.Duration {
+	err := s.transferZone(z)
+	if err == nil {
+		z.lastRefresh = time.Now()
+		if z.expired {
+			z.expired = false
+			if err := s.redisData.EnableZone(z.name); err != nil {
+				zap.L().Error("cannot enable zone", zap.String("zone", z.name), zap.Error(err))
+			}
+		}
+		return z.refresh
+	}
+	zap.L().Error("zone refresh failed", zap.String("zone", z.name), zap.Error(err))
+	if z.loaded && !z.expired && time.Since(z.lastRefresh) > z.expire {
+		zap.L().Error("zone expired", zap.String("zone", z.name))
+		z.expired = true
+		if err := s.redisData.DisableZone(z.name); err != nil {
+			zap.L().Error("cannot disable zone", zap.String("zone", z.name), zap.Error(err))
+		}
+	}
+	return z.retry
+}
+
+func (s *Secondary) transferZone(z *zone) error {
+	for _, primary := range z.primaries {
+		soa, err := s.primarySOA(z, primary)
+		if err != nil {
+			zap.L().Warn("cannot get soa from primary", zap.String("zone", z.name), zap.String("primary", primary), zap.Error(err))
+			continue
+		}
+		if z.loaded && !z.expired && !serialLess(z.serial, soa.Serial) {
+			return nil
+		}
+		records, err := s.transferIn(z, primary)
+		if err != nil {
+			zap.L().Warn("zone transfer failed", zap.String("zone", z.name), zap.String("primary", primary), zap.Error(err))
+			continue
+		}
+		if err := s.apply(z, records); err != nil {
+			return err
+		}
+		zap.L().Info("zone transferred", zap.String("zone", z.name), zap.String("primary", primary), zap.Uint32("serial", z.serial))
+		return nil
+	}
+	return noPrimaryError
+}
+
+func (s *Secondary) primarySOA(z *zone, primary string) (*dns.SOA, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(z.name, dns.TypeSOA)
+	secrets, err := s.sign(z, primary, m)
+	if err != nil {
+		return nil, err
+	}
+	client := &dns.Client{
+		Net:        "udp",
+		Timeout:    time.Duration(s.config.Timeout) * time.Millisecond,
+		TsigSecret: secrets,
+	}
+	resp, _, err := client.Exchange(m, primary)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, errors.New("soa query failed : " + dns.RcodeToString[resp.Rcode])
+	}
+	for _, rr := range resp.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa, nil
+		}
+	}
+	return nil, errors.New("no soa in answer")
+}
+
+func (s *Secondary) transferIn(z *zone, primary string) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	if z.loaded {
+		soa := s.zoneConfig(z).SOA
+		m.SetIxfr(z.name, z.serial, soa.Ns, soa.MBox)
+	} else {
+		m.SetAxfr(z.name)
+	}
+	secrets, err := s.sign(z, primary, m)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(s.config.Timeout) * time.Millisecond
+	tr := &dns.Transfer{DialTimeout: timeout, ReadTimeout: timeout, WriteTimeout: timeout, TsigSecret: secrets}
+	ch, err := tr.In(m, primary)
+	if err != nil {
+		return nil, err
+	}
+	var records []dns.RR
+	for envelope := range ch {
+		if envelope.Error != nil {
+			return nil, envelope.Error
+		}
+		records = append(records, envelope.RR...)
+	}
+	if len(records) == 0 {
+		return nil, invalidAnswer
+	}
+	if _, ok := records[0].(*dns.SOA); !ok {
+		return nil, invalidAnswer
+	}
+	return records, nil
+}
+
+// sign adds tsig to m if primary has a key configured and returns secrets needed to sign m and verify responses
+func (s *Secondary) sign(z *zone, primary string, m *dns.Msg) (map[string]string, error) {
+	name, ok := z.keys[primary]
+	if !ok {
+		return nil, nil
+	}
+	key, ok := s.keyring().Key(name)
+	if !ok {
+		return nil, unknownKey
+	}
+	m.SetTsig(key.Name, key.Algorithm, 300, time.Now().Unix())
+	return map[string]string{key.Name: key.Secret}, nil
+}
+
+func (s *Secondary) apply(z *zone, records []dns.RR) error {
+	soa := records[0].(*dns.SOA)
+	if len(records) == 1 {
+		z.setTimers(soa)
+		return nil
+	}
+	if err := s.setConfig(z, nil); err != nil {
+		return err
+	}
+	var err error
+	if _, ok := records[1].(*dns.SOA); ok && z.loaded && len(records) > 2 {
+		err = s.applyIncremental(z, records[1:len(records)-1])
+	} else {
+		err = s.applyFull(z, records[1:len(records)-1])
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.setConfig(z, soa); err != nil {
+		return err
+	}
+	if !z.loaded {
+		if err := s.redisData.EnableZone(z.name); err != nil {
+			return err
+		}
+		z.loaded = true
+	}
+	z.setTimers(soa)
+	return nil
+}
+
+// setConfig marks zone as secondary and updates its soa, other settings are kept
+func (s *Secondary) setConfig(z *zone, soa *dns.SOA) error {
+	config := s.zoneConfig(z)
+	config.Primaries = z.primaries
+	if soa != nil {
+		config.SOA.Ns = soa.Ns
+		config.SOA.MBox = soa.Mbox
+		config.SOA.Ttl = soa.Hdr.Ttl
+		config.SOA.Refresh = soa.Refresh
+		config.SOA.Retry = soa.Retry
+		config.SOA.Expire = soa.Expire
+		config.SOA.MinTtl = soa.Minttl
+		config.SOA.Serial = soa.Serial
+	}
+	return s.redisData.SetZoneConfig(z.name, config)
+}
+
+// applyFull replaces zone data with records in a single transaction, rrsets of locations missing from records are deleted
+func (s *Secondary) applyFull(z *zone, records []dns.RR) error {
+	sets := make(map[string]map[uint16][]dns.RR)
+	for _, rr := range records {
+		label, ok := s.label(z, rr)
+		if !ok {
+			continue
+		}
+		if _, ok := sets[label]; !ok {
+			sets[label] = make(map[uint16][]dns.RR)
+		}
+		sets[label][rr.Header().Rrtype] = append(sets[label][rr.Header().Rrtype], rr)
+	}
+	var changes []storage.RRSetChange
+	for _, label := range append(s.redisData.GetZoneLocations(z.name), "@") {
+		if _, ok := sets[label]; ok {
+			continue
+		}
+		sets[label] = nil
+	}
+	for label, rrsets := range sets {
+		for _, rtype := range types.TransferTypes {
+			change, err := rrsetChange(label, rtype, rrsets[rtype])
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+		}
+	}
+	return s.redisData.UpdateRRSets(z.name, changes)
+}
+
+// applyIncremental applies ixfr differences in a single transaction
+func (s *Secondary) applyIncremental(z *zone, records []dns.RR) error {
+	type rrsetKey struct {
+		label string
+		rtype uint16
+	}
+	sets := make(map[rrsetKey][]dns.RR)
+	load := func(key rrsetKey) ([]dns.RR, error) {
+		if rrs, ok := sets[key]; ok {
+			return rrs, nil
+		}
+		rrset, err := s.redisData.RRSet(z.name, key.label, key.rtype)
+		if err != nil {
+			return nil, err
+		}
+		name := z.name
+		if key.label != "@" {
+			name = key.label + "." + z.name
+		}
+		return types.RRSetRecords(name, key.rtype, rrset), nil
+	}
+
+	// records are sequences of: old soa, deleted records, new soa, added records
+	deleting := false
+	for _, rr := range records {
+		if _, ok := rr.(*dns.SOA); ok {
+			deleting = !deleting
+			continue
+		}
+		label, ok := s.label(z, rr)
+		if !ok {
+			continue
+		}
+		key := rrsetKey{label: label, rtype: rr.Header().Rrtype}
+		rrs, err := load(key)
+		if err != nil {
+			return err
+		}
+		var res []dns.RR
+		for _, x := range rrs {
+			if !dns.IsDuplicate(x, rr) {
+				res = append(res, x)
+			}
+		}
+		if !deleting {
+			res = append(res, rr)
+		}
+		sets[key] = res
+	}
+	changes := make([]storage.RRSetChange, 0, len(sets))
+	for key, rrs := range sets {
+		change, err := rrsetChange(key.label, key.rtype, rrs)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change)
+	}
+	return s.redisData.UpdateRRSets(z.name, changes)
+}
+
+// rrsetChange returns change setting rrset of label to rrs, empty rrs deletes the rrset
+func rrsetChange(label string, rtype uint16, rrs []dns.RR) (storage.RRSetChange, error) {
+	change := storage.RRSetChange{Location: label, Type: rtype}
+	if len(rrs) == 0 {
+		return change, nil
+	}
+	value, err := jsoniter.Marshal(types.RRSetFromRecords(rtype, rrs))
+	if err != nil {
+		return change, err
+	}
+	change.New = string(value)
+	return change, nil
+}
+
+// label returns the location of rr in zone, records not supported by z42 are skipped
+func (s *Secondary) label(z *zone, rr dns.RR) (string, bool) {
+	if types.NewRRSet(rr.Header().Rrtype) == nil || rr.Header().Rrtype == types.TypeANAME {
+		zap.L().Debug("unsupported record skipped", zap.String("zone", z.name), zap.String("record", rr.String()))
+		return "", false
+	}
+	name := strings.ToLower(rr.Header().Name)
+	if name == z.name {
+		return "@", true
+	}
+	if !strings.HasSuffix(name, "."+z.name) {
+		return "", false
+	}
+	return strings.TrimSuffix(name, "."+z.name), true
+}
+
+// serial number arithmetic, rfc 1982
+func serialLess(a uint32, b uint32) bool {
+	return int32(a-b) < 0
+}
@@ -0,0 +1,250 @@
+package secondary
+
+import (
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/internal/tsig"
+	"github.com/hawell/z42/pkg/hiredis"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+var secondaryRedisDataConfig = storage.DataHandlerConfig{
+	ZoneCacheSize:      10000,
+	ZoneCacheTimeout:   60,
+	ZoneReload:         60,
+	RecordCacheSize:    10000,
+	RecordCacheTimeout: 60,
+	MinTTL:             5,
+	MaxTTL:             300,
+	Redis: hiredis.Config{
+		Address:  "redis:6379",
+		Net:      "tcp",
+		DB:       0,
+		Password: "",
+		Prefix:   "secondary_",
+		Suffix:   "_secondary",
+		Connection: hiredis.ConnectionConfig{
+			MaxIdleConnections:   10,
+			MaxActiveConnections: 10,
+			ConnectTimeout:       500,
+			ReadTimeout:          500,
+			IdleKeepAlive:        30,
+			MaxKeepAlive:         0,
+			WaitForConnection:    true,
+		},
+	},
+}
+
+type primary struct {
+	sync.Mutex
+	soa     *dns.SOA
+	records []dns.RR
+	ixfr    []dns.RR
+	secrets map[string]string
+	signed  int
+}
+
+func rr(s string) dns.RR {
+	r, _ := dns.NewRR(s)
+	return r
+}
+
+func (p *primary) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	p.Lock()
+	defer p.Unlock()
+	t := r.IsTsig()
+	if p.secrets != nil {
+		if t == nil || w.TsigStatus() != nil {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeRefused)
+			_ = w.WriteMsg(m)
+			return
+		}
+		p.signed++
+	}
+	switch r.Question[0].Qtype {
+	case dns.TypeSOA:
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{p.soa}
+		if t != nil {
+			m.SetTsig(t.Hdr.Name, t.Algorithm, t.Fudge, time.Now().Unix())
+		}
+		_ = w.WriteMsg(m)
+	case dns.TypeAXFR, dns.TypeIXFR:
+		records := append([]dns.RR{p.soa}, p.records...)
+		if r.Question[0].Qtype == dns.TypeIXFR && p.ixfr != nil {
+			records = p.ixfr
+		}
+		records = append(records, p.soa)
+		ch := make(chan *dns.Envelope, 1)
+		ch <- &dns.Envelope{RR: records}
+		close(ch)
+		tr := new(dns.Transfer)
+		_ = tr.Out(w, r, ch)
+	}
+}
+
+func startPrimary(g *GomegaWithT, p *primary) (string, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	g.Expect(err).To(BeNil())
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	g.Expect(err).To(BeNil())
+	udpServer := &dns.Server{PacketConn: pc, Handler: p, TsigSecret: p.secrets}
+	tcpServer := &dns.Server{Listener: l, Handler: p, TsigSecret: p.secrets}
+	go func() { _ = udpServer.ActivateAndServe() }()
+	go func() { _ = tcpServer.ActivateAndServe() }()
+	return pc.LocalAddr().String(), func() {
+		_ = udpServer.Shutdown()
+		_ = tcpServer.Shutdown()
+	}
+}
+
+func TestSecondary(t *testing.T) {
+	g := NewGomegaWithT(t)
+	p := &primary{
+		soa: rr("secondary.com. 300 IN SOA ns1.secondary.com. hostmaster.secondary.com. 1 3600 600 86400 300").(*dns.SOA),
+		records: []dns.RR{
+			rr("secondary.com. 300 IN NS ns1.secondary.com."),
+			rr("www.secondary.com. 300 IN A 1.2.3.4"),
+			rr("www.secondary.com. 300 IN A 5.6.7.8"),
+			rr("secondary.com. 300 IN MX 10 mail.secondary.com."),
+			rr("txt.secondary.com. 300 IN TXT \"foo\""),
+			rr("secondary.com. 300 IN HINFO \"cpu\" \"os\""),
+		},
+	}
+	address, stop := startPrimary(g, p)
+	defer stop()
+
+	dh := storage.NewDataHandler(&secondaryRedisDataConfig)
+	defer dh.ShutDown()
+	g.Expect(dh.Clear()).To(BeNil())
+
+	s := NewSecondary(&Config{
+		Enable:  true,
+		Timeout: 500,
+		Zones:   []ZoneConfig{{Zone: "secondary.com.", Primaries: []PrimaryConfig{{Address: address}}}},
+	}, dh, nil)
+	defer s.ShutDown()
+	time.Sleep(500 * time.Millisecond)
+
+	g.Expect(dh.GetZones()).To(ContainElement("secondary.com."))
+	a, err := dh.A("secondary.com.", "www")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(a.Data)).To(Equal(2))
+	g.Expect(a.Data[0].Ip.String()).To(Equal("1.2.3.4"))
+	g.Expect(a.Data[1].Ip.String()).To(Equal("5.6.7.8"))
+	mx, err := dh.MX("secondary.com.", "@")
+	g.Expect(err).To(BeNil())
+	g.Expect(mx.Data[0].Host).To(Equal("mail.secondary.com."))
+	txt, err := dh.TXT("secondary.com.", "txt")
+	g.Expect(err).To(BeNil())
+	g.Expect(txt.Data[0].Text).To(Equal("foo"))
+	fresh := storage.NewDataHandler(&secondaryRedisDataConfig)
+	g.Expect(fresh.GetZoneLocations("secondary.com.")).To(ConsistOf("@", "www", "txt"))
+	fresh.ShutDown()
+
+	p.Lock()
+	newSoa := dns.Copy(p.soa).(*dns.SOA)
+	newSoa.Serial = 2
+	p.ixfr = []dns.RR{
+		newSoa,
+		p.soa,
+		rr("www.secondary.com. 300 IN A 5.6.7.8"),
+		rr("txt.secondary.com. 300 IN TXT \"foo\""),
+		newSoa,
+		rr("www.secondary.com. 300 IN A 9.9.9.9"),
+	}
+	p.soa = newSoa
+	p.Unlock()
+
+	g.Expect(s.Notify("secondary.com.", "10.0.0.1")).To(BeFalse())
+	g.Expect(s.Notify("example.com.", "127.0.0.1")).To(BeFalse())
+	g.Expect(s.Notify("secondary.com.", "127.0.0.1")).To(BeTrue())
+	time.Sleep(500 * time.Millisecond)
+
+	a, err = dh.A("secondary.com.", "www")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(a.Data)).To(Equal(2))
+	g.Expect(a.Data[0].Ip.String()).To(Equal("1.2.3.4"))
+	g.Expect(a.Data[1].Ip.String()).To(Equal("9.9.9.9"))
+	fresh = storage.NewDataHandler(&secondaryRedisDataConfig)
+	defer fresh.ShutDown()
+	config, err := fresh.GetZoneConfig("secondary.com.")
+	g.Expect(err).To(BeNil())
+	g.Expect(config.SOA.Serial).To(Equal(uint32(2)))
+	g.Expect(config.Primaries).To(Equal([]string{address}))
+	g.Expect(fresh.GetZoneLocations("secondary.com.")).To(ConsistOf("@", "www"))
+}
+
+func TestSecondaryTsig(t *testing.T) {
+	g := NewGomegaWithT(t)
+	p := &primary{
+		soa: rr("secondary.com. 300 IN SOA ns1.secondary.com. hostmaster.secondary.com. 1 3600 600 86400 300").(*dns.SOA),
+		records: []dns.RR{
+			rr("www.secondary.com. 300 IN A 1.2.3.4"),
+		},
+		secrets: map[string]string{"transfer.": "c2VjcmV0"},
+	}
+	address, stop := startPrimary(g, p)
+	defer stop()
+
+	dh := storage.NewDataHandler(&secondaryRedisDataConfig)
+	defer dh.ShutDown()
+	g.Expect(dh.Clear()).To(BeNil())
+
+	keyring := tsig.NewKeyring(&tsig.Config{
+		Keys: []tsig.KeyConfig{
+			{Name: "transfer.", Algorithm: "hmac-sha256", Secret: "c2VjcmV0", Zones: []string{"*"}, Operations: []string{tsig.OperationTransfer}},
+		},
+	}, nil)
+	var config Config
+	g.Expect(jsoniter.Unmarshal([]byte(`{"enable":true,"timeout":500,"zones":[{"zone":"secondary.com.","primaries":["10.0.0.1",{"address":"`+address+`","tsig_key":"Transfer"}]}]}`), &config)).To(BeNil())
+	g.Expect(config.Zones[0].Primaries).To(Equal([]PrimaryConfig{{Address: "10.0.0.1"}, {Address: address, TsigKey: "Transfer"}}))
+	config.Zones[0].Primaries = config.Zones[0].Primaries[1:]
+
+	s := NewSecondary(&config, dh, func() *tsig.Keyring { return keyring })
+	defer s.ShutDown()
+	time.Sleep(500 * time.Millisecond)
+
+	a, err := dh.A("secondary.com.", "www")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(a.Data)).To(Equal(1))
+	g.Expect(a.Data[0].Ip.String()).To(Equal("1.2.3.4"))
+	p.Lock()
+	g.Expect(p.signed).To(Equal(2))
+	p.Unlock()
+}
+
+func TestSecondaryUnknownKey(t *testing.T) {
+	g := NewGomegaWithT(t)
+	p := &primary{
+		soa:     rr("secondary.com. 300 IN SOA ns1.secondary.com. hostmaster.secondary.com. 1 3600 600 86400 300").(*dns.SOA),
+		secrets: map[string]string{"transfer.": "c2VjcmV0"},
+	}
+	address, stop := startPrimary(g, p)
+	defer stop()
+
+	dh := storage.NewDataHandler(&secondaryRedisDataConfig)
+	defer dh.ShutDown()
+	g.Expect(dh.Clear()).To(BeNil())
+
+	keyring := tsig.NewKeyring(&tsig.Config{}, nil)
+	s := NewSecondary(&Config{
+		Enable:  true,
+		Timeout: 500,
+		Zones:   []ZoneConfig{{Zone: "secondary.com.", Primaries: []PrimaryConfig{{Address: address, TsigKey: "transfer."}}}},
+	}, dh, func() *tsig.Keyring { return keyring })
+	defer s.ShutDown()
+	time.Sleep(500 * time.Millisecond)
+
+	g.Expect(dh.GetZones()).NotTo(ContainElement("secondary.com."))
+	p.Lock()
+	g.Expect(p.signed).To(Equal(0))
+	p.Unlock()
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const (
+	dohMimeType     = "application/dns-message"
+	dohDefaultPath  = "/dns-query"
+	dohMaxMsgSize   = dns.MaxMsgSize
+	dohReadTimeout  = 5 * time.Second
+	dohWriteTimeout = 5 * time.Second
+)
+
+// DohServer serves dns queries over https (RFC 8484) using handler
+type DohServer struct {
+	server  *http.Server
+	path    string
+	tls     bool
+	handler dns.Handler
+	secrets *Secrets
+
+	proxyProtocol ProxyProtocolConfig
+}
+
+func newDohServer(cfg ServerConfig, secrets *Secrets) *DohServer {
+	s := &DohServer{
+		path:          cfg.Path,
+		handler:       dns.DefaultServeMux,
+		secrets:       secrets,
+		proxyProtocol: cfg.ProxyProtocol,
+	}
+	if s.path == "" {
+		s.path = dohDefaultPath
+	}
+	mux := http.NewServeMux()
+	mux.Handle(s.path, s)
+	s.server = &http.Server{
+		Addr:         net.JoinHostPort(cfg.Ip, strconv.Itoa(cfg.Port)),
+		Handler:      mux,
+		ReadTimeout:  dohReadTimeout,
+		WriteTimeout: dohWriteTimeout,
+	}
+	if cfg.Tls.Enable {
+		s.server.TLSConfig = loadTlsConfig(cfg.Tls)
+		s.tls = true
+	}
+	return s
+}
+
+// ListenAndServe serves https if tls is enabled, otherwise plain http for use behind a tls terminating proxy, http/2 is negotiated over tls
+func (s *DohServer) ListenAndServe() error {
+	if s.tls && s.server.TLSConfig == nil {
+		return errors.New("cannot load tls config")
+	}
+	l, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	if s.proxyProtocol.Enable {
+		l = newProxyListener(l, &s.proxyProtocol)
+	}
+	if s.tls {
+		err = s.server.ServeTLS(l, "", "")
+	} else {
+		err = s.server.Serve(l)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func (s *DohServer) Shutdown() error {
+	return s.server.Shutdown(context.Background())
+}
+
+func (s *DohServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf []byte
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		param := r.URL.Query().Get("dns")
+		if param == "" {
+			http.Error(w, "missing dns parameter", http.StatusBadRequest)
+			return
+		}
+		buf, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(param, "="))
+	case http.MethodPost:
+		if contentType := r.Header.Get("Content-Type"); contentType != dohMimeType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		buf, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, dohMaxMsgSize))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, "invalid dns message", http.StatusBadRequest)
+		return
+	}
+
+	req := new(dns.Msg)
+	if err := req.Unpack(buf); err != nil || req.Response || len(req.Question) != 1 {
+		http.Error(w, "invalid dns message", http.StatusBadRequest)
+		return
+	}
+
+	writer := &dohResponseWriter{
+		tsigState:  tsigState{secrets: s.secrets},
+		w:          w,
+		localAddr:  tcpAddr(r.Context().Value(http.LocalAddrContextKey)),
+		remoteAddr: tcpAddr(r.RemoteAddr),
+	}
+	writer.verify(buf, req)
+
+	// zone transfers need multiple messages which is not possible over doh
+	if qtype := req.Question[0].Qtype; qtype == dns.TypeAXFR || qtype == dns.TypeIXFR {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeRefused)
+		_ = writer.WriteMsg(m)
+		return
+	}
+
+	s.handler.ServeDNS(writer, req)
+	if !writer.written {
+		http.Error(w, "no response", http.StatusInternalServerError)
+	}
+}
+
+// tcpAddr converts addr to a tcp address so stream based listeners are treated like tcp by handler
+func tcpAddr(addr interface{}) *net.TCPAddr {
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		return v
+	case net.Addr:
+		addr = v.String()
+	}
+	str, _ := addr.(string)
+	host, port, err := net.SplitHostPort(str)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	portNum, _ := strconv.Atoi(port)
+	return &net.TCPAddr{IP: net.ParseIP(host), Port: portNum}
+}
+
+type dohResponseWriter struct {
+	tsigState
+	w          http.ResponseWriter
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	written    bool
+}
+
+func (d *dohResponseWriter) LocalAddr() net.Addr {
+	return d.localAddr
+}
+
+func (d *dohResponseWriter) RemoteAddr() net.Addr {
+	return d.remoteAddr
+}
+
+func (d *dohResponseWriter) WriteMsg(m *dns.Msg) error {
+	buf, err := d.pack(m)
+	if err != nil {
+		zap.L().Error("cannot pack doh response", zap.Error(err))
+		return err
+	}
+	d.w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(dohMaxAge(m)), 10))
+	_, err = d.Write(buf)
+	return err
+}
+
+func (d *dohResponseWriter) Write(buf []byte) (int, error) {
+	if d.written {
+		return 0, errors.New("response already written")
+	}
+	d.written = true
+	d.w.Header().Set("Content-Type", dohMimeType)
+	d.w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	return d.w.Write(buf)
+}
+
+func (d *dohResponseWriter) Close() error {
+	return nil
+}
+
+func (d *dohResponseWriter) Hijack() {}
+
+// dohMaxAge returns the smallest ttl of response records for http caching
+func dohMaxAge(m *dns.Msg) uint32 {
+	var ttl uint32
+	first := true
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT || rr.Header().Rrtype == dns.TypeTSIG {
+				continue
+			}
+			if first || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				first = false
+			}
+		}
+	}
+	return ttl
+}
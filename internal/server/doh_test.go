@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+func TestDoh(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s := newDohServer(ServerConfig{Ip: "127.0.0.1", Port: 8443, Protocol: "https"}, nil)
+	g.Expect(s.path).To(Equal("/dns-query"))
+	s.handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		ip := w.RemoteAddr().(*net.TCPAddr).IP.String()
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+			Txt: []string{ip},
+		})
+		m.Ns = append(m.Ns, &dns.NS{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 100},
+			Ns:  "ns1.example.com.",
+		})
+		_ = w.WriteMsg(m)
+	})
+	ts := httptest.NewUnstartedServer(s.server.Handler)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+	client := ts.Client()
+
+	query := func(qtype uint16) []byte {
+		m := new(dns.Msg)
+		m.SetQuestion("www.example.com.", qtype)
+		m.Id = 0
+		buf, err := m.Pack()
+		g.Expect(err).To(BeNil())
+		return buf
+	}
+	check := func(resp *http.Response, rcode int) *dns.Msg {
+		g.Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		g.Expect(resp.ProtoMajor).To(Equal(2))
+		g.Expect(resp.Header.Get("Content-Type")).To(Equal("application/dns-message"))
+		body, err := ioutil.ReadAll(resp.Body)
+		g.Expect(err).To(BeNil())
+		_ = resp.Body.Close()
+		m := new(dns.Msg)
+		g.Expect(m.Unpack(body)).To(BeNil())
+		g.Expect(m.Rcode).To(Equal(rcode))
+		return m
+	}
+
+	// get
+	resp, err := client.Get(ts.URL + "/dns-query?dns=" + base64.RawURLEncoding.EncodeToString(query(dns.TypeTXT)))
+	g.Expect(err).To(BeNil())
+	g.Expect(resp.Header.Get("Cache-Control")).To(Equal("max-age=100"))
+	m := check(resp, dns.RcodeSuccess)
+	g.Expect(m.Answer[0].(*dns.TXT).Txt).To(Equal([]string{"127.0.0.1"}))
+
+	// post
+	resp, err = client.Post(ts.URL+"/dns-query", "application/dns-message", bytes.NewReader(query(dns.TypeTXT)))
+	g.Expect(err).To(BeNil())
+	m = check(resp, dns.RcodeSuccess)
+	g.Expect(len(m.Answer)).To(Equal(1))
+
+	// zone transfers are refused
+	resp, err = client.Post(ts.URL+"/dns-query", "application/dns-message", bytes.NewReader(query(dns.TypeAXFR)))
+	g.Expect(err).To(BeNil())
+	check(resp, dns.RcodeRefused)
+
+	// invalid requests
+	resp, err = client.Post(ts.URL+"/dns-query", "text/plain", bytes.NewReader(query(dns.TypeTXT)))
+	g.Expect(err).To(BeNil())
+	g.Expect(resp.StatusCode).To(Equal(http.StatusUnsupportedMediaType))
+	resp, err = client.Get(ts.URL + "/dns-query")
+	g.Expect(err).To(BeNil())
+	g.Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	resp, err = client.Get(ts.URL + "/dns-query?dns=AAAA")
+	g.Expect(err).To(BeNil())
+	g.Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/dns-query", nil)
+	resp, err = client.Do(req)
+	g.Expect(err).To(BeNil())
+	g.Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	resp, err = client.Get(ts.URL + "/other")
+	g.Expect(err).To(BeNil())
+	g.Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"go.uber.org/zap"
+)
+
+// doq error codes (RFC 9250 section 8.4)
+const (
+	doqNoError       quic.ApplicationErrorCode = 0x0
+	doqInternalError quic.ApplicationErrorCode = 0x1
+	doqProtocolError quic.ApplicationErrorCode = 0x2
+)
+
+const (
+	doqAlpn               = "doq"
+	doqDefaultIdleTimeout = 30
+	doqStreamTimeout      = 5 * time.Second
+)
+
+// DoqServer serves dns queries over quic (RFC 9250), each query is sent on its own bidirectional stream
+type DoqServer struct {
+	addr       string
+	tlsConfig  *tls.Config
+	quicConfig *quic.Config
+	handler    dns.Handler
+	secrets    *Secrets
+	ctx        context.Context
+	cancel     context.CancelFunc
+	lock       sync.Mutex
+	listener   *quic.Listener
+}
+
+func newDoqServer(cfg ServerConfig, secrets *Secrets) *DoqServer {
+	idleTimeout := cfg.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = doqDefaultIdleTimeout
+	}
+	s := &DoqServer{
+		addr:    net.JoinHostPort(cfg.Ip, strconv.Itoa(cfg.Port)),
+		handler: dns.DefaultServeMux,
+		secrets: secrets,
+		quicConfig: &quic.Config{
+			MaxIdleTimeout:        time.Duration(idleTimeout) * time.Second,
+			MaxIncomingUniStreams: -1,
+		},
+	}
+	if cfg.Tls.Enable {
+		s.tlsConfig = loadTlsConfig(cfg.Tls)
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *DoqServer) ListenAndServe() error {
+	if s.tlsConfig == nil {
+		return errors.New("doq requires tls")
+	}
+	tlsConfig := s.tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{doqAlpn}
+	listener, err := quic.ListenAddr(s.addr, tlsConfig, s.quicConfig)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	if s.ctx.Err() != nil {
+		s.lock.Unlock()
+		return listener.Close()
+	}
+	s.listener = listener
+	s.lock.Unlock()
+
+	for {
+		conn, err := listener.Accept(s.ctx)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *DoqServer) Shutdown() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cancel()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *DoqServer) serveConn(conn *quic.Conn) {
+	for {
+		stream, err := conn.AcceptStream(s.ctx)
+		if err != nil {
+			// idle timeout, closed by client or shutting down
+			_ = conn.CloseWithError(doqNoError, "")
+			return
+		}
+		go s.serveStream(conn, stream)
+	}
+}
+
+func (s *DoqServer) serveStream(conn *quic.Conn, stream *quic.Stream) {
+	_ = stream.SetReadDeadline(time.Now().Add(doqStreamTimeout))
+	var length uint16
+	if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+		stream.CancelRead(quic.StreamErrorCode(doqProtocolError))
+		stream.CancelWrite(quic.StreamErrorCode(doqProtocolError))
+		return
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		stream.CancelRead(quic.StreamErrorCode(doqProtocolError))
+		stream.CancelWrite(quic.StreamErrorCode(doqProtocolError))
+		return
+	}
+
+	// message id must be zero, invalid messages are protocol errors and close the connection
+	req := new(dns.Msg)
+	if err := req.Unpack(buf); err != nil || req.Id != 0 || req.Response {
+		zap.L().Debug("invalid doq request", zap.String("source", conn.RemoteAddr().String()))
+		_ = conn.CloseWithError(doqProtocolError, "invalid dns message")
+		return
+	}
+
+	writer := &doqResponseWriter{
+		tsigState:  tsigState{secrets: s.secrets},
+		stream:     stream,
+		localAddr:  tcpAddr(conn.LocalAddr()),
+		remoteAddr: tcpAddr(conn.RemoteAddr()),
+	}
+	writer.verify(buf, req)
+	s.handler.ServeDNS(writer, req)
+	if !writer.written {
+		stream.CancelWrite(quic.StreamErrorCode(doqInternalError))
+		return
+	}
+	_ = stream.Close()
+}
+
+type doqResponseWriter struct {
+	tsigState
+	stream     *quic.Stream
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	written    bool
+}
+
+func (d *doqResponseWriter) LocalAddr() net.Addr {
+	return d.localAddr
+}
+
+func (d *doqResponseWriter) RemoteAddr() net.Addr {
+	return d.remoteAddr
+}
+
+// WriteMsg may be called several times for zone transfers, each message is written to the same stream
+func (d *doqResponseWriter) WriteMsg(m *dns.Msg) error {
+	buf, err := d.pack(m)
+	if err != nil {
+		zap.L().Error("cannot pack doq response", zap.Error(err))
+		return err
+	}
+	_, err = d.Write(buf)
+	return err
+}
+
+func (d *doqResponseWriter) Write(buf []byte) (int, error) {
+	if len(buf) > dns.MaxMsgSize {
+		return 0, dns.ErrBuf
+	}
+	d.written = true
+	msg := make([]byte, 2+len(buf))
+	binary.BigEndian.PutUint16(msg, uint16(len(buf)))
+	copy(msg[2:], buf)
+	_ = d.stream.SetWriteDeadline(time.Now().Add(doqStreamTimeout))
+	if _, err := d.stream.Write(msg); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+func (d *doqResponseWriter) Close() error {
+	return d.stream.Close()
+}
+
+func (d *doqResponseWriter) Hijack() {}
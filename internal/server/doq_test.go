@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"github.com/quic-go/quic-go"
+)
+
+func testTlsConfig(g *WithT) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).To(BeNil())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	g.Expect(err).To(BeNil())
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func freeUdpPort(g *WithT) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	g.Expect(err).To(BeNil())
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	_ = conn.Close()
+	return port
+}
+
+func TestDoq(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	port := freeUdpPort(g)
+	s := newDoqServer(ServerConfig{Ip: "127.0.0.1", Port: port, Protocol: "quic", IdleTimeout: 1}, nil)
+	s.tlsConfig = testTlsConfig(g)
+	s.handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		g.Expect(w.RemoteAddr()).To(BeAssignableToTypeOf(&net.TCPAddr{}))
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+			Txt: []string{w.RemoteAddr().(*net.TCPAddr).IP.String()},
+		})
+		_ = w.WriteMsg(m)
+		// zone transfers write multiple messages to the same stream
+		if r.Question[0].Qtype == dns.TypeAXFR {
+			_ = w.WriteMsg(m)
+		}
+	})
+	go func() {
+		_ = s.ListenAndServe()
+	}()
+	defer func() {
+		_ = s.Shutdown()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	dial := func() *quic.Conn {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		conn, err := quic.DialAddr(ctx, s.addr, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"doq"}}, nil)
+		g.Expect(err).To(BeNil())
+		return conn
+	}
+	send := func(conn *quic.Conn, id uint16, qtype uint16) *quic.Stream {
+		m := new(dns.Msg)
+		m.SetQuestion("www.example.com.", qtype)
+		m.Id = id
+		buf, err := m.Pack()
+		g.Expect(err).To(BeNil())
+		stream, err := conn.OpenStreamSync(context.Background())
+		g.Expect(err).To(BeNil())
+		msg := make([]byte, 2+len(buf))
+		binary.BigEndian.PutUint16(msg, uint16(len(buf)))
+		copy(msg[2:], buf)
+		_, err = stream.Write(msg)
+		g.Expect(err).To(BeNil())
+		g.Expect(stream.Close()).To(BeNil())
+		return stream
+	}
+	receive := func(stream *quic.Stream) []*dns.Msg {
+		_ = stream.SetReadDeadline(time.Now().Add(time.Second))
+		var res []*dns.Msg
+		for {
+			var length uint16
+			if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+				g.Expect(err).To(Equal(io.EOF))
+				return res
+			}
+			buf := make([]byte, length)
+			_, err := io.ReadFull(stream, buf)
+			g.Expect(err).To(BeNil())
+			m := new(dns.Msg)
+			g.Expect(m.Unpack(buf)).To(BeNil())
+			res = append(res, m)
+		}
+	}
+
+	// one query per stream, multiple streams on a connection
+	conn := dial()
+	first := send(conn, 0, dns.TypeTXT)
+	second := send(conn, 0, dns.TypeTXT)
+	for _, stream := range []*quic.Stream{first, second} {
+		res := receive(stream)
+		g.Expect(len(res)).To(Equal(1))
+		g.Expect(res[0].Id).To(Equal(uint16(0)))
+		g.Expect(res[0].Answer[0].(*dns.TXT).Txt).To(Equal([]string{"127.0.0.1"}))
+	}
+	g.Expect(len(receive(send(conn, 0, dns.TypeAXFR)))).To(Equal(2))
+
+	// idle connections are dropped by server, queries on them are not answered
+	time.Sleep(1500 * time.Millisecond)
+	stream := send(conn, 0, dns.TypeTXT)
+	_ = stream.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	_, err := stream.Read(make([]byte, 2))
+	g.Expect(err).NotTo(BeNil())
+	g.Expect(err).NotTo(Equal(io.EOF))
+
+	// non-zero message id is a protocol error
+	conn = dial()
+	send(conn, 1234, dns.TypeTXT)
+	select {
+	case <-conn.Context().Done():
+		var appErr *quic.ApplicationError
+		g.Expect(context.Cause(conn.Context())).To(BeAssignableToTypeOf(appErr))
+		g.Expect(context.Cause(conn.Context()).(*quic.ApplicationError).ErrorCode).To(Equal(doqProtocolError))
+	case <-time.After(time.Second):
+		t.Fatal("connection not closed")
+	}
+}
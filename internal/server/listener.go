@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Listener runs all servers created for a single ServerConfig and keeps track of their state
+type Listener struct {
+	Config  ServerConfig
+	servers []Server
+	lock    sync.RWMutex
+	running int
+	err     error
+}
+
+type ListenerStatus struct {
+	Address  string `json:"address"`
+	Protocol string `json:"protocol"`
+	Servers  int    `json:"servers"`
+	Running  int    `json:"running"`
+	Error    string `json:"error,omitempty"`
+}
+
+func NewListeners(config []ServerConfig, tsigSecrets *Secrets) []*Listener {
+	listeners := make([]*Listener, 0, len(config))
+	for _, cfg := range config {
+		listeners = append(listeners, NewListener(cfg, tsigSecrets))
+	}
+	return listeners
+}
+
+func NewListener(config ServerConfig, tsigSecrets *Secrets) *Listener {
+	return &Listener{
+		Config:  config,
+		servers: NewServer([]ServerConfig{config}, tsigSecrets),
+	}
+}
+
+func (l *Listener) address() string {
+	return net.JoinHostPort(l.Config.Ip, strconv.Itoa(l.Config.Port))
+}
+
+// Start runs servers in background, errors are logged and reported in status
+func (l *Listener) Start() {
+	l.lock.Lock()
+	l.running, l.err = len(l.servers), nil
+	l.lock.Unlock()
+	for _, s := range l.servers {
+		go func(s Server) {
+			err := s.ListenAndServe()
+			if err != nil {
+				zap.L().Error("listener error", zap.String("address", l.address()), zap.String("protocol", l.Config.Protocol), zap.Error(err))
+			}
+			l.lock.Lock()
+			l.running--
+			if err != nil {
+				l.err = err
+			}
+			l.lock.Unlock()
+		}(s)
+	}
+}
+
+func (l *Listener) Shutdown() {
+	for _, s := range l.servers {
+		_ = s.Shutdown()
+	}
+}
+
+func (l *Listener) Status() ListenerStatus {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	status := ListenerStatus{
+		Address:  l.address(),
+		Protocol: l.Config.Protocol,
+		Servers:  len(l.servers),
+		Running:  l.running,
+	}
+	if l.err != nil {
+		status.Error = l.err.Error()
+	}
+	return status
+}
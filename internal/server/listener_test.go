@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestListenerStatus(t *testing.T) {
+	g := NewGomegaWithT(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).To(BeNil())
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	listeners := NewListeners([]ServerConfig{
+		{Ip: "127.0.0.1", Port: port, Protocol: "udp", Count: 2},
+		{Ip: "127.0.0.1", Port: port, Protocol: "tcp", Count: 1},
+	}, nil)
+	g.Expect(listeners).To(HaveLen(2))
+	for _, listener := range listeners {
+		listener.Start()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	udp := listeners[0].Status()
+	g.Expect(udp.Protocol).To(Equal("udp"))
+	g.Expect(udp.Servers).To(Equal(2))
+	g.Expect(udp.Running).To(Equal(2))
+	g.Expect(udp.Error).To(BeEmpty())
+
+	// tcp port is already in use
+	tcp := listeners[1].Status()
+	g.Expect(tcp.Running).To(Equal(0))
+	g.Expect(tcp.Error).NotTo(BeEmpty())
+
+	listeners[0].Shutdown()
+	time.Sleep(100 * time.Millisecond)
+	g.Expect(listeners[0].Status().Running).To(Equal(0))
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type ProxyProtocolConfig struct {
+	Enable         bool     `json:"enable"`
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+const (
+	proxyHeaderTimeout = 5 * time.Second
+	proxyV1MaxLength   = 107
+)
+
+var (
+	proxyV1Signature = []byte("PROXY ")
+	proxyV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+	ErrInvalidProxyHeader = errors.New("invalid proxy protocol header")
+)
+
+// proxyListener accepts connections with a PROXY protocol v1/v2 header from trusted proxies, connections from other sources are used as is
+type proxyListener struct {
+	net.Listener
+	trusted []*net.IPNet
+}
+
+func newProxyListener(l net.Listener, config *ProxyProtocolConfig) *proxyListener {
+	pl := &proxyListener{Listener: l}
+	for _, entry := range config.TrustedProxies {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			zap.L().Error("invalid trusted proxy", zap.String("proxy", entry), zap.Error(err))
+			continue
+		}
+		pl.trusted = append(pl.trusted, network)
+	}
+	return pl
+}
+
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range l.trusted {
+		if network.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn reads proxy header on first use, so slow proxies don't block accepting other connections
+type proxyConn struct {
+	net.Conn
+	reader       *bufio.Reader
+	once         sync.Once
+	remoteAddr   net.Addr
+	err          error
+	lock         sync.Mutex
+	readDeadline time.Time
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.lock.Lock()
+		deadline := c.readDeadline
+		c.lock.Unlock()
+		headerDeadline := time.Now().Add(proxyHeaderTimeout)
+		if !deadline.IsZero() && deadline.Before(headerDeadline) {
+			headerDeadline = deadline
+		}
+		_ = c.Conn.SetReadDeadline(headerDeadline)
+		c.remoteAddr, c.err = readProxyHeader(c.reader)
+		// restore deadline set by user of connection
+		_ = c.Conn.SetReadDeadline(deadline)
+		if c.err != nil {
+			zap.L().Error("proxy protocol error", zap.String("proxy", c.Conn.RemoteAddr().String()), zap.Error(c.err))
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.readDeadline = t
+	c.lock.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.readDeadline = t
+	c.lock.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remoteAddr == nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remoteAddr
+}
+
+// readProxyHeader returns source address of a v1 or v2 header, nil address means connection is not proxied (no header, LOCAL or UNKNOWN)
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	if sig, err := r.Peek(len(proxyV1Signature)); err == nil && bytes.Equal(sig, proxyV1Signature) {
+		return readProxyV1Header(r)
+	}
+	if sig, err := r.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(sig, proxyV2Signature) {
+		return readProxyV2Header(r)
+	}
+	return nil, nil
+}
+
+// PROXY TCP4|TCP6|UNKNOWN <src> <dst> <src port> <dst port>\r\n
+func readProxyV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLength {
+			return nil, ErrInvalidProxyHeader
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidProxyHeader
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidProxyHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, ErrInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, ErrInvalidProxyHeader
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	switch header[12] & 0x0F {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, ErrInvalidProxyHeader
+	}
+	switch header[13] {
+	case 0x11, 0x12: // TCP/UDP over IPv4
+		if len(body) < 12 {
+			return nil, ErrInvalidProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x21, 0x22: // TCP/UDP over IPv6
+		if len(body) < 36 {
+			return nil, ErrInvalidProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	default: // UNSPEC and unix sockets
+		return nil, nil
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+func proxyV2Header(command byte, family byte, addr []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(addr)))
+	return append(header, addr...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	v4 := []byte{1, 2, 3, 4, 5, 6, 7, 8, 0x30, 0x39, 0, 53}
+	v6 := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0x30, 0x39, 0, 53)
+	testCases := []struct {
+		header []byte
+		addr   string
+		err    error
+	}{
+		{[]byte("PROXY TCP4 1.2.3.4 5.6.7.8 12345 53\r\n"), "1.2.3.4:12345", nil},
+		{[]byte("PROXY TCP6 2001:db8::1 2001:db8::2 12345 53\r\n"), "[2001:db8::1]:12345", nil},
+		{[]byte("PROXY UNKNOWN\r\n"), "", nil},
+		{[]byte("PROXY TCP4 2001:db8::1 5.6.7.8 12345 53\r\n"), "", ErrInvalidProxyHeader},
+		{[]byte("PROXY TCP4 1.2.3.4 5.6.7.8 12345\r\n"), "", ErrInvalidProxyHeader},
+		{proxyV2Header(0x1, 0x11, v4), "1.2.3.4:12345", nil},
+		{proxyV2Header(0x1, 0x21, v6), "[2001:db8::1]:12345", nil},
+		{proxyV2Header(0x0, 0x00, nil), "", nil},
+		{proxyV2Header(0x1, 0x11, v4[:6]), "", ErrInvalidProxyHeader},
+		{proxyV2Header(0x2, 0x11, v4), "", ErrInvalidProxyHeader},
+	}
+	for i, tc := range testCases {
+		r := bufio.NewReader(bytes.NewReader(append(tc.header, []byte("payload")...)))
+		addr, err := readProxyHeader(r)
+		if tc.err != nil {
+			g.Expect(err).To(Equal(tc.err), "test case %d", i)
+			continue
+		}
+		g.Expect(err).To(BeNil(), "test case %d", i)
+		if tc.addr == "" {
+			g.Expect(addr).To(BeNil(), "test case %d", i)
+		} else {
+			g.Expect(addr.String()).To(Equal(tc.addr), "test case %d", i)
+		}
+		rest := make([]byte, 7)
+		_, err = r.Read(rest)
+		g.Expect(err).To(BeNil())
+		g.Expect(string(rest)).To(Equal("payload"), "test case %d", i)
+	}
+
+	// connections without header are not modified
+	r := bufio.NewReader(bytes.NewReader([]byte{0, 29, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}))
+	addr, err := readProxyHeader(r)
+	g.Expect(err).To(BeNil())
+	g.Expect(addr).To(BeNil())
+	g.Expect(r.Buffered()).To(Equal(14))
+}
+
+func TestProxyServer(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	query := func(addr string, header []byte) *dns.Msg {
+		conn, err := net.Dial("tcp", addr)
+		g.Expect(err).To(BeNil())
+		defer conn.Close()
+		_, err = conn.Write(header)
+		g.Expect(err).To(BeNil())
+		c := &dns.Conn{Conn: conn}
+		m := new(dns.Msg)
+		m.SetQuestion("www.example.com.", dns.TypeTXT)
+		g.Expect(c.WriteMsg(m)).To(BeNil())
+		_ = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		res, err := c.ReadMsg()
+		if err != nil {
+			return nil
+		}
+		return res
+	}
+	start := func(trusted []string) (*proxyServer, string) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		g.Expect(err).To(BeNil())
+		port := l.Addr().(*net.TCPAddr).Port
+		_ = l.Close()
+		servers := NewServer([]ServerConfig{{
+			Ip:            "127.0.0.1",
+			Port:          port,
+			Protocol:      "tcp",
+			Count:         4,
+			ProxyProtocol: ProxyProtocolConfig{Enable: true, TrustedProxies: trusted},
+		}}, nil)
+		g.Expect(len(servers)).To(Equal(1))
+		s := servers[0].(*proxyServer)
+		s.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Answer = append(m.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+				Txt: []string{w.RemoteAddr().String()},
+			})
+			_ = w.WriteMsg(m)
+		})
+		go func() {
+			_ = s.ListenAndServe()
+		}()
+		time.Sleep(100 * time.Millisecond)
+		return s, "127.0.0.1:" + strconv.Itoa(port)
+	}
+
+	s, addr := start([]string{"10.0.0.0/8", "127.0.0.1"})
+	res := query(addr, []byte("PROXY TCP4 1.2.3.4 5.6.7.8 12345 53\r\n"))
+	g.Expect(res).NotTo(BeNil())
+	g.Expect(res.Answer[0].(*dns.TXT).Txt).To(Equal([]string{"1.2.3.4:12345"}))
+	res = query(addr, proxyV2Header(0x1, 0x11, []byte{5, 6, 7, 8, 1, 2, 3, 4, 0x30, 0x39, 0, 53}))
+	g.Expect(res).NotTo(BeNil())
+	g.Expect(res.Answer[0].(*dns.TXT).Txt).To(Equal([]string{"5.6.7.8:12345"}))
+	// trusted proxies may connect without header (health checks)
+	res = query(addr, nil)
+	g.Expect(res).NotTo(BeNil())
+	g.Expect(res.Answer[0].(*dns.TXT).Txt[0]).To(HavePrefix("127.0.0.1:"))
+	_ = s.Shutdown()
+
+	// headers from untrusted sources are not parsed
+	s, addr = start([]string{"10.0.0.0/8"})
+	g.Expect(query(addr, []byte("PROXY TCP4 1.2.3.4 5.6.7.8 12345 53\r\n"))).To(BeNil())
+	res = query(addr, nil)
+	g.Expect(res).NotTo(BeNil())
+	g.Expect(res.Answer[0].(*dns.TXT).Txt[0]).To(HavePrefix("127.0.0.1:"))
+	_ = s.Shutdown()
+}
@@ -1,7 +1,12 @@
 package server
 
 import (
+	"errors"
+	"net"
 	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
 
 	"crypto/tls"
 	"crypto/x509"
@@ -17,11 +22,20 @@ type TlsConfig struct {
 }
 
 type ServerConfig struct {
-	Ip       string    `json:"ip"`
-	Port     int       `json:"port"`
-	Protocol string    `json:"protocol"`
-	Count    int       `json:"count"`
-	Tls      TlsConfig `json:"tls"`
+	Ip            string              `json:"ip"`
+	Port          int                 `json:"port"`
+	Protocol      string              `json:"protocol"`
+	Count         int                 `json:"count"`
+	Tls           TlsConfig           `json:"tls"`
+	Path          string              `json:"path,omitempty"`
+	IdleTimeout   int                 `json:"idle_timeout,omitempty"`
+	ProxyProtocol ProxyProtocolConfig `json:"proxy_protocol"`
+}
+
+// Server is a dns listener, either a dns.Server, a DohServer or a DoqServer
+type Server interface {
+	ListenAndServe() error
+	Shutdown() error
 }
 
 func loadRoots(caPath string) *x509.CertPool {
@@ -53,23 +67,83 @@ func loadTlsConfig(cfg TlsConfig) *tls.Config {
 	return &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: root}
 }
 
-func NewServer(config []ServerConfig) []*dns.Server {
-	var servers []*dns.Server
+// acceptFunc accepts dynamic updates in addition to messages accepted by default
+func acceptFunc(dh dns.Header) dns.MsgAcceptAction {
+	opcode := int(dh.Bits>>11) & 0xF
+	if opcode != dns.OpcodeUpdate {
+		return dns.DefaultMsgAcceptFunc(dh)
+	}
+	if isResponse := dh.Bits&(1<<15) != 0; isResponse {
+		return dns.MsgIgnore
+	}
+	if dh.Qdcount != 1 {
+		return dns.MsgReject
+	}
+	return dns.MsgAccept
+}
+
+// NewServer creates servers for config, secrets may be updated while servers are running
+func NewServer(config []ServerConfig, secrets *Secrets) []Server {
+	var servers []Server
 	for _, cfg := range config {
+		if cfg.Protocol == "https" {
+			servers = append(servers, newDohServer(cfg, secrets))
+			continue
+		}
+		if cfg.Protocol == "quic" {
+			servers = append(servers, newDoqServer(cfg, secrets))
+			continue
+		}
 		if cfg.Count < 1 {
 			cfg.Count = 1
 		}
 		for i := 0; i < cfg.Count; i++ {
 			server := &dns.Server{
-				Addr:      cfg.Ip + ":" + strconv.Itoa(cfg.Port),
-				Net:       cfg.Protocol,
-				ReusePort: true,
+				Addr:          cfg.Ip + ":" + strconv.Itoa(cfg.Port),
+				Net:           cfg.Protocol,
+				ReusePort:     true,
+				MsgAcceptFunc: acceptFunc,
+			}
+			if secrets != nil {
+				server.TsigProvider = secrets
 			}
 			if cfg.Tls.Enable {
 				server.TLSConfig = loadTlsConfig(cfg.Tls)
 			}
+			if cfg.ProxyProtocol.Enable {
+				if strings.HasPrefix(cfg.Protocol, "udp") {
+					zap.L().Error("proxy protocol is not supported on udp listeners", zap.String("address", server.Addr))
+				} else {
+					// a single listener accepts all proxied connections
+					servers = append(servers, &proxyServer{Server: server, config: &cfg.ProxyProtocol})
+					break
+				}
+			}
 			servers = append(servers, server)
 		}
 	}
 	return servers
 }
+
+// proxyServer is a tcp dns.Server accepting connections through a proxyListener
+type proxyServer struct {
+	*dns.Server
+	config *ProxyProtocolConfig
+}
+
+func (s *proxyServer) ListenAndServe() error {
+	l, err := net.Listen(strings.TrimSuffix(s.Net, "-tls"), s.Addr)
+	if err != nil {
+		return err
+	}
+	var listener net.Listener = newProxyListener(l, s.config)
+	if strings.HasSuffix(s.Net, "-tls") {
+		if s.TLSConfig == nil {
+			_ = l.Close()
+			return errors.New("cannot load tls config")
+		}
+		listener = tls.NewListener(listener, s.TLSConfig)
+	}
+	s.Listener = listener
+	return s.ActivateAndServe()
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+// Secrets is a dns.TsigProvider shared by all listeners, keys can be replaced while servers are running
+type Secrets struct {
+	secrets atomic.Pointer[map[string]string]
+}
+
+func NewSecrets(secrets map[string]string) *Secrets {
+	s := new(Secrets)
+	s.Set(secrets)
+	return s
+}
+
+// Set replaces all keys, requests being served keep using keys they were verified with
+func (s *Secrets) Set(secrets map[string]string) {
+	m := make(map[string]string, len(secrets))
+	for name, secret := range secrets {
+		m[dns.Fqdn(strings.ToLower(name))] = secret
+	}
+	s.secrets.Store(&m)
+}
+
+func (s *Secrets) Get(name string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	secrets := s.secrets.Load()
+	if secrets == nil {
+		return "", false
+	}
+	secret, ok := (*secrets)[strings.ToLower(name)]
+	return secret, ok
+}
+
+func (s *Secrets) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	secret, ok := s.Get(t.Hdr.Name)
+	if !ok {
+		return nil, dns.ErrSecret
+	}
+	rawSecret, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, err
+	}
+	var h hash.Hash
+	switch dns.CanonicalName(t.Algorithm) {
+	case dns.HmacSHA1:
+		h = hmac.New(sha1.New, rawSecret)
+	case dns.HmacSHA224:
+		h = hmac.New(sha256.New224, rawSecret)
+	case dns.HmacSHA256:
+		h = hmac.New(sha256.New, rawSecret)
+	case dns.HmacSHA384:
+		h = hmac.New(sha512.New384, rawSecret)
+	case dns.HmacSHA512:
+		h = hmac.New(sha512.New, rawSecret)
+	default:
+		return nil, dns.ErrKeyAlg
+	}
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+func (s *Secrets) Verify(msg []byte, t *dns.TSIG) error {
+	b, err := s.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(b, mac) {
+		return dns.ErrSig
+	}
+	return nil
+}
+
+// tsigState verifies requests and signs responses of doh and doq listeners the same way dns.Server does
+type tsigState struct {
+	secrets    *Secrets
+	status     error
+	requestMAC string
+	timersOnly bool
+}
+
+func (t *tsigState) verify(buf []byte, req *dns.Msg) {
+	rr := req.IsTsig()
+	if rr == nil {
+		return
+	}
+	t.requestMAC = rr.MAC
+	if secret, ok := t.secrets.Get(rr.Hdr.Name); ok {
+		t.status = dns.TsigVerify(buf, secret, "", false)
+	} else {
+		t.status = dns.ErrSecret
+	}
+}
+
+// pack packs m, signing it if it carries a tsig record, consecutive messages are chained by their mac
+func (t *tsigState) pack(m *dns.Msg) ([]byte, error) {
+	rr := m.IsTsig()
+	if rr == nil {
+		return m.Pack()
+	}
+	secret, _ := t.secrets.Get(rr.Hdr.Name)
+	buf, mac, err := dns.TsigGenerate(m, secret, t.requestMAC, t.timersOnly)
+	if err != nil {
+		return nil, err
+	}
+	t.requestMAC = mac
+	return buf, nil
+}
+
+func (t *tsigState) TsigStatus() error {
+	return t.status
+}
+
+func (t *tsigState) TsigTimersOnly(timersOnly bool) {
+	t.timersOnly = timersOnly
+}
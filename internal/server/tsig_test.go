@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+func TestSecretsUpdate(t *testing.T) {
+	g := NewGomegaWithT(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	g.Expect(err).To(BeNil())
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	_ = pc.Close()
+
+	secrets := NewSecrets(map[string]string{"Key1": "c2VjcmV0MQ=="})
+	servers := NewServer([]ServerConfig{{Ip: "127.0.0.1", Port: port, Protocol: "udp"}}, secrets)
+	g.Expect(servers).To(HaveLen(1))
+	s := servers[0].(*dns.Server)
+	s.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if w.TsigStatus() != nil {
+			m.Rcode = dns.RcodeNotAuth
+		} else if tsig := r.IsTsig(); tsig != nil {
+			m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+		}
+		_ = w.WriteMsg(m)
+	})
+	started := make(chan struct{})
+	s.NotifyStartedFunc = func() { close(started) }
+	go func() { _ = s.ListenAndServe() }()
+	defer func() { _ = s.Shutdown() }()
+	<-started
+
+	query := func(name string, secret string) (*dns.Msg, error) {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeSOA)
+		m.SetTsig(name, dns.HmacSHA256, 300, time.Now().Unix())
+		c := &dns.Client{Net: "udp", TsigSecret: map[string]string{name: secret}}
+		r, _, err := c.Exchange(m, s.Addr)
+		return r, err
+	}
+
+	r, err := query("key1.", "c2VjcmV0MQ==")
+	g.Expect(err).To(BeNil())
+	g.Expect(r.Rcode).To(Equal(dns.RcodeSuccess))
+	r, err = query("key2.", "c2VjcmV0Mg==")
+	g.Expect(err).To(BeNil())
+	g.Expect(r.Rcode).To(Equal(dns.RcodeNotAuth))
+
+	// keys are replaced without restarting server
+	secrets.Set(map[string]string{"key2.": "c2VjcmV0Mg=="})
+	r, err = query("key2.", "c2VjcmV0Mg==")
+	g.Expect(err).To(BeNil())
+	g.Expect(r.Rcode).To(Equal(dns.RcodeSuccess))
+	r, err = query("key1.", "c2VjcmV0MQ==")
+	g.Expect(err).To(BeNil())
+	g.Expect(r.Rcode).To(Equal(dns.RcodeNotAuth))
+}
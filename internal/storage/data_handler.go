@@ -6,12 +6,16 @@ import (
 	redisCon "github.com/gomodule/redigo/redis"
 	"github.com/hashicorp/go-immutable-radix"
 	"github.com/hawell/z42/internal/dnssec"
+	"github.com/hawell/z42/internal/metrics"
 	"github.com/hawell/z42/internal/types"
 	"github.com/hawell/z42/pkg/hiredis"
+	"github.com/hawell/z42/pkg/ratelimit"
 	"github.com/json-iterator/go"
 	"github.com/miekg/dns"
 	"go.uber.org/zap"
 	"golang.org/x/sync/singleflight"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -26,6 +30,7 @@ type DataHandlerConfig struct {
 	Redis              hiredis.Config `json:"redis"`
 	MinTTL             uint32         `json:"min_ttl,default:5"`
 	MaxTTL             uint32         `json:"max_ttl,default:3600"`
+	JournalSize        int            `json:"journal_size"`
 }
 
 type DataHandler struct {
@@ -39,12 +44,31 @@ type DataHandler struct {
 	zoneInflight   *singleflight.Group
 	quit           chan struct{}
 	quitWG         sync.WaitGroup
+	updateHandlers map[int]func(zone string)
+	tsigHandlers   map[int]func()
+	nextHandlerId  int
+	updateLock     sync.RWMutex
+	generations    map[string]uint64
+	generationLock sync.RWMutex
+}
+
+// CacheStats are counters of a ristretto cache since start or last flush of all zones
+type CacheStats struct {
+	Hits        uint64  `json:"hits"`
+	Misses      uint64  `json:"misses"`
+	Ratio       float64 `json:"ratio"`
+	KeysAdded   uint64  `json:"keys_added"`
+	KeysEvicted uint64  `json:"keys_evicted"`
+	SetsDropped uint64  `json:"sets_dropped"`
 }
 
 const (
 	zoneForcedReload = time.Minute * 60
 	keyPrefix        = "z42:zones:"
 	zonesKey         = "z42:zones"
+	tsigKeysKey      = "z42:tsig"
+	cookieSecretsKey = "z42:cookies:"
+	rateLimitKey     = "z42:ratelimit"
 )
 
 var (
@@ -61,18 +85,24 @@ func NewDataHandler(config *DataHandlerConfig) *DataHandler {
 		recordInflight: new(singleflight.Group),
 		zoneInflight:   new(singleflight.Group),
 		quit:           make(chan struct{}),
+		generations:    make(map[string]uint64),
+		updateHandlers: make(map[int]func(zone string)),
+		tsigHandlers:   make(map[int]func()),
 	}
+	dh.redis.OnError(func(err error) {
+		metrics.RedisErrors.WithLabelValues("data").Inc()
+	})
 	dh.zoneCache, _ = ristretto.NewCache(&ristretto.Config{
 		NumCounters: int64(config.ZoneCacheSize) * 10,
 		MaxCost:     int64(config.ZoneCacheSize),
 		BufferItems: 64,
-		Metrics:     false,
+		Metrics:     true,
 	})
 	dh.recordCache, _ = ristretto.NewCache(&ristretto.Config{
 		NumCounters: int64(config.RecordCacheSize) * 10,
 		MaxCost:     int64(config.RecordCacheSize),
 		BufferItems: 64,
-		Metrics:     false,
+		Metrics:     true,
 	})
 
 	dh.LoadZones()
@@ -97,14 +127,24 @@ func NewDataHandler(config *DataHandlerConfig) *DataHandler {
 			keyStr := channel
 			keyParts := splitDbKey(keyStr)
 			if isRRSetEntry(keyParts) {
-				dh.recordCache.Del(keyStr)
+				dh.recordCache.Del(dh.recordCacheKey(keyParts[0], keyStr))
 			} else {
 				dh.zoneCache.Del(keyParts[0])
 			}
+			dh.zoneUpdated(keyParts[0])
 		}, func(err error) {
 			zap.L().Error("error", zap.Error(err))
 		}, zonesQuitChan)
 
+		dh.quitWG.Add(1)
+		tsigQuitChan := make(chan *sync.WaitGroup, 1)
+		go dh.redis.SubscribeEvent(tsigKeysKey, func() {
+		}, func(channel string, data string) {
+			dh.tsigUpdated()
+		}, func(err error) {
+			zap.L().Error("error", zap.Error(err))
+		}, tsigQuitChan)
+
 		reloadTicker := time.NewTicker(time.Duration(config.ZoneReload) * time.Second)
 		forceReloadTicker := time.NewTicker(zoneForcedReload)
 		for {
@@ -115,6 +155,7 @@ func NewDataHandler(config *DataHandlerConfig) *DataHandler {
 				zap.L().Debug("zone updater stopped")
 				zoneListQuitChan <- &dh.quitWG
 				zonesQuitChan <- &dh.quitWG
+				tsigQuitChan <- &dh.quitWG
 				return
 			case <-reloadTicker.C:
 				if modified {
@@ -143,11 +184,97 @@ func splitDbKey(key string) []string {
 	return strings.Split(key, ":")
 }
 
+// OnZoneUpdate registers a function to be called whenever data of a zone is modified, returned function unregisters it
+func (dh *DataHandler) OnZoneUpdate(handler func(zone string)) func() {
+	dh.updateLock.Lock()
+	defer dh.updateLock.Unlock()
+	id := dh.nextHandlerId
+	dh.nextHandlerId++
+	dh.updateHandlers[id] = handler
+	return func() {
+		dh.updateLock.Lock()
+		defer dh.updateLock.Unlock()
+		delete(dh.updateHandlers, id)
+	}
+}
+
+func (dh *DataHandler) zoneUpdated(zone string) {
+	dh.updateLock.RLock()
+	defer dh.updateLock.RUnlock()
+	for _, handler := range dh.updateHandlers {
+		handler(zone)
+	}
+}
+
+// OnTsigUpdate registers a function to be called whenever tsig keys stored in redis are modified, returned function unregisters it
+func (dh *DataHandler) OnTsigUpdate(handler func()) func() {
+	dh.updateLock.Lock()
+	defer dh.updateLock.Unlock()
+	id := dh.nextHandlerId
+	dh.nextHandlerId++
+	dh.tsigHandlers[id] = handler
+	return func() {
+		dh.updateLock.Lock()
+		defer dh.updateLock.Unlock()
+		delete(dh.tsigHandlers, id)
+	}
+}
+
+func (dh *DataHandler) tsigUpdated() {
+	dh.updateLock.RLock()
+	defer dh.updateLock.RUnlock()
+	for _, handler := range dh.tsigHandlers {
+		handler()
+	}
+}
+
 func (dh *DataHandler) ShutDown() {
 	close(dh.quit)
 	dh.quitWG.Wait()
 }
 
+// recordCacheKey prefixes key with flush generation of zone, so records cached before a flush are not found anymore
+func (dh *DataHandler) recordCacheKey(zone string, key string) string {
+	dh.generationLock.RLock()
+	generation, ok := dh.generations[zone]
+	dh.generationLock.RUnlock()
+	if !ok {
+		return key
+	}
+	return strconv.FormatUint(generation, 10) + "|" + key
+}
+
+// FlushZone removes zone and its records from caches
+func (dh *DataHandler) FlushZone(zone string) {
+	dh.generationLock.Lock()
+	dh.generations[zone]++
+	dh.generationLock.Unlock()
+	dh.zoneCache.Del(zone)
+}
+
+// FlushAll removes all zones and records from caches
+func (dh *DataHandler) FlushAll() {
+	dh.zoneCache.Clear()
+	dh.recordCache.Clear()
+}
+
+func (dh *DataHandler) CacheStats() map[string]CacheStats {
+	stats := func(cache *ristretto.Cache) CacheStats {
+		return CacheStats{
+			Hits:        cache.Metrics.Hits(),
+			Misses:      cache.Metrics.Misses(),
+			Ratio:       cache.Metrics.Ratio(),
+			KeysAdded:   cache.Metrics.KeysAdded(),
+			KeysEvicted: cache.Metrics.KeysEvicted(),
+			SetsDropped: cache.Metrics.SetsDropped(),
+		}
+	}
+	return map[string]CacheStats{
+		"zone":   stats(dh.zoneCache),
+		"record": stats(dh.recordCache),
+	}
+}
+
 func zoneLocationsKey(zone string) string {
 	return keyPrefix + zone + ":labels"
 }
@@ -168,6 +295,10 @@ func zonePubKey(zone string, keyType string) string {
 	return keyPrefix + zone + ":" + keyType + ":pub"
 }
 
+func zoneKeysKey(zone string) string {
+	return keyPrefix + zone + ":keys"
+}
+
 func zonePrivKey(zone string, keyType string) string {
 	return keyPrefix + zone + ":" + keyType + ":priv"
 }
@@ -206,15 +337,28 @@ func (dh *DataHandler) FindZone(qname string) string {
 	return ""
 }
 
+// LoadedZones returns zones loaded by last LoadZones
+func (dh *DataHandler) LoadedZones() []string {
+	var zones []string
+	dh.zones.Root().Walk(func(k []byte, v interface{}) bool {
+		zones = append(zones, v.(string))
+		return false
+	})
+	sort.Strings(zones)
+	return zones
+}
+
 func (dh *DataHandler) GetZone(zone string) *types.Zone {
 	cachedZone, found := dh.zoneCache.Get(zone)
 	var z *types.Zone = nil
 	if found && cachedZone != nil {
 		z = cachedZone.(*types.Zone)
 		if time.Now().Unix() <= z.CacheTimeout {
+			metrics.CacheRequests.WithLabelValues("zone", "hit").Inc()
 			return z
 		}
 	}
+	metrics.CacheRequests.WithLabelValues("zone", "miss").Inc()
 
 	answer, _, _ := dh.zoneInflight.Do(zone, func() (interface{}, error) {
 		locations, err := dh.redis.SMembers(zoneLocationsKey(zone))
@@ -229,6 +373,7 @@ func (dh *DataHandler) GetZone(zone string) *types.Zone {
 		}
 
 		z := types.NewZone(zone, locations, configStr)
+		dh.loadZoneSerial(z)
 		dh.loadZoneKeys(z)
 		z.CacheTimeout = time.Now().Unix() + dh.config.ZoneCacheTimeout
 
@@ -249,6 +394,15 @@ func (dh *DataHandler) GetZoneConfig(zone string) (*types.ZoneConfig, error) {
 	return z.Config, nil
 }
 
+// LoadZoneConfig reads zone config from redis bypassing zone cache, dnssec flag is not affected by availability of zone keys
+func (dh *DataHandler) LoadZoneConfig(zone string) (*types.ZoneConfig, error) {
+	configStr, err := dh.redis.Get(zoneConfigKey(zone))
+	if err != nil {
+		return nil, err
+	}
+	return types.ZoneConfigFromJson(zone, configStr), nil
+}
+
 func (dh *DataHandler) GetZones() []string {
 	domains, err := dh.redis.SMembers(zonesKey)
 	if err != nil {
@@ -288,18 +442,21 @@ func (dh *DataHandler) SetZoneConfigFromJson(zone string, config string) error {
 
 func (dh *DataHandler) getRRSet(zone string, label string, rtype uint16, result types.RRSet) (types.RRSet, error) {
 	key := zoneLocationRRSetKey(zone, label, rtype)
-	cachedRRSet, found := dh.recordCache.Get(key)
+	cacheKey := dh.recordCacheKey(zone, key)
+	cachedRRSet, found := dh.recordCache.Get(cacheKey)
 	var r types.RRSet
 	if found {
 		r = cachedRRSet.(types.RRSet)
 		if time.Now().Unix() <= dh.config.RecordCacheTimeout {
+			metrics.CacheRequests.WithLabelValues("record", "hit").Inc()
 			return r, nil
 		}
 	}
-	answer, err, _ := dh.recordInflight.Do(key, func() (interface{}, error) {
+	metrics.CacheRequests.WithLabelValues("record", "miss").Inc()
+	answer, err, _ := dh.recordInflight.Do(cacheKey, func() (interface{}, error) {
 		val, err := dh.redis.Get(key)
 		if err == redisCon.ErrNil {
-			dh.recordCache.Set(key, result, 1)
+			dh.recordCache.Set(cacheKey, result, 1)
 			return result, nil
 		} else if err != nil {
 			zap.L().Error("cannot get location", zap.Error(err), zap.String("label", label), zap.String("zone", zone))
@@ -318,7 +475,7 @@ func (dh *DataHandler) getRRSet(zone string, label string, rtype uint16, result
 				return nil, err
 			}
 		}
-		dh.recordCache.Set(key, result, 1)
+		dh.recordCache.Set(cacheKey, result, 1)
 		return result, nil
 	})
 
@@ -330,7 +487,153 @@ func (dh *DataHandler) getRRSet(zone string, label string, rtype uint16, result
 }
 
 func (dh *DataHandler) SetRRSetFromJson(zone string, label string, rtype uint16, value string) error {
-	return dh.redis.Set(zoneLocationRRSetKey(zone, label, rtype), value)
+	return dh.updateRRSet(zone, label, rtype, value)
+}
+
+func (dh *DataHandler) DeleteRRSet(zone string, label string, rtype uint16) error {
+	return dh.updateRRSet(zone, label, rtype, "")
+}
+
+func (dh *DataHandler) updateRRSet(zone string, label string, rtype uint16, value string) error {
+	key := zoneLocationRRSetKey(zone, label, rtype)
+	if !dh.journalEnabled(zone) {
+		if value == "" {
+			return dh.redis.DelKey(key)
+		}
+		return dh.redis.Set(key, value)
+	}
+	return dh.transaction(func(get func(keys ...string) ([]string, error)) ([]hiredis.Command, error) {
+		values, err := get(key)
+		if err != nil {
+			return nil, err
+		}
+		if values[0] == value {
+			return nil, nil
+		}
+		commands := []hiredis.Command{rrsetCommand(key, value)}
+		journalCommands, err := dh.journalCommands(zone, []RRSetChange{{Location: label, Type: rtype, Old: values[0], New: value}}, get)
+		if err != nil {
+			return nil, err
+		}
+		return append(commands, journalCommands...), nil
+	})
+}
+
+// UpdateRRSets atomically applies changes to zone, an empty New value deletes the rrset.
+// changes not modifying stored rrsets are skipped, locations are enabled or disabled according to the remaining rrsets.
+func (dh *DataHandler) UpdateRRSets(zone string, changes []RRSetChange) error {
+	journaled := dh.journalEnabled(zone)
+	return dh.transaction(func(get func(keys ...string) ([]string, error)) ([]hiredis.Command, error) {
+		keys := make([]string, 0, len(changes))
+		for _, change := range changes {
+			keys = append(keys, zoneLocationRRSetKey(zone, change.Location, change.Type))
+		}
+		olds, err := get(keys...)
+		if err != nil {
+			return nil, err
+		}
+		var (
+			commands []hiredis.Command
+			applied  []RRSetChange
+		)
+		for i, change := range changes {
+			if olds[i] == change.New {
+				continue
+			}
+			change.Old = olds[i]
+			commands = append(commands, rrsetCommand(keys[i], change.New))
+			applied = append(applied, change)
+		}
+		if len(applied) == 0 {
+			return nil, nil
+		}
+
+		used, err := dh.locationsUsed(zone, changes, applied, get)
+		if err != nil {
+			return nil, err
+		}
+		for location, ok := range used {
+			if ok {
+				commands = append(commands, hiredis.Command{Name: "SADD", Key: zoneLocationsKey(zone), Args: []interface{}{location}})
+			} else if location != "@" {
+				commands = append(commands, hiredis.Command{Name: "SREM", Key: zoneLocationsKey(zone), Args: []interface{}{location}})
+			}
+		}
+
+		if journaled {
+			journalCommands, err := dh.journalCommands(zone, applied, get)
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, journalCommands...)
+		}
+		return commands, nil
+	})
+}
+
+const transactionRetries = 10
+
+// transaction runs fn in a redis transaction, it is retried if keys read by fn are modified concurrently
+func (dh *DataHandler) transaction(fn func(get func(keys ...string) ([]string, error)) ([]hiredis.Command, error)) error {
+	var err error
+	for i := 0; i < transactionRetries; i++ {
+		if err = dh.redis.Transaction(fn); err != hiredis.ErrTransactionAborted {
+			return err
+		}
+	}
+	return err
+}
+
+// rrsetCommand returns command to set rrset value, an empty value deletes the rrset
+func rrsetCommand(key string, value string) hiredis.Command {
+	if value == "" {
+		return hiredis.Command{Name: "DEL", Key: key}
+	}
+	return hiredis.Command{Name: "SET", Key: key, Args: []interface{}{value}}
+}
+
+// locationsUsed checks whether locations of applied changes have any rrset after changes are applied,
+// rrsets not in changes are read in a single round trip
+func (dh *DataHandler) locationsUsed(zone string, changes []RRSetChange, applied []RRSetChange, get func(keys ...string) ([]string, error)) (map[string]bool, error) {
+	type rrsetKey struct {
+		location string
+		rtype    uint16
+	}
+	values := make(map[rrsetKey]string)
+	for _, change := range changes {
+		values[rrsetKey{change.Location, change.Type}] = change.New
+	}
+	used := make(map[string]bool)
+	var (
+		keys      []string
+		locations []string
+	)
+	for _, change := range applied {
+		if _, ok := used[change.Location]; ok {
+			continue
+		}
+		used[change.Location] = false
+		for _, rtype := range append([]uint16{types.TypeANAME}, types.TransferTypes...) {
+			if value, ok := values[rrsetKey{change.Location, rtype}]; ok {
+				if value != "" {
+					used[change.Location] = true
+				}
+				continue
+			}
+			keys = append(keys, zoneLocationRRSetKey(zone, change.Location, rtype))
+			locations = append(locations, change.Location)
+		}
+	}
+	stored, err := get(keys...)
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range stored {
+		if value != "" {
+			used[locations[i]] = true
+		}
+	}
+	return used, nil
 }
 
 func (dh *DataHandler) SetRRSet(zone string, label string, rtype uint16, rrset types.RRSet) error {
@@ -342,18 +645,27 @@ func (dh *DataHandler) SetRRSet(zone string, label string, rtype uint16, rrset t
 }
 
 type locationEntry struct {
-	A     *types.IP_RRSet    `json:"a,omitempty"`
-	AAAA  *types.IP_RRSet    `json:"aaaa,omitempty"`
-	CNAME *types.CNAME_RRSet `json:"cname,omitempty"`
-	TXT   *types.TXT_RRSet   `json:"txt,omitempty"`
-	NS    *types.NS_RRSet    `json:"ns,omitempty"`
-	MX    *types.MX_RRSet    `json:"mx,omitempty"`
-	SRV   *types.SRV_RRSet   `json:"srv,omitempty"`
-	CAA   *types.CAA_RRSet   `json:"caa,omitempty"`
-	PTR   *types.PTR_RRSet   `json:"ptr,omitempty"`
-	TLSA  *types.TLSA_RRSet  `json:"tlsa,omitempty"`
-	DS    *types.DS_RRSet    `json:"ds,omitempty"`
-	ANAME *types.ANAME_RRSet `json:"aname,omitempty"`
+	A          *types.IP_RRSet         `json:"a,omitempty"`
+	AAAA       *types.IP_RRSet         `json:"aaaa,omitempty"`
+	CNAME      *types.CNAME_RRSet      `json:"cname,omitempty"`
+	TXT        *types.TXT_RRSet        `json:"txt,omitempty"`
+	NS         *types.NS_RRSet         `json:"ns,omitempty"`
+	MX         *types.MX_RRSet         `json:"mx,omitempty"`
+	SRV        *types.SRV_RRSet        `json:"srv,omitempty"`
+	CAA        *types.CAA_RRSet        `json:"caa,omitempty"`
+	PTR        *types.PTR_RRSet        `json:"ptr,omitempty"`
+	TLSA       *types.TLSA_RRSet       `json:"tlsa,omitempty"`
+	DS         *types.DS_RRSet         `json:"ds,omitempty"`
+	SSHFP      *types.SSHFP_RRSet      `json:"sshfp,omitempty"`
+	NAPTR      *types.NAPTR_RRSet      `json:"naptr,omitempty"`
+	URI        *types.URI_RRSet        `json:"uri,omitempty"`
+	HINFO      *types.HINFO_RRSet      `json:"hinfo,omitempty"`
+	SMIMEA     *types.SMIMEA_RRSet     `json:"smimea,omitempty"`
+	OPENPGPKEY *types.OPENPGPKEY_RRSet `json:"openpgpkey,omitempty"`
+	SVCB       *types.SVCB_RRSet       `json:"svcb,omitempty"`
+	HTTPS      *types.HTTPS_RRSet      `json:"https,omitempty"`
+	DNAME      *types.DNAME_RRSet      `json:"dname,omitempty"`
+	ANAME      *types.ANAME_RRSet      `json:"aname,omitempty"`
 }
 
 func (dh *DataHandler) SetLocationFromJson(zone string, location string, value string) error {
@@ -430,6 +742,60 @@ func (dh *DataHandler) SetLocationFromJson(zone string, location string, value s
 			zap.L().Error("cannot set rrset", zap.Error(err))
 		}
 	}
+	if entry.SSHFP != nil {
+		entry.SSHFP.TtlValue = fixTTL(entry.SSHFP.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeSSHFP, entry.SSHFP); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
+	if entry.NAPTR != nil {
+		entry.NAPTR.TtlValue = fixTTL(entry.NAPTR.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeNAPTR, entry.NAPTR); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
+	if entry.URI != nil {
+		entry.URI.TtlValue = fixTTL(entry.URI.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeURI, entry.URI); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
+	if entry.HINFO != nil {
+		entry.HINFO.TtlValue = fixTTL(entry.HINFO.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeHINFO, entry.HINFO); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
+	if entry.SMIMEA != nil {
+		entry.SMIMEA.TtlValue = fixTTL(entry.SMIMEA.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeSMIMEA, entry.SMIMEA); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
+	if entry.OPENPGPKEY != nil {
+		entry.OPENPGPKEY.TtlValue = fixTTL(entry.OPENPGPKEY.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeOPENPGPKEY, entry.OPENPGPKEY); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
+	if entry.SVCB != nil {
+		entry.SVCB.TtlValue = fixTTL(entry.SVCB.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeSVCB, entry.SVCB); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
+	if entry.HTTPS != nil {
+		entry.HTTPS.TtlValue = fixTTL(entry.HTTPS.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeHTTPS, entry.HTTPS); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
+	if entry.DNAME != nil {
+		entry.DNAME.TtlValue = fixTTL(entry.DNAME.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeDNAME, entry.DNAME); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
 	if entry.ANAME != nil {
 		entry.ANAME.TtlValue = fixTTL(entry.ANAME.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
 		if err := dh.SetRRSet(zone, location, types.TypeANAME, entry.ANAME); err != nil {
@@ -449,6 +815,14 @@ func fixTTL(ttl uint32, min uint32, max uint32) uint32 {
 	return ttl
 }
 
+func (dh *DataHandler) RRSet(zone string, label string, rtype uint16) (types.RRSet, error) {
+	result := types.NewRRSet(rtype)
+	if result == nil {
+		return nil, errors.New("unsupported rrset type")
+	}
+	return dh.getRRSet(zone, label, rtype, result)
+}
+
 func (dh *DataHandler) A(zone string, label string) (*types.IP_RRSet, error) {
 	r, err := dh.getRRSet(zone, label, dns.TypeA, &types.IP_RRSet{})
 	if err != nil {
@@ -537,6 +911,78 @@ func (dh *DataHandler) DS(zone string, label string) (*types.DS_RRSet, error) {
 	return r.(*types.DS_RRSet), nil
 }
 
+func (dh *DataHandler) SSHFP(zone string, label string) (*types.SSHFP_RRSet, error) {
+	r, err := dh.getRRSet(zone, label, dns.TypeSSHFP, &types.SSHFP_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.SSHFP_RRSet), nil
+}
+
+func (dh *DataHandler) NAPTR(zone string, label string) (*types.NAPTR_RRSet, error) {
+	r, err := dh.getRRSet(zone, label, dns.TypeNAPTR, &types.NAPTR_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.NAPTR_RRSet), nil
+}
+
+func (dh *DataHandler) URI(zone string, label string) (*types.URI_RRSet, error) {
+	r, err := dh.getRRSet(zone, label, dns.TypeURI, &types.URI_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.URI_RRSet), nil
+}
+
+func (dh *DataHandler) HINFO(zone string, label string) (*types.HINFO_RRSet, error) {
+	r, err := dh.getRRSet(zone, label, dns.TypeHINFO, &types.HINFO_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.HINFO_RRSet), nil
+}
+
+func (dh *DataHandler) SMIMEA(zone string, label string) (*types.SMIMEA_RRSet, error) {
+	r, err := dh.getRRSet(zone, label, dns.TypeSMIMEA, &types.SMIMEA_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.SMIMEA_RRSet), nil
+}
+
+func (dh *DataHandler) OPENPGPKEY(zone string, label string) (*types.OPENPGPKEY_RRSet, error) {
+	r, err := dh.getRRSet(zone, label, dns.TypeOPENPGPKEY, &types.OPENPGPKEY_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.OPENPGPKEY_RRSet), nil
+}
+
+func (dh *DataHandler) SVCB(zone string, label string) (*types.SVCB_RRSet, error) {
+	r, err := dh.getRRSet(zone, label, dns.TypeSVCB, &types.SVCB_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.SVCB_RRSet), nil
+}
+
+func (dh *DataHandler) HTTPS(zone string, label string) (*types.HTTPS_RRSet, error) {
+	r, err := dh.getRRSet(zone, label, dns.TypeHTTPS, &types.HTTPS_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.HTTPS_RRSet), nil
+}
+
+func (dh *DataHandler) DNAME(zone string, label string) (*types.DNAME_RRSet, error) {
+	r, err := dh.getRRSet(zone, label, dns.TypeDNAME, &types.DNAME_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.DNAME_RRSet), nil
+}
+
 func (dh *DataHandler) ANAME(zone string, label string) (*types.ANAME_RRSet, error) {
 	r, err := dh.getRRSet(zone, label, types.TypeANAME, &types.ANAME_RRSet{})
 	if err != nil {
@@ -552,6 +998,135 @@ func (dh *DataHandler) SetZoneKey(zone string, keyType string, pub string, priv
 	return dh.redis.Set(zonePrivKey(zone, keyType), priv)
 }
 
+// GetTsigKeys returns json encoded tsig keys stored in redis indexed by key name
+func (dh *DataHandler) GetTsigKeys() (map[string]string, error) {
+	names, err := dh.redis.GetHKeys(tsigKeysKey)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string)
+	for _, name := range names {
+		value, err := dh.redis.HGet(tsigKeysKey, name)
+		if err != nil {
+			return nil, err
+		}
+		keys[name] = value
+	}
+	return keys, nil
+}
+
+func (dh *DataHandler) SetTsigKeyFromJson(name string, value string) error {
+	return dh.redis.HSet(tsigKeysKey, name, value)
+}
+
+func (dh *DataHandler) DeleteTsigKey(name string) error {
+	return dh.redis.HDel(tsigKeysKey, name)
+}
+
+// CookieSecret returns the dns cookie secret shared by all instances for period, secret is stored if no instance has set one yet
+func (dh *DataHandler) CookieSecret(period int64, secret string, ttl time.Duration) (string, error) {
+	key := cookieSecretsKey + strconv.FormatInt(period, 10)
+	set, err := dh.redis.SetNX(key, secret)
+	if err != nil {
+		return "", err
+	}
+	if set {
+		if err := dh.redis.Expire(key, ttl); err != nil {
+			return "", err
+		}
+		return secret, nil
+	}
+	return dh.redis.Get(key)
+}
+
+// GetRateLimitLists returns json encoded ratelimit lists stored in redis, empty lists are returned if none is set
+func (dh *DataHandler) GetRateLimitLists() (*ratelimit.Lists, error) {
+	lists := new(ratelimit.Lists)
+	value, err := dh.redis.Get(rateLimitKey)
+	if err == redisCon.ErrNil {
+		return lists, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := jsoniter.Unmarshal([]byte(value), lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (dh *DataHandler) SetRateLimitListsFromJson(value string) error {
+	return dh.redis.Set(rateLimitKey, value)
+}
+
+// GetZoneKey returns the single zsk or ksk of zone stored with SetZoneKey
+func (dh *DataHandler) GetZoneKey(zone string, keyType string) (string, string, error) {
+	pub, err := dh.redis.Get(zonePubKey(zone, keyType))
+	if err != nil {
+		return "", "", err
+	}
+	priv, err := dh.redis.Get(zonePrivKey(zone, keyType))
+	if err != nil {
+		return "", "", err
+	}
+	return pub, priv, nil
+}
+
+// GetZoneKeys returns managed keys of zone indexed by key id
+func (dh *DataHandler) GetZoneKeys(zone string) (map[string]*types.ZoneKeyInfo, error) {
+	ids, err := dh.redis.GetHKeys(zoneKeysKey(zone))
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*types.ZoneKeyInfo)
+	for _, id := range ids {
+		value, err := dh.redis.HGet(zoneKeysKey(zone), id)
+		if err != nil {
+			return nil, err
+		}
+		key := new(types.ZoneKeyInfo)
+		if err := jsoniter.Unmarshal([]byte(value), key); err != nil {
+			zap.L().Error("cannot parse zone key info", zap.String("zone", zone), zap.String("id", id), zap.Error(err))
+			continue
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+func (dh *DataHandler) SetZoneKeyInfo(zone string, id string, key *types.ZoneKeyInfo) error {
+	value, err := jsoniter.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return dh.redis.HSet(zoneKeysKey(zone), id, string(value))
+}
+
+// ConfirmDS marks published ksk keys of zone as having their DS records added to parent, it returns ids of confirmed keys
+func (dh *DataHandler) ConfirmDS(zone string) ([]string, error) {
+	keys, err := dh.GetZoneKeys(zone)
+	if err != nil {
+		return nil, err
+	}
+	confirmed := []string{}
+	for id, key := range keys {
+		if key.Type != "ksk" || key.State != types.KeyStatePublished {
+			continue
+		}
+		key.DSConfirmed = time.Now().Unix()
+		if err := dh.SetZoneKeyInfo(zone, id, key); err != nil {
+			return nil, err
+		}
+		confirmed = append(confirmed, id)
+	}
+	sort.Strings(confirmed)
+	return confirmed, nil
+}
+
+func (dh *DataHandler) DeleteZoneKeyInfo(zone string, id string) error {
+	return dh.redis.HDel(zoneKeysKey(zone), id)
+}
+
 func (dh *DataHandler) loadKey(zone string, keyType string) *types.ZoneKey {
 	pubStr, _ := dh.redis.Get(zonePubKey(zone, keyType))
 	if pubStr == "" {
@@ -563,15 +1138,19 @@ func (dh *DataHandler) loadKey(zone string, keyType string) *types.ZoneKey {
 		zap.L().Error("key is not set", zap.String("key", zonePrivKey(zone, keyType)))
 		return nil
 	}
+	return parseKey(pubStr, privStr)
+}
+
+func parseKey(pubStr string, privStr string) *types.ZoneKey {
 	privStr = strings.Replace(privStr, "\\n", "\n", -1)
 	zoneKey := new(types.ZoneKey)
-	if rr, err := dns.NewRR(pubStr); err == nil {
+	if rr, err := dns.NewRR(pubStr); err == nil && rr != nil {
 		zoneKey.DnsKey = rr.(*dns.DNSKEY)
 	} else {
 		zap.L().Error("cannot parse zone key", zap.Error(err))
 		return nil
 	}
-	if pk, err := zoneKey.DnsKey.NewPrivateKey(privStr); err == nil {
+	if pk, err := dnssec.NewPrivateKey(zoneKey.DnsKey, privStr); err == nil {
 		zoneKey.PrivateKey = pk
 	} else {
 		zap.L().Error("cannot create private key", zap.Error(err))
@@ -583,31 +1162,94 @@ func (dh *DataHandler) loadKey(zone string, keyType string) *types.ZoneKey {
 	return zoneKey
 }
 
+// loadManagedKeys selects the most recently activated zsk and ksk for signing, ksk keys in any state except removed sign the DNSKEY rrset
+// and published or active ksk keys are advertised to parent with CDS/CDNSKEY
+func loadManagedKeys(z *types.Zone, keys map[string]*types.ZoneKeyInfo) []*types.ZoneKey {
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var (
+		signingKSKs  []*types.ZoneKey
+		zskActivated int64
+		kskActivated int64
+	)
+	for _, id := range ids {
+		info := keys[id]
+		if info.State == types.KeyStateRemoved {
+			continue
+		}
+		key := parseKey(info.Public, info.Private)
+		if key == nil {
+			zap.L().Error("invalid zone key", zap.String("zone", z.Name), zap.String("id", id))
+			continue
+		}
+		z.DnsKeys = append(z.DnsKeys, key.DnsKey)
+		switch info.Type {
+		case "zsk":
+			key.DnsKey.Flags = 256
+			if info.State == types.KeyStateActive && (z.ZSK == nil || info.Activated > zskActivated) {
+				z.ZSK, zskActivated = key, info.Activated
+			}
+		case "ksk":
+			key.DnsKey.Flags = 257
+			signingKSKs = append(signingKSKs, key)
+			if info.State == types.KeyStateActive || info.State == types.KeyStatePublished {
+				z.KSKs = append(z.KSKs, key)
+			}
+			if info.State == types.KeyStateActive && (z.KSK == nil || info.Activated > kskActivated) {
+				z.KSK, kskActivated = key, info.Activated
+			}
+		}
+	}
+	return signingKSKs
+}
+
 func (dh *DataHandler) loadZoneKeys(z *types.Zone) {
 	if z.Config.DnsSec {
-		z.ZSK = dh.loadKey(z.Name, "zsk")
-		if z.ZSK == nil {
-			z.Config.DnsSec = false
-			return
+		var signingKSKs []*types.ZoneKey
+		keys, err := dh.GetZoneKeys(z.Name)
+		if err != nil {
+			zap.L().Error("cannot load zone keys", zap.String("zone", z.Name), zap.Error(err))
 		}
-		z.KSK = dh.loadKey(z.Name, "ksk")
-		if z.KSK == nil {
-			z.Config.DnsSec = false
-			return
+		if len(keys) > 0 {
+			signingKSKs = loadManagedKeys(z, keys)
+			if z.ZSK == nil || z.KSK == nil {
+				zap.L().Error("no active key", zap.String("zone", z.Name))
+				z.Config.DnsSec = false
+				return
+			}
+		} else {
+			z.ZSK = dh.loadKey(z.Name, "zsk")
+			if z.ZSK == nil {
+				z.Config.DnsSec = false
+				return
+			}
+			z.KSK = dh.loadKey(z.Name, "ksk")
+			if z.KSK == nil {
+				z.Config.DnsSec = false
+				return
+			}
+			z.ZSK.DnsKey.Flags = 256
+			z.KSK.DnsKey.Flags = 257
+			z.DnsKeys = []dns.RR{z.ZSK.DnsKey, z.KSK.DnsKey}
+			signingKSKs = []*types.ZoneKey{z.KSK}
+			z.KSKs = []*types.ZoneKey{z.KSK}
 		}
 
-		z.ZSK.DnsKey.Flags = 256
-		z.KSK.DnsKey.Flags = 257
-		if z.ZSK.DnsKey.Hdr.Ttl != z.KSK.DnsKey.Hdr.Ttl {
-			z.ZSK.DnsKey.Hdr.Ttl = z.KSK.DnsKey.Hdr.Ttl
+		for _, rr := range z.DnsKeys {
+			rr.Header().Ttl = z.KSK.DnsKey.Hdr.Ttl
 		}
 
-		if rrsig := dnssec.SignRRSet([]dns.RR{z.ZSK.DnsKey, z.KSK.DnsKey}, z.Name, z.KSK, z.KSK.DnsKey.Hdr.Ttl); rrsig != nil {
-			z.DnsKeySig = rrsig
-		} else {
-			zap.L().Error("cannot create RRSIG for DNSKEY")
-			z.Config.DnsSec = false
-			return
+		for _, ksk := range signingKSKs {
+			if rrsig := dnssec.SignRRSet(z.DnsKeys, z.Name, ksk, z.KSK.DnsKey.Hdr.Ttl); rrsig != nil {
+				z.DnsKeySigs = append(z.DnsKeySigs, rrsig)
+			} else {
+				zap.L().Error("cannot create RRSIG for DNSKEY")
+				z.Config.DnsSec = false
+				return
+			}
 		}
 	}
 }
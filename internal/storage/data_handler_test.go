@@ -6,6 +6,8 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	. "github.com/onsi/gomega"
 	"sort"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -279,6 +281,51 @@ func TestTLSA(t *testing.T) {
 	testRRSet(dns.TypeTLSA, &types.TLSA_RRSet{}, &types.TLSA_RRSet{}, tlsaStr, t)
 }
 
+func TestSSHFP(t *testing.T) {
+	sshfpStr := `{"ttl":300, "records":[{"algorithm":4, "type":2, "fingerprint":"123456789abcdef67890123456789abcdef67890123456789abcdef123456789"}]}`
+	testRRSet(dns.TypeSSHFP, &types.SSHFP_RRSet{}, &types.SSHFP_RRSet{}, sshfpStr, t)
+}
+
+func TestNAPTR(t *testing.T) {
+	naptrStr := `{"ttl":300, "records":[{"order":100, "preference":10, "flags":"S", "service":"SIP+D2U", "regexp":"", "replacement":"_sip._udp.example.com."}]}`
+	testRRSet(dns.TypeNAPTR, &types.NAPTR_RRSet{}, &types.NAPTR_RRSet{}, naptrStr, t)
+}
+
+func TestURI(t *testing.T) {
+	uriStr := `{"ttl":300, "records":[{"priority":10, "weight":1, "target":"ftp://ftp1.example.com/public"}]}`
+	testRRSet(dns.TypeURI, &types.URI_RRSet{}, &types.URI_RRSet{}, uriStr, t)
+}
+
+func TestHINFO(t *testing.T) {
+	hinfoStr := `{"ttl":300, "records":[{"cpu":"x86", "os":"linux"}]}`
+	testRRSet(dns.TypeHINFO, &types.HINFO_RRSet{}, &types.HINFO_RRSet{}, hinfoStr, t)
+}
+
+func TestSMIMEA(t *testing.T) {
+	smimeaStr := `{"ttl":300, "records":[{"usage":3, "selector":1, "matching_type":1, "certificate":"d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971"}]}`
+	testRRSet(dns.TypeSMIMEA, &types.SMIMEA_RRSet{}, &types.SMIMEA_RRSet{}, smimeaStr, t)
+}
+
+func TestOPENPGPKEY(t *testing.T) {
+	openpgpkeyStr := `{"ttl":300, "records":[{"public_key":"mQINBFit2jsBEADrbl5vjVxYeAE0g0IDYCBpHirv1Sjlqxx5gjtPhb2YhvyDMXjq"}]}`
+	testRRSet(dns.TypeOPENPGPKEY, &types.OPENPGPKEY_RRSet{}, &types.OPENPGPKEY_RRSet{}, openpgpkeyStr, t)
+}
+
+func TestSVCB(t *testing.T) {
+	svcbStr := `{"ttl":300, "records":[{"priority":1, "target":"svc.example.com.", "alpn":["h2"], "port":8443, "ipv4hint":["1.2.3.4"], "ipv6hint":["2001:db8::1"], "ech":"AQID"}]}`
+	testRRSet(dns.TypeSVCB, &types.SVCB_RRSet{}, &types.SVCB_RRSet{}, svcbStr, t)
+}
+
+func TestHTTPS(t *testing.T) {
+	httpsStr := `{"ttl":300, "records":[{"priority":0, "target":"www.example.com."}]}`
+	testRRSet(dns.TypeHTTPS, &types.HTTPS_RRSet{}, &types.HTTPS_RRSet{}, httpsStr, t)
+}
+
+func TestDNAME(t *testing.T) {
+	dnameStr := `{"ttl":300, "target":"example.net."}`
+	testRRSet(dns.TypeDNAME, &types.DNAME_RRSet{}, &types.DNAME_RRSet{}, dnameStr, t)
+}
+
 func TestDS(t *testing.T) {
 	dsStr := `{"ttl":300, "records":[{"key_tag":57855, "algorithm":5, "digest_type":1, "digest":"B6DCD485719ADCA18E5F3D48A2331627FDD3636B"}]}`
 	testRRSet(dns.TypeDS, &types.DS_RRSet{}, &types.DS_RRSet{}, dsStr, t)
@@ -465,3 +512,93 @@ func TestConfigUpdate(t *testing.T) {
 	g.Expect(config.DomainId).To(Equal("12345"))
 	g.Expect(config.CnameFlattening).To(BeTrue())
 }
+
+func TestRateLimitLists(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dh := NewDataHandler(&dataHandlerDefaultTestConfig)
+	err := dh.Clear()
+	g.Expect(err).To(BeNil())
+	lists, err := dh.GetRateLimitLists()
+	g.Expect(err).To(BeNil())
+	g.Expect(lists.WhiteList).To(BeEmpty())
+
+	err = dh.SetRateLimitListsFromJson(`{"whitelist":["192.0.2.0/24"],"prefixes":[{"prefix":"2001:db8::/32","rate":120,"burst":20}]}`)
+	g.Expect(err).To(BeNil())
+	lists, err = dh.GetRateLimitLists()
+	g.Expect(err).To(BeNil())
+	g.Expect(lists.WhiteList).To(Equal([]string{"192.0.2.0/24"}))
+	g.Expect(lists.Prefixes[0].Rate).To(Equal(120))
+
+	err = dh.SetRateLimitListsFromJson(`{"whitelist":`)
+	g.Expect(err).To(BeNil())
+	_, err = dh.GetRateLimitLists()
+	g.Expect(err).NotTo(BeNil())
+}
+
+func TestFlush(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dh := NewDataHandler(&dataHandlerDefaultTestConfig)
+	err := dh.Clear()
+	g.Expect(err).To(BeNil())
+	g.Expect(dh.EnableZone("zone1.com.")).To(BeNil())
+	g.Expect(dh.EnableZone("zone2.com.")).To(BeNil())
+	dh.LoadZones()
+	g.Expect(dh.LoadedZones()).To(Equal([]string{"zone1.com.", "zone2.com."}))
+
+	z1, z2 := dh.GetZone("zone1.com."), dh.GetZone("zone2.com.")
+	time.Sleep(10 * time.Millisecond)
+	g.Expect(dh.GetZone("zone1.com.")).To(BeIdenticalTo(z1))
+	g.Expect(dh.CacheStats()["zone"].Hits).To(BeNumerically(">", 0))
+
+	key := zoneLocationRRSetKey("zone1.com.", "www", dns.TypeA)
+	g.Expect(dh.recordCacheKey("zone1.com.", key)).To(Equal(key))
+	dh.FlushZone("zone1.com.")
+	g.Expect(dh.recordCacheKey("zone1.com.", key)).NotTo(Equal(key))
+	g.Expect(dh.GetZone("zone1.com.")).NotTo(BeIdenticalTo(z1))
+	g.Expect(dh.GetZone("zone2.com.")).To(BeIdenticalTo(z2))
+
+	dh.FlushAll()
+	g.Expect(dh.GetZone("zone2.com.")).NotTo(BeIdenticalTo(z2))
+	dh.ShutDown()
+}
+
+func TestJournalConcurrentUpdates(t *testing.T) {
+	g := NewGomegaWithT(t)
+	zoneName := "zone1.com."
+	config := dataHandlerDefaultTestConfig
+	config.JournalSize = 100
+	dh := NewDataHandler(&config)
+	err := dh.Clear()
+	g.Expect(err).To(BeNil())
+	err = dh.EnableZone(zoneName)
+	g.Expect(err).To(BeNil())
+	zone := dh.GetZone(zoneName)
+	g.Expect(zone).NotTo(BeNil())
+	serial := zone.Config.SOA.Serial
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value := `{"ttl":300, "records":[{"ip":"1.2.3.` + strconv.Itoa(i) + `"}]}`
+			g.Expect(dh.SetRRSetFromJson(zoneName, "www", dns.TypeA, value)).To(BeNil())
+		}(i)
+	}
+	wg.Wait()
+
+	entries, ok, err := dh.Journal(zoneName, serial)
+	g.Expect(err).To(BeNil())
+	g.Expect(ok).To(BeTrue())
+	g.Expect(len(entries)).To(Equal(5))
+	old := ""
+	for i, entry := range entries {
+		g.Expect(entry.Serial).To(Equal(serial + uint32(i) + 1))
+		g.Expect(len(entry.Changes)).To(Equal(1))
+		g.Expect(entry.Changes[0].Old).To(Equal(old))
+		old = entry.Changes[0].New
+	}
+	value, err := dh.redis.Get(zoneLocationRRSetKey(zoneName, "www", dns.TypeA))
+	g.Expect(err).To(BeNil())
+	g.Expect(value).To(Equal(old))
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"errors"
+	"github.com/hawell/z42/internal/types"
+	"github.com/hawell/z42/pkg/hiredis"
+	"github.com/json-iterator/go"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"strconv"
+)
+
+type RRSetChange struct {
+	Location string `json:"location"`
+	Type     uint16 `json:"type"`
+	Old      string `json:"old,omitempty"`
+	New      string `json:"new,omitempty"`
+}
+
+type JournalEntry struct {
+	Serial  uint32        `json:"serial"`
+	Changes []RRSetChange `json:"changes"`
+}
+
+const journalItemKey = "entry"
+
+func zoneSerialKey(zone string) string {
+	return keyPrefix + zone + ":serial"
+}
+
+func zoneJournalKey(zone string) string {
+	return keyPrefix + zone + ":journal"
+}
+
+// changes of secondary zones are not journaled, their serial is managed by primary
+func (dh *DataHandler) journalEnabled(zone string) bool {
+	if dh.config.JournalSize <= 0 {
+		return false
+	}
+	configStr, err := dh.redis.Get(zoneConfigKey(zone))
+	if err != nil || configStr == "" {
+		return true
+	}
+	return len(types.ZoneConfigFromJson(zone, configStr).Primaries) == 0
+}
+
+func (dh *DataHandler) loadZoneSerial(z *types.Zone) {
+	if len(z.Config.Primaries) > 0 {
+		return
+	}
+	serialStr, err := dh.redis.Get(zoneSerialKey(z.Name))
+	if err != nil || serialStr == "" {
+		return
+	}
+	serial, err := strconv.ParseUint(serialStr, 10, 32)
+	if err != nil {
+		zap.L().Error("invalid zone serial", zap.String("zone", z.Name), zap.String("serial", serialStr))
+		return
+	}
+	z.Config.SOA.Serial = uint32(serial)
+	z.Config.SOA.Data.Serial = uint32(serial)
+}
+
+// nextSerial reads zone's current serial with get, so it is watched by the transaction
+func (dh *DataHandler) nextSerial(zone string, get func(keys ...string) ([]string, error)) (uint32, error) {
+	values, err := get(zoneSerialKey(zone))
+	if err != nil {
+		return 0, err
+	}
+	var current uint32
+	if values[0] == "" {
+		if z := dh.GetZone(zone); z != nil {
+			current = z.Config.SOA.Serial
+		}
+	} else {
+		serial, err := strconv.ParseUint(values[0], 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		current = uint32(serial)
+	}
+	return current + 1, nil
+}
+
+// journalCommands returns commands to add changes to zone's journal under a new serial
+func (dh *DataHandler) journalCommands(zone string, changes []RRSetChange, get func(keys ...string) ([]string, error)) ([]hiredis.Command, error) {
+	serial, err := dh.nextSerial(zone, get)
+	if err != nil {
+		return nil, err
+	}
+	entry := JournalEntry{
+		Serial:  serial,
+		Changes: changes,
+	}
+	value, err := jsoniter.Marshal(&entry)
+	if err != nil {
+		return nil, err
+	}
+	return []hiredis.Command{
+		{Name: "SET", Key: zoneSerialKey(zone), Args: []interface{}{strconv.FormatUint(uint64(serial), 10)}},
+		{Name: "XADD", Key: zoneJournalKey(zone), Args: []interface{}{"*", journalItemKey, string(value)}},
+		{Name: "XTRIM", Key: zoneJournalKey(zone), Args: []interface{}{"MAXLEN", dh.config.JournalSize}},
+	}, nil
+}
+
+// Journal returns journal entries newer than serial, ok is false if journal doesn't reach back to serial
+func (dh *DataHandler) Journal(zone string, serial uint32) ([]JournalEntry, bool, error) {
+	items, err := dh.redis.XRange(zoneJournalKey(zone), "", "")
+	if err != nil {
+		return nil, false, err
+	}
+	var entries []JournalEntry
+	found := false
+	for _, item := range items {
+		var entry JournalEntry
+		if err := jsoniter.Unmarshal([]byte(item.Value), &entry); err != nil {
+			zap.L().Error("invalid journal entry", zap.String("zone", zone), zap.String("id", item.ID), zap.Error(err))
+			return nil, false, err
+		}
+		if !found {
+			if entry.Serial == serial+1 {
+				found = true
+			} else {
+				continue
+			}
+		} else if entry.Serial != entries[len(entries)-1].Serial+1 {
+			return nil, false, nil
+		}
+		entries = append(entries, entry)
+	}
+	return entries, found, nil
+}
+
+// Diff returns records removed and added by change
+func (change *RRSetChange) Diff(zone string) ([]dns.RR, []dns.RR, error) {
+	name := zone
+	if change.Location != "@" {
+		name = change.Location + "." + zone
+	}
+	oldRecords, err := changeRecords(name, change.Type, change.Old)
+	if err != nil {
+		return nil, nil, err
+	}
+	newRecords, err := changeRecords(name, change.Type, change.New)
+	if err != nil {
+		return nil, nil, err
+	}
+	return subtractRecords(oldRecords, newRecords), subtractRecords(newRecords, oldRecords), nil
+}
+
+func changeRecords(name string, rtype uint16, value string) ([]dns.RR, error) {
+	if value == "" {
+		return nil, nil
+	}
+	rrset := types.NewRRSet(rtype)
+	if rrset == nil {
+		return nil, errors.New("unsupported rrset type")
+	}
+	if err := jsoniter.Unmarshal([]byte(value), rrset); err != nil {
+		return nil, err
+	}
+	return types.RRSetRecords(name, rtype, rrset), nil
+}
+
+func subtractRecords(a []dns.RR, b []dns.RR) []dns.RR {
+	var res []dns.RR
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if dns.IsDuplicate(x, y) && x.Header().Ttl == y.Header().Ttl {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, x)
+		}
+	}
+	return res
+}
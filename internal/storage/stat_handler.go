@@ -2,6 +2,7 @@ package storage
 
 import (
 	"github.com/dgraph-io/ristretto"
+	"github.com/hawell/z42/internal/metrics"
 	"github.com/hawell/z42/internal/types"
 	"github.com/hawell/z42/pkg/hiredis"
 	jsoniter "github.com/json-iterator/go"
@@ -31,6 +32,9 @@ func NewStatHandler(config *StatHandlerConfig) *StatHandler {
 		redis: hiredis.NewRedis(&config.Redis),
 		quit:  make(chan struct{}),
 	}
+	sh.redis.OnError(func(err error) {
+		metrics.RedisErrors.WithLabelValues("stat").Inc()
+	})
 	sh.cache, _ = ristretto.NewCache(&ristretto.Config{
 		NumCounters: int64(cacheSize) * 10,
 		MaxCost:     int64(cacheSize),
@@ -106,6 +106,27 @@ func CAA(rr string) *dns.CAA { r, _ := dns.NewRR(rr); return r.(*dns.CAA) }
 // TLSA returns a TLSA record from rr. It panics on errors.
 func TLSA(rr string) *dns.TLSA { r, _ := dns.NewRR(rr); return r.(*dns.TLSA) }
 
+// SSHFP returns an SSHFP record from rr. It panics on errors.
+func SSHFP(rr string) *dns.SSHFP { r, _ := dns.NewRR(rr); return r.(*dns.SSHFP) }
+
+// NAPTR returns a NAPTR record from rr. It panics on errors.
+func NAPTR(rr string) *dns.NAPTR { r, _ := dns.NewRR(rr); return r.(*dns.NAPTR) }
+
+// URI returns a URI record from rr. It panics on errors.
+func URI(rr string) *dns.URI { r, _ := dns.NewRR(rr); return r.(*dns.URI) }
+
+// SMIMEA returns an SMIMEA record from rr. It panics on errors.
+func SMIMEA(rr string) *dns.SMIMEA { r, _ := dns.NewRR(rr); return r.(*dns.SMIMEA) }
+
+// OPENPGPKEY returns an OPENPGPKEY record from rr. It panics on errors.
+func OPENPGPKEY(rr string) *dns.OPENPGPKEY { r, _ := dns.NewRR(rr); return r.(*dns.OPENPGPKEY) }
+
+// SVCB returns an SVCB record from rr. It panics on errors.
+func SVCB(rr string) *dns.SVCB { r, _ := dns.NewRR(rr); return r.(*dns.SVCB) }
+
+// HTTPS returns an HTTPS record from rr. It panics on errors.
+func HTTPS(rr string) *dns.HTTPS { r, _ := dns.NewRR(rr); return r.(*dns.HTTPS) }
+
 // OPT returns an OPT record with UDP buffer size set to bufsize and the DO bit set to do.
 func OPT(bufsize int, do bool) *dns.OPT {
 	o := new(dns.OPT)
@@ -275,6 +296,10 @@ func Section(tc Case, sec sect, rr []dns.RR) error {
 			if x.Certificate != tt.Certificate {
 				return fmt.Errorf("TLSA Certificate should be %s, but is %s", tt.Certificate, x.Certificate)
 			}
+		case *dns.SSHFP, *dns.NAPTR, *dns.URI, *dns.SMIMEA, *dns.OPENPGPKEY, *dns.SVCB, *dns.HTTPS, *dns.DNAME:
+			if !dns.IsDuplicate(a, section[i]) {
+				return fmt.Errorf("RR %d should be %q, but is %q", i, section[i].String(), a.String())
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,170 @@
+package tsig
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/hawell/z42/internal/storage"
+	"github.com/json-iterator/go"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	OperationTransfer = "transfer"
+	OperationUpdate   = "update"
+	OperationNotify   = "notify"
+)
+
+type KeyConfig struct {
+	Name       string   `json:"name"`
+	Algorithm  string   `json:"algorithm"`
+	Secret     string   `json:"secret"`
+	Zones      []string `json:"zones"`
+	Operations []string `json:"operations"`
+}
+
+// Verify checks key algorithm and secret
+func (key *KeyConfig) Verify() error {
+	switch dns.Fqdn(strings.ToLower(key.Algorithm)) {
+	case dns.HmacSHA256, dns.HmacSHA512:
+	default:
+		return ErrAlgorithm
+	}
+	_, err := base64.StdEncoding.DecodeString(key.Secret)
+	return err
+}
+
+type Config struct {
+	Keys []KeyConfig `json:"keys"`
+}
+
+type Keyring struct {
+	config    *Config
+	redisData *storage.DataHandler
+	keys      atomic.Pointer[map[string]*KeyConfig]
+}
+
+var (
+	ErrUnsigned   = errors.New("request is not signed")
+	ErrNotAllowed = errors.New("key is not allowed for this operation")
+	ErrAlgorithm  = errors.New("unsupported tsig algorithm")
+)
+
+// NewKeyring loads keys from config and redis, keys in redis override config keys with the same name
+func NewKeyring(config *Config, redisData *storage.DataHandler) *Keyring {
+	k := &Keyring{
+		config:    config,
+		redisData: redisData,
+	}
+	k.Reload()
+	return k
+}
+
+// Reload replaces keys with config and current redis keys, previous keys are kept if redis keys cannot be loaded
+func (k *Keyring) Reload() {
+	keys := make(map[string]*KeyConfig)
+	for _, key := range k.config.Keys {
+		add(keys, key)
+	}
+	if k.redisData == nil {
+		k.keys.Store(&keys)
+		return
+	}
+	redisKeys, err := k.redisData.GetTsigKeys()
+	if err != nil {
+		zap.L().Error("cannot load tsig keys", zap.Error(err))
+		if k.keys.Load() == nil {
+			k.keys.Store(&keys)
+		}
+		return
+	}
+	for name, value := range redisKeys {
+		var key KeyConfig
+		if err := jsoniter.Unmarshal([]byte(value), &key); err != nil {
+			zap.L().Error("invalid tsig key", zap.String("name", name), zap.Error(err))
+			continue
+		}
+		if key.Name == "" {
+			key.Name = name
+		}
+		add(keys, key)
+	}
+	k.keys.Store(&keys)
+}
+
+func add(keys map[string]*KeyConfig, key KeyConfig) {
+	key.Name = dns.Fqdn(strings.ToLower(key.Name))
+	key.Algorithm = dns.Fqdn(strings.ToLower(key.Algorithm))
+	if err := key.Verify(); err != nil {
+		zap.L().Error("invalid tsig key", zap.String("name", key.Name), zap.Error(err))
+		return
+	}
+	zones := make([]string, 0, len(key.Zones))
+	for _, zone := range key.Zones {
+		if zone != "*" {
+			zone = dns.Fqdn(strings.ToLower(zone))
+		}
+		zones = append(zones, zone)
+	}
+	key.Zones = zones
+	keys[key.Name] = &key
+}
+
+// Secrets returns key secrets in the format expected by dns.Server
+func (k *Keyring) Secrets() map[string]string {
+	secrets := make(map[string]string)
+	for name, key := range *k.keys.Load() {
+		secrets[name] = key.Secret
+	}
+	return secrets
+}
+
+// Key returns key with the given name
+func (k *Keyring) Key(name string) (*KeyConfig, bool) {
+	key, ok := (*k.keys.Load())[dns.Fqdn(strings.ToLower(name))]
+	return key, ok
+}
+
+// Authorize checks that r is signed with a valid key which allows operation on zone, status is the tsig verification result of r
+func (k *Keyring) Authorize(r *dns.Msg, status error, zone string, operation string) error {
+	t := r.IsTsig()
+	if t == nil {
+		return ErrUnsigned
+	}
+	if status != nil {
+		return status
+	}
+	key, ok := (*k.keys.Load())[strings.ToLower(t.Hdr.Name)]
+	if !ok {
+		return dns.ErrSecret
+	}
+	if dns.Fqdn(strings.ToLower(t.Algorithm)) != key.Algorithm {
+		return dns.ErrKeyAlg
+	}
+	if !contains(key.Zones, zone) && !contains(key.Zones, "*") {
+		return ErrNotAllowed
+	}
+	if !contains(key.Operations, operation) {
+		return ErrNotAllowed
+	}
+	return nil
+}
+
+func contains(list []string, item string) bool {
+	for _, x := range list {
+		if x == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Rcode returns the response code for a request failed authorization with err
+func Rcode(err error) int {
+	if err == ErrUnsigned || err == ErrNotAllowed {
+		return dns.RcodeRefused
+	}
+	return dns.RcodeNotAuth
+}
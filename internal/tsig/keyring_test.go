@@ -0,0 +1,104 @@
+package tsig
+
+import (
+	"github.com/hawell/z42/internal/storage"
+	"github.com/hawell/z42/pkg/hiredis"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"testing"
+	"time"
+)
+
+var keyringRedisDataConfig = storage.DataHandlerConfig{
+	ZoneCacheSize:      10000,
+	ZoneCacheTimeout:   60,
+	ZoneReload:         60,
+	RecordCacheSize:    10000,
+	RecordCacheTimeout: 60,
+	MinTTL:             5,
+	MaxTTL:             300,
+	Redis: hiredis.Config{
+		Address:  "redis:6379",
+		Net:      "tcp",
+		DB:       0,
+		Password: "",
+		Prefix:   "tsig_",
+		Suffix:   "_tsig",
+		Connection: hiredis.ConnectionConfig{
+			MaxIdleConnections:   10,
+			MaxActiveConnections: 10,
+			ConnectTimeout:       500,
+			ReadTimeout:          500,
+			IdleKeepAlive:        30,
+			MaxKeepAlive:         0,
+			WaitForConnection:    true,
+		},
+	},
+}
+
+func signedMsg(key string, algorithm string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetAxfr("example.com.")
+	if key != "" {
+		m.SetTsig(key, algorithm, 300, time.Now().Unix())
+	}
+	return m
+}
+
+func TestAuthorize(t *testing.T) {
+	g := NewGomegaWithT(t)
+	k := NewKeyring(&Config{
+		Keys: []KeyConfig{
+			{Name: "Transfer", Algorithm: "hmac-sha256", Secret: "c2VjcmV0", Zones: []string{"Example.com"}, Operations: []string{OperationTransfer}},
+			{Name: "all.", Algorithm: "hmac-sha512.", Secret: "c2VjcmV0", Zones: []string{"*"}, Operations: []string{OperationTransfer, OperationUpdate, OperationNotify}},
+			{Name: "sha1.", Algorithm: "hmac-sha1.", Secret: "c2VjcmV0", Zones: []string{"*"}, Operations: []string{OperationTransfer}},
+			{Name: "invalid.", Algorithm: "hmac-sha256.", Secret: "not base64!", Zones: []string{"*"}, Operations: []string{OperationTransfer}},
+		},
+	}, nil)
+	g.Expect(k.Secrets()).To(Equal(map[string]string{"transfer.": "c2VjcmV0", "all.": "c2VjcmV0"}))
+	key, ok := k.Key("Transfer")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(key.Algorithm).To(Equal(dns.HmacSHA256))
+	_, ok = k.Key("invalid.")
+	g.Expect(ok).To(BeFalse())
+
+	g.Expect(k.Authorize(signedMsg("", ""), nil, "example.com.", OperationTransfer)).To(Equal(ErrUnsigned))
+	g.Expect(k.Authorize(signedMsg("transfer.", dns.HmacSHA256), nil, "example.com.", OperationTransfer)).To(BeNil())
+	g.Expect(k.Authorize(signedMsg("transfer.", dns.HmacSHA256), dns.ErrSig, "example.com.", OperationTransfer)).To(Equal(dns.ErrSig))
+	g.Expect(k.Authorize(signedMsg("transfer.", dns.HmacSHA512), nil, "example.com.", OperationTransfer)).To(Equal(dns.ErrKeyAlg))
+	g.Expect(k.Authorize(signedMsg("transfer.", dns.HmacSHA256), nil, "example.net.", OperationTransfer)).To(Equal(ErrNotAllowed))
+	g.Expect(k.Authorize(signedMsg("transfer.", dns.HmacSHA256), nil, "example.com.", OperationUpdate)).To(Equal(ErrNotAllowed))
+	g.Expect(k.Authorize(signedMsg("all.", dns.HmacSHA512), nil, "example.net.", OperationNotify)).To(BeNil())
+	g.Expect(k.Authorize(signedMsg("sha1.", dns.HmacSHA1), nil, "example.com.", OperationTransfer)).To(Equal(dns.ErrSecret))
+
+	g.Expect(Rcode(ErrUnsigned)).To(Equal(dns.RcodeRefused))
+	g.Expect(Rcode(ErrNotAllowed)).To(Equal(dns.RcodeRefused))
+	g.Expect(Rcode(dns.ErrSig)).To(Equal(dns.RcodeNotAuth))
+}
+
+func TestRedisKeys(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dh := storage.NewDataHandler(&keyringRedisDataConfig)
+	defer dh.ShutDown()
+	g.Expect(dh.Clear()).To(BeNil())
+	g.Expect(dh.SetTsigKeyFromJson("key1.", `{"algorithm":"hmac-sha256","secret":"cmVkaXM=","zones":["example.com."],"operations":["update"]}`)).To(BeNil())
+	g.Expect(dh.SetTsigKeyFromJson("key2.", `invalid json`)).To(BeNil())
+
+	k := NewKeyring(&Config{
+		Keys: []KeyConfig{
+			{Name: "key1.", Algorithm: "hmac-sha256", Secret: "Y29uZmln", Zones: []string{"example.com."}, Operations: []string{OperationTransfer}},
+		},
+	}, dh)
+	g.Expect(k.Secrets()).To(Equal(map[string]string{"key1.": "cmVkaXM="}))
+	g.Expect(k.Authorize(signedMsg("key1.", dns.HmacSHA256), nil, "example.com.", OperationUpdate)).To(BeNil())
+	g.Expect(k.Authorize(signedMsg("key1.", dns.HmacSHA256), nil, "example.com.", OperationTransfer)).To(Equal(ErrNotAllowed))
+
+	// revoked and added keys take effect on reload
+	g.Expect(dh.DeleteTsigKey("key1.")).To(BeNil())
+	g.Expect(dh.SetTsigKeyFromJson("key3.", `{"algorithm":"hmac-sha256","secret":"a2V5Mw==","zones":["*"],"operations":["transfer"]}`)).To(BeNil())
+	g.Expect(k.Authorize(signedMsg("key3.", dns.HmacSHA256), nil, "example.com.", OperationTransfer)).To(Equal(dns.ErrSecret))
+	k.Reload()
+	g.Expect(k.Secrets()).To(Equal(map[string]string{"key1.": "Y29uZmln", "key3.": "a2V5Mw=="}))
+	g.Expect(k.Authorize(signedMsg("key1.", dns.HmacSHA256), nil, "example.com.", OperationUpdate)).To(Equal(ErrNotAllowed))
+	g.Expect(k.Authorize(signedMsg("key3.", dns.HmacSHA256), nil, "example.com.", OperationTransfer)).To(BeNil())
+}
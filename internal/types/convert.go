@@ -0,0 +1,276 @@
+package types
+
+import (
+	"github.com/miekg/dns"
+)
+
+// TransferTypes is the list of rrset types sent to secondaries in zone transfers
+var TransferTypes = []uint16{
+	dns.TypeA,
+	dns.TypeAAAA,
+	dns.TypeCNAME,
+	dns.TypeTXT,
+	dns.TypeNS,
+	dns.TypeMX,
+	dns.TypeSRV,
+	dns.TypeCAA,
+	dns.TypePTR,
+	dns.TypeTLSA,
+	dns.TypeDS,
+	dns.TypeSSHFP,
+	dns.TypeNAPTR,
+	dns.TypeURI,
+	dns.TypeHINFO,
+	dns.TypeSMIMEA,
+	dns.TypeOPENPGPKEY,
+	dns.TypeSVCB,
+	dns.TypeHTTPS,
+	dns.TypeDNAME,
+}
+
+func NewRRSet(rtype uint16) RRSet {
+	switch rtype {
+	case dns.TypeA, dns.TypeAAAA:
+		return &IP_RRSet{}
+	case dns.TypeCNAME:
+		return &CNAME_RRSet{}
+	case dns.TypeDNAME:
+		return &DNAME_RRSet{}
+	case dns.TypeTXT:
+		return &TXT_RRSet{}
+	case dns.TypeNS:
+		return &NS_RRSet{}
+	case dns.TypeMX:
+		return &MX_RRSet{}
+	case dns.TypeSRV:
+		return &SRV_RRSet{}
+	case dns.TypeCAA:
+		return &CAA_RRSet{}
+	case dns.TypePTR:
+		return &PTR_RRSet{}
+	case dns.TypeTLSA:
+		return &TLSA_RRSet{}
+	case dns.TypeDS:
+		return &DS_RRSet{}
+	case dns.TypeSSHFP:
+		return &SSHFP_RRSet{}
+	case dns.TypeNAPTR:
+		return &NAPTR_RRSet{}
+	case dns.TypeURI:
+		return &URI_RRSet{}
+	case dns.TypeHINFO:
+		return &HINFO_RRSet{}
+	case dns.TypeSMIMEA:
+		return &SMIMEA_RRSet{}
+	case dns.TypeOPENPGPKEY:
+		return &OPENPGPKEY_RRSet{}
+	case dns.TypeSVCB:
+		return &SVCB_RRSet{}
+	case dns.TypeHTTPS:
+		return &HTTPS_RRSet{}
+	case TypeANAME:
+		return &ANAME_RRSet{}
+	default:
+		return nil
+	}
+}
+
+// RRSetRecords returns all records of rrset without applying any filter
+func RRSetRecords(name string, rtype uint16, rrset RRSet) []dns.RR {
+	var res []dns.RR
+	if ips, ok := rrset.(*IP_RRSet); ok {
+		for _, data := range ips.Data {
+			if data.Ip == nil {
+				continue
+			}
+			hdr := dns.RR_Header{Name: name, Rrtype: rtype, Class: dns.ClassINET, Ttl: ips.TtlValue}
+			switch rtype {
+			case dns.TypeA:
+				res = append(res, &dns.A{Hdr: hdr, A: data.Ip})
+			case dns.TypeAAAA:
+				res = append(res, &dns.AAAA{Hdr: hdr, AAAA: data.Ip})
+			}
+		}
+		return res
+	}
+	for _, rr := range rrset.Value(name) {
+		rr.Header().Class = dns.ClassINET
+		res = append(res, rr)
+	}
+	return res
+}
+
+// RRSetFromRecords converts records of a single rrset to its z42 representation, it returns nil for unsupported types
+func RRSetFromRecords(rtype uint16, records []dns.RR) RRSet {
+	var ttl uint32
+	if len(records) > 0 {
+		ttl = records[0].Header().Ttl
+	}
+	generic := GenericRRSet{TtlValue: ttl}
+	switch rtype {
+	case dns.TypeA, dns.TypeAAAA:
+		rrset := &IP_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			switch r := rr.(type) {
+			case *dns.A:
+				rrset.Data = append(rrset.Data, IP_RR{Ip: r.A})
+			case *dns.AAAA:
+				rrset.Data = append(rrset.Data, IP_RR{Ip: r.AAAA})
+			}
+		}
+		return rrset
+	case dns.TypeCNAME:
+		rrset := &CNAME_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.CNAME); ok {
+				rrset.Host = r.Target
+			}
+		}
+		return rrset
+	case dns.TypeDNAME:
+		rrset := &DNAME_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.DNAME); ok {
+				rrset.Target = r.Target
+			}
+		}
+		return rrset
+	case dns.TypeTXT:
+		rrset := &TXT_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			r, ok := rr.(*dns.TXT)
+			if !ok {
+				continue
+			}
+			// boundaries of multi-string records are kept
+			if len(r.Txt) == 1 {
+				rrset.Data = append(rrset.Data, TXT_RR{Text: r.Txt[0]})
+			} else {
+				rrset.Data = append(rrset.Data, TXT_RR{Strings: r.Txt})
+			}
+		}
+		return rrset
+	case dns.TypeNS:
+		rrset := &NS_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.NS); ok {
+				rrset.Data = append(rrset.Data, NS_RR{Host: r.Ns})
+			}
+		}
+		return rrset
+	case dns.TypeMX:
+		rrset := &MX_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.MX); ok {
+				rrset.Data = append(rrset.Data, MX_RR{Host: r.Mx, Preference: r.Preference})
+			}
+		}
+		return rrset
+	case dns.TypeSRV:
+		rrset := &SRV_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.SRV); ok {
+				rrset.Data = append(rrset.Data, SRV_RR{Target: r.Target, Priority: r.Priority, Weight: r.Weight, Port: r.Port})
+			}
+		}
+		return rrset
+	case dns.TypeCAA:
+		rrset := &CAA_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.CAA); ok {
+				rrset.Data = append(rrset.Data, CAA_RR{Tag: r.Tag, Value: r.Value, Flag: r.Flag})
+			}
+		}
+		return rrset
+	case dns.TypePTR:
+		rrset := &PTR_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.PTR); ok {
+				rrset.Domain = r.Ptr
+			}
+		}
+		return rrset
+	case dns.TypeTLSA:
+		rrset := &TLSA_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.TLSA); ok {
+				rrset.Data = append(rrset.Data, TLSA_RR{Usage: r.Usage, Selector: r.Selector, MatchingType: r.MatchingType, Certificate: r.Certificate})
+			}
+		}
+		return rrset
+	case dns.TypeDS:
+		rrset := &DS_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.DS); ok {
+				rrset.Data = append(rrset.Data, DS_RR{KeyTag: r.KeyTag, Algorithm: r.Algorithm, DigestType: r.DigestType, Digest: r.Digest})
+			}
+		}
+		return rrset
+	case dns.TypeSSHFP:
+		rrset := &SSHFP_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.SSHFP); ok {
+				rrset.Data = append(rrset.Data, SSHFP_RR{Algorithm: r.Algorithm, Type: r.Type, FingerPrint: r.FingerPrint})
+			}
+		}
+		return rrset
+	case dns.TypeNAPTR:
+		rrset := &NAPTR_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.NAPTR); ok {
+				rrset.Data = append(rrset.Data, NAPTR_RR{Order: r.Order, Preference: r.Preference, Flags: r.Flags, Service: r.Service, Regexp: r.Regexp, Replacement: r.Replacement})
+			}
+		}
+		return rrset
+	case dns.TypeURI:
+		rrset := &URI_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.URI); ok {
+				rrset.Data = append(rrset.Data, URI_RR{Priority: r.Priority, Weight: r.Weight, Target: r.Target})
+			}
+		}
+		return rrset
+	case dns.TypeHINFO:
+		rrset := &HINFO_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.HINFO); ok {
+				rrset.Data = append(rrset.Data, HINFO_RR{Cpu: r.Cpu, Os: r.Os})
+			}
+		}
+		return rrset
+	case dns.TypeSMIMEA:
+		rrset := &SMIMEA_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.SMIMEA); ok {
+				rrset.Data = append(rrset.Data, SMIMEA_RR{Usage: r.Usage, Selector: r.Selector, MatchingType: r.MatchingType, Certificate: r.Certificate})
+			}
+		}
+		return rrset
+	case dns.TypeOPENPGPKEY:
+		rrset := &OPENPGPKEY_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.OPENPGPKEY); ok {
+				rrset.Data = append(rrset.Data, OPENPGPKEY_RR{PublicKey: r.PublicKey})
+			}
+		}
+		return rrset
+	case dns.TypeSVCB:
+		rrset := &SVCB_RRSet{GenericRRSet: generic}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.SVCB); ok {
+				rrset.Data = append(rrset.Data, svcbFromRecord(r))
+			}
+		}
+		return rrset
+	case dns.TypeHTTPS:
+		rrset := &HTTPS_RRSet{SVCB_RRSet{GenericRRSet: generic}}
+		for _, rr := range records {
+			if r, ok := rr.(*dns.HTTPS); ok {
+				rrset.Data = append(rrset.Data, svcbFromRecord(&r.SVCB))
+			}
+		}
+		return rrset
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"testing"
+)
+
+func TestRRSetFromRecords(t *testing.T) {
+	g := NewGomegaWithT(t)
+	records := []string{
+		"www.zone.com.	300	IN	A	1.2.3.4",
+		"www.zone.com.	300	IN	AAAA	::1",
+		"www.zone.com.	300	IN	CNAME	x.zone.com.",
+		"www.zone.com.	300	IN	TXT	\"foo\"",
+		"www.zone.com.	300	IN	TXT	\"v=DKIM1; p=\" \"MIIB\"",
+		"www.zone.com.	300	IN	NS	ns1.zone.com.",
+		"www.zone.com.	300	IN	MX	10 mx.zone.com.",
+		"www.zone.com.	300	IN	SRV	10 20 80 srv.zone.com.",
+		"www.zone.com.	300	IN	CAA	0 issue \"godaddy.com;\"",
+		"www.zone.com.	300	IN	PTR	ptr.zone.com.",
+		"www.zone.com.	300	IN	TLSA	1 1 1 1234",
+		"www.zone.com.	300	IN	DS	123 8 2 1234",
+		"www.zone.com.	300	IN	SSHFP	1 2 1234",
+		"www.zone.com.	300	IN	NAPTR	100 10 \"S\" \"SIP+D2U\" \"\" _sip._udp.zone.com.",
+		"www.zone.com.	300	IN	URI	10 1 \"ftp://ftp1.zone.com/public\"",
+		"www.zone.com.	300	IN	HINFO	\"cpu\" \"os\"",
+		"www.zone.com.	300	IN	SMIMEA	3 1 1 1234",
+		"www.zone.com.	300	IN	OPENPGPKEY	AQID",
+		"www.zone.com.	300	IN	SVCB	0 svc.zone.com.",
+		"www.zone.com.	300	IN	HTTPS	1 . alpn=\"h2,h3\" port=\"8443\" ipv4hint=\"1.2.3.4\" ech=\"AQID\" ipv6hint=\"2001:db8::1\"",
+		"www.zone.com.	300	IN	DNAME	zone.net.",
+	}
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		g.Expect(err).To(BeNil())
+		rrset := RRSetFromRecords(rr.Header().Rrtype, []dns.RR{rr})
+		g.Expect(rrset).NotTo(BeNil())
+		res := RRSetRecords("www.zone.com.", rr.Header().Rrtype, rrset)
+		g.Expect(len(res)).To(Equal(1))
+		g.Expect(res[0].String()).To(Equal(record))
+	}
+	rr, _ := dns.NewRR("www.zone.com. 300 IN RP mbox.zone.com. txt.zone.com.")
+	g.Expect(RRSetFromRecords(dns.TypeRP, []dns.RR{rr})).To(BeNil())
+}
@@ -2,8 +2,10 @@ package types
 
 import (
 	"crypto"
+	"encoding/base64"
 	"github.com/miekg/dns"
 	"net"
+	"strings"
 )
 
 const (
@@ -37,6 +39,28 @@ type ZoneKey struct {
 	KeyExpiration uint32
 }
 
+const (
+	KeyStatePublished = "published"
+	KeyStateActive    = "active"
+	KeyStateRetired   = "retired"
+	KeyStateRemoved   = "removed"
+)
+
+// ZoneKeyInfo is a zone signing key with its lifecycle state, timestamps are unix seconds
+type ZoneKeyInfo struct {
+	Type      string `json:"type"`
+	State     string `json:"state"`
+	Public    string `json:"public"`
+	Private   string `json:"private"`
+	Created   int64  `json:"created"`
+	Published int64  `json:"published,omitempty"`
+	Activated int64  `json:"activated,omitempty"`
+	Retired   int64  `json:"retired,omitempty"`
+	Removed   int64  `json:"removed,omitempty"`
+	// DSConfirmed is set when operator confirms DS records of a published ksk are added to parent
+	DSConfirmed int64 `json:"ds_confirmed,omitempty"`
+}
+
 type IP_RR struct {
 	Weight  int      `json:"weight,omitempty"`
 	Ip      net.IP   `json:"ip"`
@@ -95,8 +119,46 @@ func (rrset *CNAME_RRSet) Empty() bool {
 	return len(rrset.Host) == 0
 }
 
+type DNAME_RRSet struct {
+	GenericRRSet
+	Target string `json:"target"`
+}
+
+func (rrset *DNAME_RRSet) Value(name string) []dns.RR {
+	if len(rrset.Target) == 0 {
+		return []dns.RR{}
+	}
+	r := new(dns.DNAME)
+	r.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeDNAME,
+		Class: dns.ClassINET, Ttl: rrset.TtlValue}
+	r.Target = dns.Fqdn(rrset.Target)
+	return []dns.RR{r}
+}
+
+func (rrset *DNAME_RRSet) Empty() bool {
+	return len(rrset.Target) == 0
+}
+
+// Synthesize returns the cname replacing owner suffix of qname with dname target (rfc6672 section 2.2), ok is false if result is not a valid domain name
+func (rrset *DNAME_RRSet) Synthesize(qname string, owner string) (*dns.CNAME, bool) {
+	prefix := strings.TrimSuffix(qname, owner)
+	target := prefix + dns.Fqdn(rrset.Target)
+	if rrset.Target == "." {
+		target = prefix
+	}
+	if _, ok := dns.IsDomainName(target); !ok {
+		return nil, false
+	}
+	return &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: qname, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: rrset.TtlValue},
+		Target: target,
+	}, true
+}
+
+// TXT_RR holds a single text which is split into 255 byte strings, or strings of a record with its string boundaries kept
 type TXT_RR struct {
-	Text string `json:"text"`
+	Text    string   `json:"text"`
+	Strings []string `json:"strings,omitempty"`
 }
 
 type TXT_RRSet struct {
@@ -107,13 +169,17 @@ type TXT_RRSet struct {
 func (rrset *TXT_RRSet) Value(name string) []dns.RR {
 	var res []dns.RR
 	for _, txt := range rrset.Data {
-		if len(txt.Text) == 0 {
+		if len(txt.Text) == 0 && len(txt.Strings) == 0 {
 			continue
 		}
 		r := new(dns.TXT)
 		r.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeTXT,
 			Class: dns.ClassINET, Ttl: rrset.TtlValue}
-		r.Txt = split255(txt.Text)
+		if len(txt.Strings) > 0 {
+			r.Txt = txt.Strings
+		} else {
+			r.Txt = split255(txt.Text)
+		}
 		res = append(res, r)
 	}
 	return res
@@ -326,6 +392,290 @@ func (rrset *DS_RRSet) Empty() bool {
 	return len(rrset.Data) == 0
 }
 
+type SSHFP_RR struct {
+	Algorithm   uint8  `json:"algorithm"`
+	Type        uint8  `json:"type"`
+	FingerPrint string `json:"fingerprint"`
+}
+
+type SSHFP_RRSet struct {
+	GenericRRSet
+	Data []SSHFP_RR `json:"records,omitempty"`
+}
+
+func (rrset *SSHFP_RRSet) Value(name string) []dns.RR {
+	var res []dns.RR
+	for _, sshfp := range rrset.Data {
+		if len(sshfp.FingerPrint) == 0 {
+			continue
+		}
+		r := new(dns.SSHFP)
+		r.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeSSHFP,
+			Class: dns.ClassINET, Ttl: rrset.TtlValue}
+		r.Algorithm = sshfp.Algorithm
+		r.Type = sshfp.Type
+		r.FingerPrint = sshfp.FingerPrint
+		res = append(res, r)
+	}
+	return res
+}
+
+func (rrset *SSHFP_RRSet) Empty() bool {
+	return len(rrset.Data) == 0
+}
+
+type NAPTR_RR struct {
+	Order       uint16 `json:"order"`
+	Preference  uint16 `json:"preference"`
+	Flags       string `json:"flags"`
+	Service     string `json:"service"`
+	Regexp      string `json:"regexp"`
+	Replacement string `json:"replacement"`
+}
+
+type NAPTR_RRSet struct {
+	GenericRRSet
+	Data []NAPTR_RR `json:"records,omitempty"`
+}
+
+func (rrset *NAPTR_RRSet) Value(name string) []dns.RR {
+	var res []dns.RR
+	for _, naptr := range rrset.Data {
+		r := new(dns.NAPTR)
+		r.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeNAPTR,
+			Class: dns.ClassINET, Ttl: rrset.TtlValue}
+		r.Order = naptr.Order
+		r.Preference = naptr.Preference
+		r.Flags = naptr.Flags
+		r.Service = naptr.Service
+		r.Regexp = naptr.Regexp
+		r.Replacement = dns.Fqdn(naptr.Replacement)
+		res = append(res, r)
+	}
+	return res
+}
+
+func (rrset *NAPTR_RRSet) Empty() bool {
+	return len(rrset.Data) == 0
+}
+
+type URI_RR struct {
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+	Target   string `json:"target"`
+}
+
+type URI_RRSet struct {
+	GenericRRSet
+	Data []URI_RR `json:"records,omitempty"`
+}
+
+func (rrset *URI_RRSet) Value(name string) []dns.RR {
+	var res []dns.RR
+	for _, uri := range rrset.Data {
+		if len(uri.Target) == 0 {
+			continue
+		}
+		r := new(dns.URI)
+		r.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeURI,
+			Class: dns.ClassINET, Ttl: rrset.TtlValue}
+		r.Priority = uri.Priority
+		r.Weight = uri.Weight
+		r.Target = uri.Target
+		res = append(res, r)
+	}
+	return res
+}
+
+func (rrset *URI_RRSet) Empty() bool {
+	return len(rrset.Data) == 0
+}
+
+type HINFO_RR struct {
+	Cpu string `json:"cpu"`
+	Os  string `json:"os"`
+}
+
+type HINFO_RRSet struct {
+	GenericRRSet
+	Data []HINFO_RR `json:"records,omitempty"`
+}
+
+func (rrset *HINFO_RRSet) Value(name string) []dns.RR {
+	var res []dns.RR
+	for _, hinfo := range rrset.Data {
+		r := new(dns.HINFO)
+		r.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeHINFO,
+			Class: dns.ClassINET, Ttl: rrset.TtlValue}
+		r.Cpu = hinfo.Cpu
+		r.Os = hinfo.Os
+		res = append(res, r)
+	}
+	return res
+}
+
+func (rrset *HINFO_RRSet) Empty() bool {
+	return len(rrset.Data) == 0
+}
+
+type SMIMEA_RR struct {
+	Usage        uint8  `json:"usage"`
+	Selector     uint8  `json:"selector"`
+	MatchingType uint8  `json:"matching_type"`
+	Certificate  string `json:"certificate"`
+}
+
+type SMIMEA_RRSet struct {
+	GenericRRSet
+	Data []SMIMEA_RR `json:"records,omitempty"`
+}
+
+func (rrset *SMIMEA_RRSet) Value(name string) []dns.RR {
+	var res []dns.RR
+	for _, smimea := range rrset.Data {
+		r := new(dns.SMIMEA)
+		r.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeSMIMEA,
+			Class: dns.ClassINET, Ttl: rrset.TtlValue}
+		r.Usage = smimea.Usage
+		r.Selector = smimea.Selector
+		r.MatchingType = smimea.MatchingType
+		r.Certificate = smimea.Certificate
+		res = append(res, r)
+	}
+	return res
+}
+
+func (rrset *SMIMEA_RRSet) Empty() bool {
+	return len(rrset.Data) == 0
+}
+
+type OPENPGPKEY_RR struct {
+	PublicKey string `json:"public_key"`
+}
+
+type OPENPGPKEY_RRSet struct {
+	GenericRRSet
+	Data []OPENPGPKEY_RR `json:"records,omitempty"`
+}
+
+func (rrset *OPENPGPKEY_RRSet) Value(name string) []dns.RR {
+	var res []dns.RR
+	for _, key := range rrset.Data {
+		if len(key.PublicKey) == 0 {
+			continue
+		}
+		r := new(dns.OPENPGPKEY)
+		r.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeOPENPGPKEY,
+			Class: dns.ClassINET, Ttl: rrset.TtlValue}
+		r.PublicKey = key.PublicKey
+		res = append(res, r)
+	}
+	return res
+}
+
+func (rrset *OPENPGPKEY_RRSet) Empty() bool {
+	return len(rrset.Data) == 0
+}
+
+type SVCB_RR struct {
+	Priority uint16   `json:"priority"`
+	Target   string   `json:"target"`
+	Alpn     []string `json:"alpn,omitempty"`
+	Port     uint16   `json:"port,omitempty"`
+	Ipv4Hint []net.IP `json:"ipv4hint,omitempty"`
+	Ipv6Hint []net.IP `json:"ipv6hint,omitempty"`
+	ECH      string   `json:"ech,omitempty"`
+}
+
+// record returns rr as an svcb record of rtype ordered by param key, params are ignored in alias mode (priority 0)
+func (rr *SVCB_RR) record(name string, rtype uint16, ttl uint32) dns.SVCB {
+	r := dns.SVCB{
+		Hdr: dns.RR_Header{Name: name, Rrtype: rtype,
+			Class: dns.ClassINET, Ttl: ttl},
+		Priority: rr.Priority,
+		Target:   dns.Fqdn(rr.Target),
+	}
+	if rr.Priority == 0 {
+		return r
+	}
+	if len(rr.Alpn) > 0 {
+		r.Value = append(r.Value, &dns.SVCBAlpn{Alpn: rr.Alpn})
+	}
+	if rr.Port != 0 {
+		r.Value = append(r.Value, &dns.SVCBPort{Port: rr.Port})
+	}
+	var v4, v6 []net.IP
+	for _, ip := range rr.Ipv4Hint {
+		if ip4 := ip.To4(); ip4 != nil {
+			v4 = append(v4, ip4)
+		}
+	}
+	for _, ip := range rr.Ipv6Hint {
+		if ip.To4() == nil && len(ip) == net.IPv6len {
+			v6 = append(v6, ip)
+		}
+	}
+	if len(v4) > 0 {
+		r.Value = append(r.Value, &dns.SVCBIPv4Hint{Hint: v4})
+	}
+	if ech, err := base64.StdEncoding.DecodeString(rr.ECH); err == nil && len(ech) > 0 {
+		r.Value = append(r.Value, &dns.SVCBECHConfig{ECH: ech})
+	}
+	if len(v6) > 0 {
+		r.Value = append(r.Value, &dns.SVCBIPv6Hint{Hint: v6})
+	}
+	return r
+}
+
+func svcbFromRecord(r *dns.SVCB) SVCB_RR {
+	rr := SVCB_RR{Priority: r.Priority, Target: r.Target}
+	for _, kv := range r.Value {
+		switch v := kv.(type) {
+		case *dns.SVCBAlpn:
+			rr.Alpn = v.Alpn
+		case *dns.SVCBPort:
+			rr.Port = v.Port
+		case *dns.SVCBIPv4Hint:
+			rr.Ipv4Hint = v.Hint
+		case *dns.SVCBIPv6Hint:
+			rr.Ipv6Hint = v.Hint
+		case *dns.SVCBECHConfig:
+			rr.ECH = base64.StdEncoding.EncodeToString(v.ECH)
+		}
+	}
+	return rr
+}
+
+type SVCB_RRSet struct {
+	GenericRRSet
+	Data []SVCB_RR `json:"records,omitempty"`
+}
+
+func (rrset *SVCB_RRSet) Value(name string) []dns.RR {
+	var res []dns.RR
+	for i := range rrset.Data {
+		r := rrset.Data[i].record(name, dns.TypeSVCB, rrset.TtlValue)
+		res = append(res, &r)
+	}
+	return res
+}
+
+func (rrset *SVCB_RRSet) Empty() bool {
+	return len(rrset.Data) == 0
+}
+
+type HTTPS_RRSet struct {
+	SVCB_RRSet
+}
+
+func (rrset *HTTPS_RRSet) Value(name string) []dns.RR {
+	var res []dns.RR
+	for i := range rrset.Data {
+		res = append(res, &dns.HTTPS{SVCB: rrset.Data[i].record(name, dns.TypeHTTPS, rrset.TtlValue)})
+	}
+	return res
+}
+
 type SOA_RRSet struct {
 	Ns      string   `json:"ns"`
 	MBox    string   `json:"MBox"`
@@ -2,6 +2,7 @@ package types
 
 import (
 	"bytes"
+	"encoding/hex"
 	iradix "github.com/hashicorp/go-immutable-radix"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/miekg/dns"
@@ -17,21 +18,36 @@ type Zone struct {
 	LocationsList []string
 	ZSK           *ZoneKey
 	KSK           *ZoneKey
-	DnsKeySig     dns.RR
+	KSKs          []*ZoneKey
+	DnsKeys       []dns.RR
+	DnsKeySigs    []dns.RR
 	CacheTimeout  int64
 }
 
 type ZoneConfig struct {
-	DomainId        string     `json:"domain_id,omitempty"`
-	SOA             *SOA_RRSet `json:"soa,omitempty"`
-	DnsSec          bool       `json:"dnssec,omitempty"`
-	CnameFlattening bool       `json:"cname_flattening,omitempty"`
+	DomainId        string       `json:"domain_id,omitempty"`
+	SOA             *SOA_RRSet   `json:"soa,omitempty"`
+	DnsSec          bool         `json:"dnssec,omitempty"`
+	CdsDelete       bool         `json:"cds_delete,omitempty"`
+	CnameFlattening bool         `json:"cname_flattening,omitempty"`
+	AllowTransfer   []string     `json:"allow_transfer,omitempty"`
+	Notify          []string     `json:"notify,omitempty"`
+	Primaries       []string     `json:"primaries,omitempty"`
+	Nsec3           *Nsec3Config `json:"nsec3,omitempty"`
+	Ecs             bool         `json:"ecs"`
+}
+
+type Nsec3Config struct {
+	Iterations uint16 `json:"iterations"`
+	Salt       string `json:"salt,omitempty"`
+	OptOut     bool   `json:"opt_out,omitempty"`
 }
 
 func ZoneConfigFromJson(zone string, configStr string) *ZoneConfig {
 	config := &ZoneConfig{
 		DnsSec:          false,
 		CnameFlattening: false,
+		Ecs:             true,
 		SOA: &SOA_RRSet{
 			Ns:      "ns1." + zone,
 			MinTtl:  300,
@@ -50,6 +66,14 @@ func ZoneConfigFromJson(zone string, configStr string) *ZoneConfig {
 		}
 	}
 	config.SOA.Ns = dns.Fqdn(config.SOA.Ns)
+	if config.Nsec3 != nil {
+		if salt, err := hex.DecodeString(config.Nsec3.Salt); err != nil || len(salt) > 255 {
+			zap.L().Error("invalid nsec3 salt, falling back to nsec", zap.String("zone", zone), zap.String("salt", config.Nsec3.Salt))
+			config.Nsec3 = nil
+		} else {
+			config.Nsec3.Salt = strings.ToUpper(config.Nsec3.Salt)
+		}
+	}
 	config.SOA.Data = &dns.SOA{
 		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: config.SOA.Ttl, Rdlength: 0},
 		Ns:      config.SOA.Ns,
@@ -107,6 +131,8 @@ const (
 	NoMatch
 )
 
+// FindLocation returns location matching query and type of match, for CEMatch location is the closest existing ancestor of query where delegations are looked up
+// NoMatch means zone apex is the only existing ancestor, dnames at ancestors are found with Ancestors
 func (z *Zone) FindLocation(query string) (string, int) {
 	// request for zone records
 	if query == z.Name {
@@ -154,3 +180,36 @@ func (z *Zone) FindLocation(query string) (string, int) {
 		}
 	}
 }
+
+// Ancestors returns existing locations above query from zone apex ("@") down to closest encloser, where dnames occluding query are looked up
+func (z *Zone) Ancestors(query string) []string {
+	if query == z.Name || !strings.HasSuffix(query, "."+z.Name) {
+		return nil
+	}
+	labels := dns.SplitDomainName(strings.TrimSuffix(query, "."+z.Name))
+	ancestors := []string{"@"}
+	for i := len(labels) - 1; i > 0; i-- {
+		location := strings.Join(labels[i:], ".")
+		if value, ok := z.LocationsTree.Get(ReverseName(location)); ok && value != nil {
+			ancestors = append(ancestors, location)
+		}
+	}
+	return ancestors
+}
+
+// ClosestEncloser returns the longest existing ancestor of query including empty non-terminals, query itself if it exists
+func (z *Zone) ClosestEncloser(query string) string {
+	if query == z.Name || !strings.HasSuffix(query, "."+z.Name) {
+		return z.Name
+	}
+	query = strings.TrimSuffix(query, "."+z.Name)
+	k, _, ok := z.LocationsTree.Root().LongestPrefix(ReverseName(query))
+	if !ok {
+		return z.Name
+	}
+	runes := []rune(string(k))
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return strings.TrimPrefix(string(runes), ".") + "." + z.Name
+}
@@ -77,3 +77,51 @@ func TestZone_FindLocation(t *testing.T) {
 	g.Expect(label).To(Equal(""))
 	g.Expect(matchType).To(Equal(NoMatch))
 }
+
+func TestZone_Ancestors(t *testing.T) {
+	g := NewGomegaWithT(t)
+	zone := NewZone(
+		"zone.com.",
+		[]string{
+			"a.b.c",
+			"c",
+			"x",
+			"*.w",
+		},
+		"",
+	)
+
+	g.Expect(zone.Ancestors("zone.com.")).To(BeEmpty())
+	g.Expect(zone.Ancestors("x.zone.com.")).To(Equal([]string{"@"}))
+	g.Expect(zone.Ancestors("y.x.zone.com.")).To(Equal([]string{"@", "x"}))
+	g.Expect(zone.Ancestors("z.a.b.c.zone.com.")).To(Equal([]string{"@", "c", "a.b.c"}))
+	g.Expect(zone.Ancestors("a.b.c.zone.com.")).To(Equal([]string{"@", "c"}))
+	g.Expect(zone.Ancestors("v.w.zone.com.")).To(Equal([]string{"@"}))
+	g.Expect(zone.Ancestors("u.v.w.zone.com.")).To(Equal([]string{"@"}))
+}
+
+func TestZone_ClosestEncloser(t *testing.T) {
+	g := NewGomegaWithT(t)
+	zone := NewZone(
+		"zone.com.",
+		[]string{
+			"a.b.c",
+			"x",
+			"*.w",
+		},
+		`{"nsec3":{"iterations":1, "salt":"ab12"}}`,
+	)
+	g.Expect(zone.Config.Nsec3).To(Equal(&Nsec3Config{Iterations: 1, Salt: "AB12"}))
+
+	g.Expect(zone.ClosestEncloser("zone.com.")).To(Equal("zone.com."))
+	g.Expect(zone.ClosestEncloser("y.zone.com.")).To(Equal("zone.com."))
+	g.Expect(zone.ClosestEncloser("x.zone.com.")).To(Equal("x.zone.com."))
+	g.Expect(zone.ClosestEncloser("y.x.zone.com.")).To(Equal("x.zone.com."))
+	g.Expect(zone.ClosestEncloser("y.xx.zone.com.")).To(Equal("zone.com."))
+	g.Expect(zone.ClosestEncloser("z.y.b.c.zone.com.")).To(Equal("b.c.zone.com."))
+	g.Expect(zone.ClosestEncloser("a.b.c.zone.com.")).To(Equal("a.b.c.zone.com."))
+	g.Expect(zone.ClosestEncloser("v.w.zone.com.")).To(Equal("w.zone.com."))
+
+	zone = NewZone("zone.com.", []string{}, `{"nsec3":{"iterations":1, "salt":"xyz"}}`)
+	g.Expect(zone.Config.Nsec3).To(BeNil())
+}
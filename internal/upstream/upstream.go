@@ -2,6 +2,7 @@ package upstream
 
 import (
 	"errors"
+	"github.com/hawell/z42/internal/metrics"
 	"go.uber.org/zap"
 	"golang.org/x/sync/singleflight"
 	"strconv"
@@ -65,8 +66,9 @@ func (u *Upstream) Query(location string, qtype uint16) ([]dns.RR, int) {
 		m := new(dns.Msg)
 		m.SetQuestion(location, qtype)
 		for _, c := range u.connections {
-			r, _, err := c.client.Exchange(m, c.connectionStr)
+			r, rtt, err := c.client.Exchange(m, c.connectionStr)
 			if err != nil {
+				metrics.UpstreamFailures.WithLabelValues(c.connectionStr).Inc()
 				zap.L().Error(
 					"failed to retrieve record from upstream",
 					zap.String("location", location),
@@ -75,6 +77,7 @@ func (u *Upstream) Query(location string, qtype uint16) ([]dns.RR, int) {
 				)
 				continue
 			}
+			metrics.UpstreamDuration.WithLabelValues(c.connectionStr).Observe(rtt.Seconds())
 			if r.Rcode != dns.RcodeSuccess {
 				zap.L().Error("upstream error response", zap.String("rcode", dns.RcodeToString[r.Rcode]), zap.String("location", location))
 				return r, nil
@@ -11,8 +11,9 @@ import (
 )
 
 type Redis struct {
-	config *Config
-	pool   *redisCon.Pool
+	config  *Config
+	pool    *redisCon.Pool
+	onError func(err error)
 }
 
 type ConnectionConfig struct {
@@ -56,7 +57,12 @@ func NewRedis(config *Config) *Redis {
 			}
 			opts = append(opts, redisCon.DialDatabase(r.config.DB))
 
-			return redisCon.Dial(r.config.Net, r.config.Address, opts...)
+			c, err := redisCon.Dial(r.config.Net, r.config.Address, opts...)
+			if err != nil {
+				r.error(err)
+				return nil, err
+			}
+			return &conn{Conn: c, redis: r}, nil
 		},
 		TestOnBorrow: func(c redisCon.Conn, t time.Time) error {
 			_, err := c.Do("PING")
@@ -72,6 +78,43 @@ func NewRedis(config *Config) *Redis {
 	return r
 }
 
+// OnError sets a function called on every failed command or connection attempt, it should be set before redis is used
+func (redis *Redis) OnError(handler func(err error)) {
+	redis.onError = handler
+}
+
+func (redis *Redis) error(err error) {
+	if redis.onError != nil {
+		redis.onError(err)
+	}
+}
+
+// conn reports errors of commands to redis error handler, timeout methods are forwarded for pubsub connections
+type conn struct {
+	redisCon.Conn
+	redis *Redis
+}
+
+func (c *conn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(commandName, args...)
+	if err != nil {
+		c.redis.error(err)
+	}
+	return reply, err
+}
+
+func (c *conn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := redisCon.DoWithTimeout(c.Conn, timeout, commandName, args...)
+	if err != nil {
+		c.redis.error(err)
+	}
+	return reply, err
+}
+
+func (c *conn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redisCon.ReceiveWithTimeout(c.Conn, timeout)
+}
+
 func (redis *Redis) GetConfig(config string) (string, error) {
 	var (
 		err   error
@@ -309,6 +352,17 @@ func (redis *Redis) HSet(key string, hkey string, value string) error {
 	return nil
 }
 
+func (redis *Redis) HDel(key string, hkey string) error {
+	conn := redis.pool.Get()
+	if conn == nil {
+		return noConnectionError
+	}
+	defer conn.Close()
+
+	_, err := conn.Do("HDEL", redis.config.Prefix+key+redis.config.Suffix, hkey)
+	return err
+}
+
 func (redis *Redis) SAdd(set string, member string) error {
 	conn := redis.pool.Get()
 	if conn == nil {
@@ -599,3 +653,179 @@ func (redis *Redis) XRead(streamID string, lastID string) ([]StreamItem, error)
 	}
 	return res, nil
 }
+
+func (redis *Redis) XRange(stream string, start string, end string) ([]StreamItem, error) {
+	conn := redis.pool.Get()
+	if conn == nil {
+		return nil, noConnectionError
+	}
+	defer conn.Close()
+
+	if start == "" {
+		start = "-"
+	}
+	if end == "" {
+		end = "+"
+	}
+	reply, err := conn.Do("XRANGE", redis.config.Prefix+stream+redis.config.Suffix, start, end)
+	if err != nil {
+		return nil, err
+	}
+	values, err := redisCon.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	var res []StreamItem
+	for _, value := range values {
+		item, err := redisCon.Values(value, nil)
+		if err != nil {
+			return nil, err
+		}
+		id, err := redisCon.String(item[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		kv, err := redisCon.Strings(item[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, StreamItem{id, kv[0], kv[1]})
+	}
+	return res, nil
+}
+
+func (redis *Redis) XTrim(stream string, maxLen int) error {
+	conn := redis.pool.Get()
+	if conn == nil {
+		return noConnectionError
+	}
+	defer conn.Close()
+
+	_, err := conn.Do("XTRIM", redis.config.Prefix+stream+redis.config.Suffix, "MAXLEN", maxLen)
+	return err
+}
+
+func (redis *Redis) SetNX(key string, value string) (bool, error) {
+	conn := redis.pool.Get()
+	if conn == nil {
+		return false, noConnectionError
+	}
+	defer conn.Close()
+
+	reply, err := conn.Do("SETNX", redis.config.Prefix+key+redis.config.Suffix, value)
+	if err != nil {
+		return false, err
+	}
+	return redisCon.Bool(reply, nil)
+}
+
+func (redis *Redis) Incr(key string) (int64, error) {
+	conn := redis.pool.Get()
+	if conn == nil {
+		return 0, noConnectionError
+	}
+	defer conn.Close()
+
+	reply, err := conn.Do("INCR", redis.config.Prefix+key+redis.config.Suffix)
+	if err != nil {
+		return 0, err
+	}
+	return redisCon.Int64(reply, nil)
+}
+
+func (redis *Redis) DelKey(key string) error {
+	conn := redis.pool.Get()
+	if conn == nil {
+		return noConnectionError
+	}
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", redis.config.Prefix+key+redis.config.Suffix)
+	return err
+}
+
+type Command struct {
+	Name string
+	Key  string
+	Args []interface{}
+}
+
+// Exec runs commands atomically in a MULTI/EXEC transaction
+func (redis *Redis) Exec(commands []Command) error {
+	conn := redis.pool.Get()
+	if conn == nil {
+		return noConnectionError
+	}
+	defer conn.Close()
+
+	return redis.exec(conn, commands)
+}
+
+// ErrTransactionAborted is returned by Transaction if a key read by transaction has been modified before commit
+var ErrTransactionAborted = errors.New("transaction aborted")
+
+// Transaction runs commands returned by fn in a MULTI/EXEC transaction, keys read with get are watched
+// and transaction is aborted with ErrTransactionAborted if any of them is modified before commit.
+// get returns values of keys in a single round trip, missing keys have empty values
+func (redis *Redis) Transaction(fn func(get func(keys ...string) ([]string, error)) ([]Command, error)) error {
+	conn := redis.pool.Get()
+	if conn == nil {
+		return noConnectionError
+	}
+	defer conn.Close()
+
+	get := func(keys ...string) ([]string, error) {
+		if len(keys) == 0 {
+			return nil, nil
+		}
+		args := make([]interface{}, 0, len(keys))
+		for _, key := range keys {
+			args = append(args, redis.config.Prefix+key+redis.config.Suffix)
+		}
+		if err := conn.Send("WATCH", args...); err != nil {
+			return nil, err
+		}
+		if err := conn.Send("MGET", args...); err != nil {
+			return nil, err
+		}
+		if err := conn.Flush(); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Receive(); err != nil {
+			return nil, err
+		}
+		return redisCon.Strings(conn.Receive())
+	}
+	commands, err := fn(get)
+	if err != nil || len(commands) == 0 {
+		_, _ = conn.Do("UNWATCH")
+		return err
+	}
+	return redis.exec(conn, commands)
+}
+
+func (redis *Redis) exec(conn redisCon.Conn, commands []Command) error {
+	if err := conn.Send("MULTI"); err != nil {
+		return err
+	}
+	for _, command := range commands {
+		args := append([]interface{}{redis.config.Prefix + command.Key + redis.config.Suffix}, command.Args...)
+		if err := conn.Send(command.Name, args...); err != nil {
+			_, _ = conn.Do("DISCARD")
+			return err
+		}
+	}
+	replies, err := redisCon.Values(conn.Do("EXEC"))
+	if err == redisCon.ErrNil {
+		return ErrTransactionAborted
+	}
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if err, ok := reply.(redisCon.Error); ok {
+			return err
+		}
+	}
+	return nil
+}
@@ -47,6 +47,11 @@ func TestRedis(t *testing.T) {
 	v, err = r.HGet("2", "key2")
 	g.Expect(err).To(BeNil())
 	g.Expect(v).To(Equal("value2"))
+	err = r.HDel("2", "key2")
+	g.Expect(err).To(BeNil())
+	hkeys, err = r.GetHKeys("2")
+	g.Expect(err).To(BeNil())
+	g.Expect(hkeys).To(Equal([]string{"key1"}))
 
 	l, err := r.GetKeys("*")
 	g.Expect(err).To(BeNil())
@@ -297,3 +302,134 @@ func TestStream(t *testing.T) {
 		g.Expect(res[i].Value).To(Equal(item.Value))
 	}
 }
+
+func TestStreamRange(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cfg := Config{
+		Suffix:  "_redistest",
+		Prefix:  "redistest_",
+		Address: "redis:6379",
+		Net:     "tcp",
+		DB:      0,
+	}
+	r := NewRedis(&cfg)
+	err := r.Del("*")
+	g.Expect(err).To(BeNil())
+
+	streamName := "stream2"
+	for i := 0; i < 10; i++ {
+		_, err := r.XAdd(streamName, StreamItem{Key: "key", Value: fmt.Sprint(i)})
+		g.Expect(err).To(BeNil())
+	}
+	res, err := r.XRange(streamName, "", "")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(res)).To(Equal(10))
+	g.Expect(res[0].Value).To(Equal("0"))
+
+	err = r.XTrim(streamName, 5)
+	g.Expect(err).To(BeNil())
+	res, err = r.XRange(streamName, "", "")
+	g.Expect(err).To(BeNil())
+	g.Expect(len(res)).To(Equal(5))
+	g.Expect(res[0].Value).To(Equal("5"))
+}
+
+func TestCounter(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cfg := Config{
+		Suffix:  "_redistest",
+		Prefix:  "redistest_",
+		Address: "redis:6379",
+		Net:     "tcp",
+		DB:      0,
+	}
+	r := NewRedis(&cfg)
+	err := r.Del("*")
+	g.Expect(err).To(BeNil())
+
+	ok, err := r.SetNX("counter", "10")
+	g.Expect(err).To(BeNil())
+	g.Expect(ok).To(BeTrue())
+	ok, err = r.SetNX("counter", "20")
+	g.Expect(err).To(BeNil())
+	g.Expect(ok).To(BeFalse())
+	v, err := r.Incr("counter")
+	g.Expect(err).To(BeNil())
+	g.Expect(v).To(Equal(int64(11)))
+}
+
+func TestExec(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cfg := Config{
+		Suffix:  "_redistest",
+		Prefix:  "redistest_",
+		Address: "redis:6379",
+		Net:     "tcp",
+		DB:      0,
+	}
+	r := NewRedis(&cfg)
+	err := r.Del("*")
+	g.Expect(err).To(BeNil())
+
+	err = r.Set("key2", "value2")
+	g.Expect(err).To(BeNil())
+	err = r.Exec([]Command{
+		{Name: "SET", Key: "key1", Args: []interface{}{"value1"}},
+		{Name: "DEL", Key: "key2"},
+		{Name: "SADD", Key: "set1", Args: []interface{}{"member1"}},
+	})
+	g.Expect(err).To(BeNil())
+	v, err := r.Get("key1")
+	g.Expect(err).To(BeNil())
+	g.Expect(v).To(Equal("value1"))
+	_, err = r.Get("key2")
+	g.Expect(err).To(Equal(redis.ErrNil))
+	ok, err := r.SIsMember("set1", "member1")
+	g.Expect(err).To(BeNil())
+	g.Expect(ok).To(BeTrue())
+
+	err = r.Exec([]Command{
+		{Name: "SET", Key: "key1", Args: []interface{}{"value3"}},
+		{Name: "INCR", Key: "set1"},
+	})
+	g.Expect(err).NotTo(BeNil())
+}
+
+func TestTransaction(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cfg := Config{
+		Suffix:  "_redistest",
+		Prefix:  "redistest_",
+		Address: "redis:6379",
+		Net:     "tcp",
+		DB:      0,
+	}
+	r := NewRedis(&cfg)
+	err := r.Del("*")
+	g.Expect(err).To(BeNil())
+
+	err = r.Set("key1", "value1")
+	g.Expect(err).To(BeNil())
+	err = r.Transaction(func(get func(keys ...string) ([]string, error)) ([]Command, error) {
+		values, err := get("key1", "key2")
+		g.Expect(err).To(BeNil())
+		g.Expect(values).To(Equal([]string{"value1", ""}))
+		return []Command{{Name: "SET", Key: "key2", Args: []interface{}{values[0]}}}, nil
+	})
+	g.Expect(err).To(BeNil())
+	v, err := r.Get("key2")
+	g.Expect(err).To(BeNil())
+	g.Expect(v).To(Equal("value1"))
+
+	err = r.Transaction(func(get func(keys ...string) ([]string, error)) ([]Command, error) {
+		_, err := get("key1")
+		g.Expect(err).To(BeNil())
+		err = r.Set("key1", "value3")
+		g.Expect(err).To(BeNil())
+		return []Command{{Name: "SET", Key: "key2", Args: []interface{}{"value2"}}}, nil
+	})
+	g.Expect(err).To(Equal(ErrTransactionAborted))
+	v, err = r.Get("key2")
+	g.Expect(err).To(BeNil())
+	g.Expect(v).To(Equal("value1"))
+}
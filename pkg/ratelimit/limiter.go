@@ -1,45 +1,193 @@
 package ratelimit
 
 import (
+	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hashicorp/go-immutable-radix"
 	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
 )
 
 type RateLimiter struct {
-	Limiters  *cache.Cache
-	MaxTime   time.Duration
-	TimeStep  time.Duration
-	Config    *Config
-	WhiteList map[string]interface{}
-	BlackList map[string]interface{}
+	Limiters *cache.Cache
+	MaxTime  time.Duration
+	TimeStep time.Duration
+	Config   *Config
+	rules    atomic.Value
+	quit     chan struct{}
+	quitWG   sync.WaitGroup
 }
 
 type Config struct {
-	Enable    bool     `json:"enable"`
-	Burst     int      `json:"burst"`
-	Rate      int      `json:"rate"`
-	WhiteList []string `json:"whitelist"`
-	BlackList []string `json:"blacklist"`
+	Enable    bool           `json:"enable"`
+	Burst     int            `json:"burst"`
+	Rate      int            `json:"rate"`
+	WhiteList []string       `json:"whitelist"`
+	BlackList []string       `json:"blacklist"`
+	Prefixes  []PrefixConfig `json:"prefixes"`
+	Reload    int            `json:"reload"`
+}
+
+// PrefixConfig sets rate and burst of clients in prefix, prefix is an ip address or a network in CIDR notation
+type PrefixConfig struct {
+	Prefix string `json:"prefix"`
+	Rate   int    `json:"rate"`
+	Burst  int    `json:"burst"`
+}
+
+// Lists are loaded in addition to lists in config
+type Lists struct {
+	WhiteList []string       `json:"whitelist"`
+	BlackList []string       `json:"blacklist"`
+	Prefixes  []PrefixConfig `json:"prefixes"`
+}
+
+const (
+	ruleLimit = iota
+	ruleAllow
+	ruleDeny
+)
+
+type rule struct {
+	action   int
+	timeStep time.Duration
+	maxTime  time.Duration
+}
+
+// rules holds ip and network entries in a trie keyed by prefix bits, entries which are not ip addresses are matched exactly
+type rules struct {
+	prefixes *iradix.Tree
+	exact    map[string]*rule
 }
 
 func NewRateLimiter(config *Config) *RateLimiter {
 	rl := &RateLimiter{
 		Config: config,
+		quit:   make(chan struct{}),
 	}
 	rl.Limiters = cache.New(time.Minute, time.Minute*10)
-	rl.WhiteList = make(map[string]interface{})
-	for _, x := range config.WhiteList {
-		rl.WhiteList[x] = nil
+	rl.TimeStep, rl.MaxTime = limits(config.Rate, config.Burst)
+	rl.Load(nil)
+	return rl
+}
+
+func limits(rate int, burst int) (time.Duration, time.Duration) {
+	if rate <= 0 {
+		return 0, 0
+	}
+	timeStep := time.Duration(60000/rate) * time.Millisecond
+	return timeStep, timeStep * time.Duration(burst)
+}
+
+// Load replaces lists loaded from an external source, entries in config are always kept
+func (rl *RateLimiter) Load(lists *Lists) {
+	r := &rules{
+		prefixes: iradix.New(),
+		exact:    make(map[string]*rule),
 	}
-	rl.BlackList = make(map[string]interface{})
-	for _, x := range config.BlackList {
-		rl.BlackList[x] = nil
+	all := []*Lists{{WhiteList: rl.Config.WhiteList, BlackList: rl.Config.BlackList, Prefixes: rl.Config.Prefixes}}
+	if lists != nil {
+		all = append(all, lists)
 	}
-	rl.TimeStep = time.Duration(60000/config.Rate) * time.Millisecond
-	rl.MaxTime = rl.TimeStep * time.Duration(config.Burst)
-	return rl
+	for _, l := range all {
+		for _, p := range l.Prefixes {
+			timeStep, maxTime := limits(p.Rate, p.Burst)
+			r.add(p.Prefix, &rule{action: ruleLimit, timeStep: timeStep, maxTime: maxTime})
+		}
+		for _, x := range l.WhiteList {
+			r.add(x, &rule{action: ruleAllow})
+		}
+		for _, x := range l.BlackList {
+			r.add(x, &rule{action: ruleDeny})
+		}
+	}
+	rl.rules.Store(r)
+}
+
+func (r *rules) add(entry string, ru *rule) {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			r.exact[entry] = ru
+			return
+		}
+		r.prefixes, _, _ = r.prefixes.Insert(prefixKey(ip, net.IPv6len*8), ru)
+		return
+	}
+	ip, network, err := net.ParseCIDR(entry)
+	if err != nil {
+		zap.L().Error("invalid ratelimit prefix", zap.String("prefix", entry), zap.Error(err))
+		return
+	}
+	ones, bits := network.Mask.Size()
+	if ip.To4() != nil {
+		// ipv4 addresses are stored as ipv4-mapped ipv6 addresses
+		ones += net.IPv6len*8 - bits
+	}
+	r.prefixes, _, _ = r.prefixes.Insert(prefixKey(network.IP, ones), ru)
+}
+
+func (r *rules) find(key string) *rule {
+	if ip := net.ParseIP(key); ip != nil {
+		if _, value, ok := r.prefixes.Root().LongestPrefix(prefixKey(ip, net.IPv6len*8)); ok {
+			return value.(*rule)
+		}
+		return nil
+	}
+	return r.exact[key]
+}
+
+// prefixKey returns first ones bits of ip as a string of '0' and '1' bytes
+func prefixKey(ip net.IP, ones int) []byte {
+	ip = ip.To16()
+	key := make([]byte, ones)
+	for i := 0; i < ones; i++ {
+		if ip[i/8]&(0x80>>uint(i%8)) != 0 {
+			key[i] = '1'
+		} else {
+			key[i] = '0'
+		}
+	}
+	return key
+}
+
+// StartReload loads lists from source every Config.Reload seconds
+func (rl *RateLimiter) StartReload(source func() (*Lists, error)) {
+	if rl.Config.Reload <= 0 {
+		return
+	}
+	load := func() {
+		lists, err := source()
+		if err != nil {
+			zap.L().Error("cannot load ratelimit lists", zap.Error(err))
+			return
+		}
+		rl.Load(lists)
+	}
+	load()
+	rl.quitWG.Add(1)
+	go func() {
+		defer rl.quitWG.Done()
+		ticker := time.NewTicker(time.Duration(rl.Config.Reload) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rl.quit:
+				return
+			case <-ticker.C:
+				load()
+			}
+		}
+	}()
+}
+
+func (rl *RateLimiter) ShutDown() {
+	close(rl.quit)
+	rl.quitWG.Wait()
 }
 
 type Limiter struct {
@@ -53,10 +201,18 @@ func (rl *RateLimiter) CanHandle(key string) bool {
 		return true
 	}
 
-	if _, exist := rl.BlackList[key]; exist {
-		return false
+	timeStep, maxTime := rl.TimeStep, rl.MaxTime
+	if r := rl.rules.Load().(*rules).find(key); r != nil {
+		switch r.action {
+		case ruleDeny:
+			return false
+		case ruleAllow:
+			return true
+		default:
+			timeStep, maxTime = r.timeStep, r.maxTime
+		}
 	}
-	if _, exist := rl.WhiteList[key]; exist {
+	if timeStep == 0 {
 		return true
 	}
 	var (
@@ -74,17 +230,17 @@ func (rl *RateLimiter) CanHandle(key string) bool {
 		if l.Size < 0 {
 			l.Size = 0
 		}
-		if l.Size > rl.MaxTime {
+		if l.Size > maxTime {
 			res = false
 		} else {
-			l.Size += rl.TimeStep
+			l.Size += timeStep
 			res = true
 		}
 		rl.Limiters.Set(key, l, time.Minute)
 		l.Mutex.Unlock()
 	} else {
 		l = &Limiter{
-			Size:       rl.TimeStep,
+			Size:       timeStep,
 			LastUpdate: time.Now(),
 			Mutex:      &sync.Mutex{},
 		}
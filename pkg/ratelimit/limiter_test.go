@@ -62,3 +62,56 @@ func TestLimiter(t *testing.T) {
 	}
 	fmt.Println("fail : ", fail, " success : ", success)
 }
+
+func TestPrefixes(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cfg := Config{
+		Enable:    true,
+		Rate:      60000,
+		Burst:     2,
+		WhiteList: []string{"10.0.0.0/8", "2001:db8:1::/48"},
+		BlackList: []string{"10.1.0.0/16", "192.0.2.1"},
+		Prefixes: []PrefixConfig{
+			{Prefix: "10.1.1.0/24", Rate: 60000, Burst: 10},
+			{Prefix: "198.51.100.0/24", Rate: 0},
+			{Prefix: "invalid/24", Rate: 1},
+		},
+	}
+	rl := NewRateLimiter(&cfg)
+	handled := func(ip string, count int) int {
+		res := 0
+		for i := 0; i < count; i++ {
+			if rl.CanHandle(ip) {
+				res++
+			}
+		}
+		return res
+	}
+
+	// most specific entry wins
+	g.Expect(handled("10.2.3.4", 100)).To(Equal(100))
+	g.Expect(handled("10.1.2.3", 1)).To(Equal(0))
+	g.Expect(handled("10.1.1.1", 20)).To(Equal(11))
+	g.Expect(handled("192.0.2.1", 1)).To(Equal(0))
+	g.Expect(handled("192.0.2.2", 20)).To(Equal(3))
+	g.Expect(handled("198.51.100.1", 100)).To(Equal(100))
+	g.Expect(handled("2001:db8:1:ffff::1", 100)).To(Equal(100))
+	g.Expect(handled("2001:db8:2::1", 20)).To(Equal(3))
+
+	// loaded lists are added to config lists and replace previously loaded lists
+	rl.Load(&Lists{BlackList: []string{"2001:db8:2::/48"}, WhiteList: []string{"203.0.113.0/24"}})
+	g.Expect(handled("2001:db8:2::2", 1)).To(Equal(0))
+	g.Expect(handled("203.0.113.1", 100)).To(Equal(100))
+	g.Expect(handled("10.2.3.4", 100)).To(Equal(100))
+	rl.Load(&Lists{})
+	g.Expect(handled("2001:db8:2::3", 1)).To(Equal(1))
+
+	// lists are reloaded from source
+	cfg.Reload = 1
+	rl = NewRateLimiter(&cfg)
+	rl.StartReload(func() (*Lists, error) {
+		return &Lists{BlackList: []string{"203.0.113.0/24"}}, nil
+	})
+	defer rl.ShutDown()
+	g.Expect(handled("203.0.113.1", 1)).To(Equal(0))
+}
@@ -80,7 +80,7 @@ DROP TABLE IF EXISTS `z42`.`RecordSet` ;
 
 CREATE TABLE IF NOT EXISTS `z42`.`RecordSet` (
                                                  `Id` CHAR(36) NOT NULL,
-                                                 `Type` ENUM('a', 'aaaa', 'cname', 'txt', 'ns', 'mx', 'srv', 'caa', 'ptr', 'tlsa', 'ds', 'aname') NOT NULL,
+                                                 `Type` ENUM('a', 'aaaa', 'cname', 'txt', 'ns', 'mx', 'srv', 'caa', 'ptr', 'tlsa', 'ds', 'sshfp', 'naptr', 'uri', 'hinfo', 'smimea', 'openpgpkey', 'svcb', 'https', 'dname', 'aname') NOT NULL,
                                                  `Value` JSON NULL,
                                                  `Enabled` TINYINT NOT NULL,
                                                  `Location_Id` CHAR(36) NOT NULL,
@@ -59,6 +59,15 @@ func NewRedisDumpQueryGenerator(redisAddress string) *RedisDumpQueryGenerator {
 			g.queries = append(g.queries, query.Query{QName: qname, QType: "PTR"})
 			g.queries = append(g.queries, query.Query{QName: qname, QType: "CAA"})
 			g.queries = append(g.queries, query.Query{QName: qname, QType: "TLSA"})
+			g.queries = append(g.queries, query.Query{QName: qname, QType: "SSHFP"})
+			g.queries = append(g.queries, query.Query{QName: qname, QType: "NAPTR"})
+			g.queries = append(g.queries, query.Query{QName: qname, QType: "URI"})
+			g.queries = append(g.queries, query.Query{QName: qname, QType: "HINFO"})
+			g.queries = append(g.queries, query.Query{QName: qname, QType: "SMIMEA"})
+			g.queries = append(g.queries, query.Query{QName: qname, QType: "OPENPGPKEY"})
+			g.queries = append(g.queries, query.Query{QName: qname, QType: "SVCB"})
+			g.queries = append(g.queries, query.Query{QName: qname, QType: "HTTPS"})
+			g.queries = append(g.queries, query.Query{QName: qname, QType: "DNAME"})
 			g.queries = append(g.queries, query.Query{QName: qname, QType: "SOA"})
 			g.queries = append(g.queries, query.Query{QName: qname, QType: "DNSKEY"})
 		}